@@ -0,0 +1,166 @@
+package syslog
+
+import (
+	"crypto/tls"
+	"errors"
+	"io"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrPeerRejected is the close reason of a TLS or DTLS session whose peer
+	// the TlsPeerNameFunc or TlsPeerStateFunc rejected
+	ErrPeerRejected = errors.New("tls peer rejected")
+	// ErrDTLSPeerNameFunc is the close reason of the DTLS sessions of a server
+	// whose TlsPeerNameFunc, which only applies to TLS, was replaced without
+	// setting a TlsPeerStateFunc
+	ErrDTLSPeerNameFunc = errors.New("dtls peers can not be named by a TlsPeerNameFunc")
+	// ErrListenerStopped is the close reason of a connection closed because
+	// its listener was removed or the server killed
+	ErrListenerStopped = errors.New("listener stopped")
+)
+
+// ConnInfo describes a TCP, TLS or DTLS connection of the server
+type ConnInfo struct {
+	ID         uint64
+	RemoteAddr string
+	// TlsPeer is set once the peer is authenticated
+	TlsPeer string
+	// Listener is the address of the listener which accepted the connection
+	// and Network its network, as taken by AddListener
+	Listener     string
+	Network      string
+	Started      time.Time
+	LastActivity time.Time
+	Bytes        int64
+	Messages     int64
+}
+
+// ConnHooks are called from the goroutine serving a connection, so they
+// should return quickly. Any of them may be nil.
+type ConnHooks struct {
+	// OnOpen is called once a connection is accepted, before any handshake
+	OnOpen func(info ConnInfo)
+	// OnTLSAuthenticated is called once the peer of a TLS or DTLS session is
+	// verified and named
+	OnTLSAuthenticated func(info ConnInfo, state *tls.ConnectionState)
+	// OnClose is called once a connection is closed. reason is nil if the
+	// peer closed it, ErrListenerStopped, ErrPeerRejected, a
+	// *RevokedPeerError or the read or handshake error otherwise.
+	OnClose func(info ConnInfo, reason error)
+}
+
+// SetConnHooks Sets the functions called along the lifecycle of connections
+func (s *Server) SetConnHooks(hooks ConnHooks) {
+	s.connHooks = hooks
+}
+
+// trackedConn holds the counters of a connection
+type trackedConn struct {
+	id         uint64
+	remoteAddr string
+	listener   string
+	network    string
+	started    time.Time
+
+	tlsPeer      atomic.Pointer[string]
+	lastActivity atomic.Int64
+	bytes        atomic.Int64
+	messages     atomic.Int64
+}
+
+func (c *trackedConn) info() ConnInfo {
+	info := ConnInfo{
+		ID:           c.id,
+		RemoteAddr:   c.remoteAddr,
+		Listener:     c.listener,
+		Network:      c.network,
+		Started:      c.started,
+		LastActivity: time.Unix(0, c.lastActivity.Load()),
+		Bytes:        c.bytes.Load(),
+		Messages:     c.messages.Load(),
+	}
+	if tlsPeer := c.tlsPeer.Load(); tlsPeer != nil {
+		info.TlsPeer = *tlsPeer
+	}
+	return info
+}
+
+// received accounts n bytes read from the connection
+func (c *trackedConn) received(n int) {
+	if n > 0 {
+		c.bytes.Add(int64(n))
+		c.lastActivity.Store(time.Now().UnixNano())
+	}
+}
+
+// countingReader counts the bytes read from a connection
+type countingReader struct {
+	io.Reader
+	conn *trackedConn
+}
+
+func (r countingReader) Read(b []byte) (int, error) {
+	n, err := r.Reader.Read(b)
+	r.conn.received(n)
+	return n, err
+}
+
+// openConn registers a connection l accepted, l may be nil
+func (s *Server) openConn(l *listener, remoteAddr string) *trackedConn {
+	now := time.Now()
+	conn := &trackedConn{
+		id:         s.nextConnID.Add(1),
+		remoteAddr: remoteAddr,
+		started:    now,
+	}
+	conn.lastActivity.Store(now.UnixNano())
+	if l != nil {
+		conn.listener, conn.network = l.bound, l.network
+	}
+
+	s.connMu.Lock()
+	if s.conns == nil {
+		s.conns = make(map[uint64]*trackedConn)
+	}
+	s.conns[conn.id] = conn
+	s.connMu.Unlock()
+
+	if s.connHooks.OnOpen != nil {
+		s.connHooks.OnOpen(conn.info())
+	}
+	return conn
+}
+
+// authenticated records the peer of a TLS or DTLS session
+func (s *Server) authenticated(conn *trackedConn, tlsPeer string, state *tls.ConnectionState) {
+	conn.tlsPeer.Store(&tlsPeer)
+	if s.connHooks.OnTLSAuthenticated != nil {
+		s.connHooks.OnTLSAuthenticated(conn.info(), state)
+	}
+}
+
+func (s *Server) closeConn(conn *trackedConn, reason error) {
+	s.connMu.Lock()
+	delete(s.conns, conn.id)
+	s.connMu.Unlock()
+
+	if s.connHooks.OnClose != nil {
+		s.connHooks.OnClose(conn.info(), reason)
+	}
+}
+
+// Connections returns the open TCP, TLS and DTLS connections, oldest first
+func (s *Server) Connections() []ConnInfo {
+	s.connMu.Lock()
+	infos := make([]ConnInfo, 0, len(s.conns))
+	for _, conn := range s.conns {
+		infos = append(infos, conn.info())
+	}
+	s.connMu.Unlock()
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos
+}
@@ -0,0 +1,141 @@
+package syslog
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type connEvent struct {
+	kind   string
+	info   ConnInfo
+	reason error
+}
+
+func recordConnHooks(events chan connEvent) ConnHooks {
+	return ConnHooks{
+		OnOpen: func(info ConnInfo) {
+			events <- connEvent{kind: "open", info: info}
+		},
+		OnTLSAuthenticated: func(info ConnInfo, state *tls.ConnectionState) {
+			events <- connEvent{kind: "tls", info: info}
+		},
+		OnClose: func(info ConnInfo, reason error) {
+			events <- connEvent{kind: "close", info: info, reason: reason}
+		},
+	}
+}
+
+func nextConnEvent(c *C, events chan connEvent) connEvent {
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(5 * time.Second):
+		c.Fatal("timed out waiting for a connection event")
+	}
+	return connEvent{}
+}
+
+func (s *ServerSuite) TestConnHooks(c *C) {
+	events := make(chan connEvent, 10)
+	channel := make(LogPartsChannel, 10)
+	server := NewServer()
+	server.SetFormat(RFC3164)
+	server.SetHandler(NewChannelHandler(channel))
+	server.SetConnHooks(recordConnHooks(events))
+	addr, err := server.AddListener("tcp", "127.0.0.1:0", nil)
+	c.Assert(err, IsNil)
+	server.Boot()
+
+	conn, err := net.Dial("tcp", addr.String())
+	c.Assert(err, IsNil)
+	open := nextConnEvent(c, events)
+	c.Check(open.kind, Equals, "open")
+	c.Check(open.info.RemoteAddr, Equals, conn.LocalAddr().String())
+	c.Check(open.info.Listener, Equals, addr.String())
+	c.Check(open.info.Network, Equals, "tcp")
+
+	msg := exampleSyslog + "\n"
+	_, err = conn.Write([]byte(msg + msg))
+	c.Assert(err, IsNil)
+	<-channel
+	<-channel
+
+	active := server.Connections()
+	c.Assert(active, HasLen, 1)
+	c.Check(active[0].ID, Equals, open.info.ID)
+	c.Check(active[0].Messages, Equals, int64(2))
+	c.Check(active[0].Bytes, Equals, int64(2*len(msg)))
+	c.Check(active[0].LastActivity.Before(active[0].Started), Equals, false)
+
+	conn.Close()
+	closed := nextConnEvent(c, events)
+	c.Check(closed.kind, Equals, "close")
+	c.Check(closed.reason, IsNil)
+	c.Check(closed.info.Messages, Equals, int64(2))
+	c.Check(server.Connections(), HasLen, 0)
+
+	// Removing the listener closes its connections
+	conn, err = net.Dial("tcp", addr.String())
+	c.Assert(err, IsNil)
+	c.Check(nextConnEvent(c, events).kind, Equals, "open")
+	c.Assert(server.RemoveListener(addr.String()), IsNil)
+	closed = nextConnEvent(c, events)
+	c.Check(closed.kind, Equals, "close")
+	c.Check(closed.reason, Equals, ErrListenerStopped)
+
+	conn.Close()
+	server.Kill()
+	server.Wait()
+}
+
+func (s *ServerSuite) TestConnHooksTLS(c *C) {
+	pki := newTestPKI()
+	events := make(chan connEvent, 10)
+	channel := make(LogPartsChannel, 10)
+	server := NewServer()
+	server.SetFormat(RFC5424)
+	server.SetHandler(NewChannelHandler(channel))
+	server.SetConnHooks(recordConnHooks(events))
+	server.SetTlsPeerStateFunc(func(state *tls.ConnectionState) (string, bool) {
+		return "device1", state.PeerCertificates[0].Subject.CommonName == "device1"
+	})
+	addr, err := server.AddListener("tls", "127.0.0.1:0", pki.serverConfig())
+	c.Assert(err, IsNil)
+	server.Boot()
+
+	conn, err := tls.Dial("tcp", addr.String(), pki.clientConfig())
+	c.Assert(err, IsNil)
+	c.Check(nextConnEvent(c, events).kind, Equals, "open")
+	authenticated := nextConnEvent(c, events)
+	c.Check(authenticated.kind, Equals, "tls")
+	c.Check(authenticated.info.TlsPeer, Equals, "device1")
+	active := server.Connections()
+	c.Assert(active, HasLen, 1)
+	c.Check(active[0].TlsPeer, Equals, "device1")
+	c.Check(active[0].Network, Equals, "tls")
+	conn.Close()
+	c.Check(nextConnEvent(c, events).kind, Equals, "close")
+
+	// A rejected peer
+	config := pki.clientConfig()
+	config.Certificates = []tls.Certificate{pki.issue(20, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "device2"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})}
+	conn, err = tls.Dial("tcp", addr.String(), config)
+	c.Assert(err, IsNil)
+	conn.Write([]byte(exampleRFC5424Syslog + "\n"))
+	c.Check(nextConnEvent(c, events).kind, Equals, "open")
+	closed := nextConnEvent(c, events)
+	c.Check(closed.kind, Equals, "close")
+	c.Check(closed.reason, Equals, ErrPeerRejected)
+
+	conn.Close()
+	server.Kill()
+	server.Wait()
+}
@@ -0,0 +1,252 @@
+package syslog
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultCRLWatchInterval = time.Minute
+
+// RevokedPeerError reports a TLS or DTLS peer rejected because a CRL lists
+// one of the certificates of its chain
+type RevokedPeerError struct {
+	Client       string
+	SerialNumber *big.Int
+	Issuer       string
+}
+
+func (e *RevokedPeerError) Error() string {
+	return fmt.Sprintf("tls peer %s rejected: certificate serial %s revoked by %s", e.Client, e.SerialNumber, e.Issuer)
+}
+
+// CRLChecker checks peer certificates against certificate revocation lists
+// loaded from files, in PEM or DER. The files are checked for changes every
+// minute, see SetWatchInterval. A failed reload is reported and leaves the
+// current lists in place.
+type CRLChecker struct {
+	files    []string
+	stamps   []fileStamp
+	interval time.Duration
+
+	mu      sync.Mutex
+	current atomic.Pointer[crlSet]
+}
+
+// crlSet holds the revocation lists by the raw subject of their issuer
+type crlSet map[string][]*x509.RevocationList
+
+// NewCRLChecker returns a CRLChecker loading the CRLs from files
+func NewCRLChecker(files ...string) (*CRLChecker, error) {
+	c := &CRLChecker{
+		files:    files,
+		stamps:   make([]fileStamp, len(files)),
+		interval: defaultCRLWatchInterval,
+	}
+	if err := c.Reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// SetWatchInterval Sets how often the files are checked for changes, 0 turns
+// checking off, leaving Reload
+func (c *CRLChecker) SetWatchInterval(interval time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.interval = interval
+}
+
+func (c *CRLChecker) watchInterval() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.interval
+}
+
+// Reload loads the files now. On failure the current lists are kept.
+func (c *CRLChecker) Reload() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	set := make(crlSet)
+	for i, file := range c.files {
+		c.stamps[i] = statFile(file)
+
+		lists, err := loadCRLs(file)
+		if err != nil {
+			return err
+		}
+		for _, crl := range lists {
+			set[string(crl.RawIssuer)] = append(set[string(crl.RawIssuer)], crl)
+		}
+	}
+
+	c.current.Store(&set)
+	return nil
+}
+
+func (c *CRLChecker) reloadIfChanged() error {
+	c.mu.Lock()
+	changed := false
+	for i, file := range c.files {
+		if statFile(file) != c.stamps[i] {
+			changed = true
+		}
+	}
+	c.mu.Unlock()
+
+	if !changed {
+		return nil
+	}
+	return c.Reload()
+}
+
+// loadCRLs reads every CRL of a PEM file, or the single CRL of a DER one
+func loadCRLs(file string) ([]*x509.RevocationList, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.Contains(data, []byte("-----BEGIN")) {
+		crl, err := x509.ParseRevocationList(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		return []*x509.RevocationList{crl}, nil
+	}
+
+	var lists []*x509.RevocationList
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "X509 CRL" {
+			continue
+		}
+		crl, err := x509.ParseRevocationList(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		lists = append(lists, crl)
+	}
+	if len(lists) == 0 {
+		return nil, fmt.Errorf("%s: no CRL found", file)
+	}
+	return lists, nil
+}
+
+// Revoked returns the first certificate of the chain a CRL lists. The
+// signature of a CRL is checked whenever its issuer is part of the chain.
+func (c *CRLChecker) Revoked(chain []*x509.Certificate) (*x509.Certificate, bool) {
+	set := *c.current.Load()
+
+	for i, cert := range chain {
+		var issuer *x509.Certificate
+		if i+1 < len(chain) {
+			issuer = chain[i+1]
+		}
+
+		for _, crl := range set[string(cert.RawIssuer)] {
+			if issuer != nil && crl.CheckSignatureFrom(issuer) != nil {
+				continue
+			}
+			for _, entry := range crl.RevokedCertificateEntries {
+				if entry.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+					return cert, true
+				}
+			}
+		}
+	}
+	return nil, false
+}
+
+// checkRevoked returns a RevokedPeerError if the peer of state was revoked
+func (c *CRLChecker) checkRevoked(state *tls.ConnectionState, client string) error {
+	chain := state.PeerCertificates
+	if len(state.VerifiedChains) > 0 {
+		chain = state.VerifiedChains[0]
+	}
+
+	cert, revoked := c.Revoked(chain)
+	if !revoked {
+		return nil
+	}
+	return &RevokedPeerError{
+		Client:       client,
+		SerialNumber: cert.SerialNumber,
+		Issuer:       cert.Issuer.String(),
+	}
+}
+
+// SetCRLChecker Sets the CRLs TLS and DTLS peers are checked against right
+// after the handshake. Revoked peers are disconnected and reported as
+// RevokedPeerError. On a running server, the files of checker are watched
+// from now on, and the ones of the former checker no longer.
+func (s *Server) SetCRLChecker(checker *CRLChecker) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.crlStop != nil {
+		close(s.crlStop)
+		s.crlStop = nil
+	}
+	s.crlChecker.Store(checker)
+	if s.running && checker != nil {
+		s.goWatchCRLs(checker)
+	}
+}
+
+// tlsPeerRevoked reports and returns the RevokedPeerError of a revoked peer
+func (s *Server) tlsPeerRevoked(state *tls.ConnectionState, client string) error {
+	checker := s.crlChecker.Load()
+	if checker == nil {
+		return nil
+	}
+	err := checker.checkRevoked(state, client)
+	if err != nil {
+		s.report(err)
+	}
+	return err
+}
+
+// goWatchCRLs reloads the changed files of checker until the server stops or
+// another checker is set. It is called with s.mu held.
+func (s *Server) goWatchCRLs(checker *CRLChecker) {
+	interval := checker.watchInterval()
+	if interval <= 0 {
+		return
+	}
+
+	done, stop := s.done, make(chan struct{})
+	s.crlStop = stop
+
+	s.spawn(nil, func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+
+			if err := checker.reloadIfChanged(); err != nil {
+				err = fmt.Errorf("CRL reload failed, keeping the current lists: %w", err)
+				s.report(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,185 @@
+package syslog
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+// writeCRL writes a CRL of pki revoking serials to file, PEM encoded
+func writeCRL(c *C, file string, pki *testPKI, number int64, serials ...int64) {
+	template := &x509.RevocationList{
+		Number:     big.NewInt(number),
+		ThisUpdate: time.Now().Add(-time.Minute),
+		NextUpdate: time.Now().Add(time.Hour),
+	}
+	for _, serial := range serials {
+		template.RevokedCertificateEntries = append(template.RevokedCertificateEntries, x509.RevocationListEntry{
+			SerialNumber:   big.NewInt(serial),
+			RevocationTime: time.Now().Add(-time.Minute),
+		})
+	}
+	der, err := x509.CreateRevocationList(rand.Reader, template, pki.ca, pki.caKey)
+	c.Assert(err, IsNil)
+	writePEM(c, file, "X509 CRL", der)
+}
+
+func (s *ServerSuite) TestCRLChecker(c *C) {
+	dir := c.MkDir()
+	pki, other := newTestPKI(), newTestPKI()
+	chain := []*x509.Certificate{pki.client.Leaf, pki.ca}
+
+	crlFile := filepath.Join(dir, "ca.crl")
+	writeCRL(c, crlFile, pki, 1, 3)
+	checker, err := NewCRLChecker(crlFile)
+	c.Assert(err, IsNil)
+
+	cert, revoked := checker.Revoked(chain)
+	c.Check(revoked, Equals, true)
+	c.Check(cert, Equals, pki.client.Leaf)
+
+	_, revoked = checker.Revoked([]*x509.Certificate{pki.server.Leaf, pki.ca})
+	c.Check(revoked, Equals, false)
+
+	// A CRL of another CA of the same name does not apply
+	otherFile := filepath.Join(dir, "other.crl")
+	writeCRL(c, otherFile, other, 1, 3)
+	checker, err = NewCRLChecker(otherFile)
+	c.Assert(err, IsNil)
+	_, revoked = checker.Revoked(chain)
+	c.Check(revoked, Equals, false)
+
+	// Broken files keep the current lists
+	c.Assert(os.WriteFile(otherFile, []byte("garbage"), 0600), IsNil)
+	c.Check(checker.Reload(), NotNil)
+	_, revoked = checker.Revoked([]*x509.Certificate{other.client.Leaf, other.ca})
+	c.Check(revoked, Equals, true)
+
+	_, err = NewCRLChecker(filepath.Join(dir, "missing.crl"))
+	c.Check(err, NotNil)
+}
+
+func (s *ServerSuite) TestTLSRevokedPeer(c *C) {
+	pki := newTestPKI()
+	crlFile := filepath.Join(c.MkDir(), "ca.crl")
+	writeCRL(c, crlFile, pki, 1, 3)
+	checker, err := NewCRLChecker(crlFile)
+	c.Assert(err, IsNil)
+	checker.SetWatchInterval(10 * time.Millisecond)
+
+	channel := make(LogPartsChannel, 1)
+	server := NewServer()
+	server.SetFormat(RFC5424)
+	server.SetHandler(NewChannelHandler(channel))
+	server.SetCRLChecker(checker)
+	err = server.ListenTCPTLS("127.0.0.1:0", pki.serverConfig())
+	c.Assert(err, IsNil)
+	server.Boot()
+	addr := server.listeners[0].Addr().String()
+
+	conn, err := tls.Dial("tcp", addr, pki.clientConfig())
+	c.Assert(err, IsNil)
+	_, _ = conn.Write([]byte(exampleRFC5424Syslog + "\n"))
+
+	select {
+	case err := <-server.ErrChan:
+		var revokedErr *RevokedPeerError
+		c.Assert(errors.As(err, &revokedErr), Equals, true, Commentf("%v", err))
+		c.Check(revokedErr.Client, Equals, conn.LocalAddr().String())
+		c.Check(revokedErr.SerialNumber.Int64(), Equals, int64(3))
+		c.Check(err, ErrorMatches, "tls peer .* rejected: certificate serial 3 revoked by CN=testca")
+	case <-time.After(5 * time.Second):
+		c.Fatal("timed out waiting for the rejection")
+	}
+	conn.Close()
+
+	select {
+	case <-channel:
+		c.Fatal("message of a revoked peer delivered")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Lifting the revocation is picked up while running
+	writeCRL(c, crlFile, pki, 2)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, revoked := checker.Revoked([]*x509.Certificate{pki.client.Leaf, pki.ca}); !revoked {
+			break
+		}
+		if time.Now().After(deadline) {
+			c.Fatal("new CRL not picked up")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	conn, err = tls.Dial("tcp", addr, pki.clientConfig())
+	c.Assert(err, IsNil)
+	_, err = conn.Write([]byte(exampleRFC5424Syslog + "\n"))
+	c.Assert(err, IsNil)
+	select {
+	case <-channel:
+	case <-time.After(5 * time.Second):
+		c.Fatal("timed out waiting for TLS message")
+	}
+
+	conn.Close()
+	server.Kill()
+	server.Wait()
+}
+
+func (s *ServerSuite) TestSetCRLCheckerRunning(c *C) {
+	dir := c.MkDir()
+	pki := newTestPKI()
+	chain := []*x509.Certificate{pki.client.Leaf, pki.ca}
+	newChecker := func(file string) *CRLChecker {
+		writeCRL(c, file, pki, 1)
+		checker, err := NewCRLChecker(file)
+		c.Assert(err, IsNil)
+		checker.SetWatchInterval(10 * time.Millisecond)
+		return checker
+	}
+	waitRevoked := func(checker *CRLChecker) bool {
+		deadline := time.Now().Add(500 * time.Millisecond)
+		for time.Now().Before(deadline) {
+			if _, revoked := checker.Revoked(chain); revoked {
+				return true
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		return false
+	}
+
+	server := NewServer()
+	server.SetFormat(RFC5424)
+	server.SetHandler(new(HandlerMock))
+	c.Assert(server.ListenTCPTLS("127.0.0.1:0", pki.serverConfig()), IsNil)
+	c.Assert(server.Boot(), IsNil)
+
+	// Set while running, the files are watched
+	firstFile := filepath.Join(dir, "first.crl")
+	first := newChecker(firstFile)
+	server.SetCRLChecker(first)
+	writeCRL(c, firstFile, pki, 2, 3)
+	c.Check(waitRevoked(first), Equals, true)
+
+	// Replaced, the former files no longer are
+	secondFile := filepath.Join(dir, "second.crl")
+	second := newChecker(secondFile)
+	server.SetCRLChecker(second)
+	writeCRL(c, firstFile, pki, 3)
+	writeCRL(c, secondFile, pki, 2, 3)
+	c.Check(waitRevoked(second), Equals, true)
+	time.Sleep(100 * time.Millisecond)
+	_, revoked := first.Revoked(chain)
+	c.Check(revoked, Equals, true)
+
+	server.Kill()
+	server.Wait()
+}
@@ -0,0 +1,155 @@
+package syslog
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	defaultMaxDecompressionRatio = 100
+	// decompressionSlack is decompressed without checking the ratio, as
+	// small streams have headers out of proportion
+	decompressionSlack = 64 * 1024
+)
+
+var (
+	// ErrDecompressionRatio is the close reason of a compressed stream which
+	// inflates more than allowed
+	ErrDecompressionRatio = errors.New("decompression ratio limit exceeded")
+	// ErrDecompressedSize is the close reason of a compressed stream which
+	// inflates beyond the size allowed for a connection
+	ErrDecompressedSize = errors.New("decompressed size limit exceeded")
+)
+
+// StreamDecompression configures the decompression of TCP and TLS streams.
+// Compressed streams are told from plain ones by their first bytes, so both
+// are accepted on the same listener.
+type StreamDecompression struct {
+	// Enabled accepts zlib and gzip compressed streams
+	Enabled bool
+	// MaxRatio bounds the decompressed bytes per compressed byte of a
+	// connection, to protect against zip bombs. 0 means 100.
+	MaxRatio int
+	// MaxSize bounds the decompressed bytes of a connection, 0 means no limit
+	MaxSize int64
+}
+
+// SetStreamDecompression Sets whether TCP and TLS listeners accept zlib or gzip
+// compressed streams, and the limits applied to them
+func (s *Server) SetStreamDecompression(decompression StreamDecompression) {
+	s.streamDecompression = decompression
+}
+
+// decompressingReader detects a compressed stream on the first read and
+// inflates it, plain streams are read as they are
+type decompressingReader struct {
+	source       *compressedCounter
+	limits       StreamDecompression
+	report       func(error)
+	reader       io.Reader
+	decompressed int64
+}
+
+func newDecompressingReader(r io.Reader, limits StreamDecompression, report func(error)) *decompressingReader {
+	if limits.MaxRatio <= 0 {
+		limits.MaxRatio = defaultMaxDecompressionRatio
+	}
+	return &decompressingReader{
+		source: &compressedCounter{Reader: bufio.NewReader(r)},
+		limits: limits,
+		report: report,
+	}
+}
+
+func (r *decompressingReader) Read(b []byte) (int, error) {
+	if r.reader == nil {
+		if err := r.detect(); err != nil {
+			return 0, err
+		}
+	}
+	if r.reader == r.source.Reader {
+		return r.reader.Read(b)
+	}
+
+	n, err := r.reader.Read(b)
+	r.decompressed += int64(n)
+	if limitErr := r.checkLimits(); limitErr != nil {
+		r.report(limitErr)
+		return n, limitErr
+	}
+	if err != nil && err != io.EOF {
+		err = fmt.Errorf("decompressing stream: %w", err)
+		r.report(err)
+	}
+	return n, err
+}
+
+// detect picks the reader from the first bytes of the stream
+func (r *decompressingReader) detect() error {
+	first, err := r.source.Peek(1)
+	if err != nil {
+		return err
+	}
+	if first[0] != 0x1f && first[0] != 0x78 {
+		r.reader = r.source.Reader
+		return nil
+	}
+
+	header, err := r.source.Peek(2)
+	if err != nil {
+		if err == io.EOF {
+			r.reader = r.source.Reader
+			return nil
+		}
+		return err
+	}
+	switch {
+	case header[0] == 0x1f && header[1] == 0x8b:
+		r.reader, err = gzip.NewReader(r.source)
+	case header[0] == 0x78 && binary.BigEndian.Uint16(header)%31 == 0:
+		r.reader, err = zlib.NewReader(r.source)
+	default:
+		r.reader = r.source.Reader
+	}
+	if err != nil {
+		err = fmt.Errorf("decompressing stream: %w", err)
+		r.report(err)
+	}
+	return err
+}
+
+func (r *decompressingReader) checkLimits() error {
+	if r.limits.MaxSize > 0 && r.decompressed > r.limits.MaxSize {
+		return ErrDecompressedSize
+	}
+	if r.decompressed > decompressionSlack && r.decompressed > int64(r.limits.MaxRatio)*r.source.n {
+		return ErrDecompressionRatio
+	}
+	return nil
+}
+
+// compressedCounter counts the compressed bytes the decompressors consume,
+// which read byte by byte from an io.ByteReader
+type compressedCounter struct {
+	*bufio.Reader
+	n int64
+}
+
+func (c *compressedCounter) Read(b []byte) (int, error) {
+	n, err := c.Reader.Read(b)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *compressedCounter) ReadByte() (byte, error) {
+	b, err := c.Reader.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
@@ -0,0 +1,94 @@
+package syslog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *ServerSuite) TestStreamDecompression(c *C) {
+	channel := make(LogPartsChannel, 10)
+	closed := make(chan error, 10)
+	server := NewServer()
+	server.SetFormat(RFC5424)
+	server.SetHandler(NewChannelHandler(channel))
+	server.SetStreamDecompression(StreamDecompression{Enabled: true, MaxRatio: 50})
+	server.SetConnHooks(ConnHooks{OnClose: func(info ConnInfo, reason error) { closed <- reason }})
+	addr, err := server.AddListener("tcp", "127.0.0.1:0", nil)
+	c.Assert(err, IsNil)
+	server.Boot()
+	go func() {
+		for range server.ErrChan {
+		}
+	}()
+
+	send := func(compress func(io.Writer) io.WriteCloser, payload string) {
+		conn, err := net.Dial("tcp", addr.String())
+		c.Assert(err, IsNil)
+		defer conn.Close()
+		if compress == nil {
+			_, err = conn.Write([]byte(payload))
+			c.Assert(err, IsNil)
+			return
+		}
+		w := compress(conn)
+		_, err = w.Write([]byte(payload))
+		c.Assert(err, IsNil)
+		c.Assert(w.Close(), IsNil)
+	}
+	gzipWriter := func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }
+	zlibWriter := func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) }
+
+	for _, tc := range []struct {
+		compress func(io.Writer) io.WriteCloser
+		message  string
+	}{
+		{gzipWriter, "over gzip"},
+		{zlibWriter, "over zlib"},
+		{nil, "in plain text"},
+	} {
+		send(tc.compress, "<34>1 2003-10-11T22:14:15.003Z mymachine.example.com su - ID47 - "+tc.message+"\n")
+		logParts := receiveParts(c, channel)
+		c.Check(strings.HasSuffix(logParts["message"].(string), tc.message), Equals, true)
+		c.Check(<-closed, IsNil)
+	}
+
+	// A megabyte of the same byte compresses a thousand times. The server
+	// may close the connection before the write ends.
+	var bomb bytes.Buffer
+	w := gzip.NewWriter(&bomb)
+	w.Write(bytes.Repeat([]byte("a"), 1024*1024))
+	w.Close()
+	conn, err := net.Dial("tcp", addr.String())
+	c.Assert(err, IsNil)
+	conn.Write(bomb.Bytes())
+	conn.Close()
+	select {
+	case reason := <-closed:
+		c.Check(reason, Equals, ErrDecompressionRatio)
+	case <-time.After(5 * time.Second):
+		c.Fatal("timed out waiting for the connection to close")
+	}
+
+	server.Kill()
+	server.Wait()
+}
+
+func (s *ServerSuite) TestDecompressedSize(c *C) {
+	var compressed bytes.Buffer
+	w := zlib.NewWriter(&compressed)
+	w.Write(bytes.Repeat([]byte("<34>1 - - - - - - message\n"), 100))
+	w.Close()
+
+	var reported error
+	reader := newDecompressingReader(&compressed, StreamDecompression{Enabled: true, MaxSize: 1000}, func(err error) { reported = err })
+	_, err := io.ReadAll(reader)
+	c.Check(err, Equals, ErrDecompressedSize)
+	c.Check(reported, Equals, ErrDecompressedSize)
+}
@@ -0,0 +1,271 @@
+package syslog
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pion/dtls/v2"
+	"github.com/pion/dtls/v2/pkg/protocol"
+	"github.com/pion/dtls/v2/pkg/protocol/recordlayer"
+	"github.com/pion/transport/v2/udp"
+)
+
+// dtlsSessions keeps the DTLS sessions of a listener by remote address, so
+// they can be closed along with the server
+type dtlsSessions struct {
+	mu       sync.Mutex
+	sessions map[string]net.Conn
+}
+
+func (d *dtlsSessions) add(conn net.Conn) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.sessions == nil {
+		d.sessions = make(map[string]net.Conn)
+	}
+	d.sessions[conn.RemoteAddr().String()] = conn
+}
+
+func (d *dtlsSessions) remove(conn net.Conn) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.sessions[conn.RemoteAddr().String()] == conn {
+		delete(d.sessions, conn.RemoteAddr().String())
+	}
+}
+
+func (d *dtlsSessions) closeAll() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for addr, conn := range d.sessions {
+		conn.Close()
+		delete(d.sessions, addr)
+	}
+}
+
+type dtlsListener struct {
+	net.Listener
+	config   *tls.Config
+	sessions dtlsSessions
+}
+
+// ListenDTLS Configure the server for listen on an UDP addr for DTLS (RFC6012).
+// The certificates, client CAs and client auth policy are taken from config,
+// or from the one its GetConfigForClient returns on every handshake, so the
+// Config of a TlsReloader can be used. Records are parsed like UDP datagrams,
+// with the server format.
+func (s *Server) ListenDTLS(addr string, config *tls.Config) error {
+	_, err := s.AddListener("dtls", addr, config)
+	return err
+}
+
+func openDTLS(config *tls.Config) func(l *listener, addr string, reopen bool) error {
+	return func(l *listener, addr string, reopen bool) error {
+		udpAddr, err := net.ResolveUDPAddr("udp", addr)
+		if err != nil {
+			return err
+		}
+
+		lc := udp.ListenConfig{
+			// Only handshakes open a new session
+			AcceptFilter: func(packet []byte) bool {
+				pkts, err := recordlayer.UnpackDatagram(packet)
+				if err != nil || len(pkts) < 1 {
+					return false
+				}
+				h := &recordlayer.Header{}
+				if err := h.Unmarshal(pkts[0]); err != nil {
+					return false
+				}
+				return h.ContentType == protocol.ContentTypeHandshake
+			},
+			ReadBufferSize: datagramReadBufferSize,
+		}
+		listener, err := lc.Listen("udp", udpAddr)
+		if err != nil {
+			return err
+		}
+
+		l.dtls = &dtlsListener{
+			Listener: listener,
+			config:   config,
+		}
+		return nil
+	}
+}
+
+// dtlsConfig maps the settings of a tls.Config which apply to DTLS. The
+// config GetConfigForClient returns is the one mapped, the client hello being
+// unknown before the handshake.
+func dtlsConfig(config *tls.Config) (*tls.Config, *dtls.Config, error) {
+	if config.GetConfigForClient != nil {
+		forClient, err := config.GetConfigForClient(&tls.ClientHelloInfo{})
+		if err != nil {
+			return nil, nil, err
+		}
+		if forClient != nil {
+			config = forClient
+		}
+	}
+
+	var getCertificate func(*dtls.ClientHelloInfo) (*tls.Certificate, error)
+	if get := config.GetCertificate; get != nil {
+		getCertificate = func(hello *dtls.ClientHelloInfo) (*tls.Certificate, error) {
+			return get(&tls.ClientHelloInfo{ServerName: hello.ServerName})
+		}
+	}
+	return config, &dtls.Config{
+		Certificates:          config.Certificates,
+		GetCertificate:        getCertificate,
+		ClientAuth:            dtls.ClientAuthType(config.ClientAuth),
+		ClientCAs:             config.ClientCAs,
+		RootCAs:               config.RootCAs,
+		InsecureSkipVerify:    config.InsecureSkipVerify,
+		VerifyPeerCertificate: config.VerifyPeerCertificate,
+		ServerName:            config.ServerName,
+		ExtendedMasterSecret:  dtls.RequestExtendedMasterSecret,
+	}, nil
+}
+
+// dtlsConnectionState describes a DTLS session the way crypto/tls does, so
+// DTLS peers are named like TLS ones
+func dtlsConnectionState(state dtls.State, clientCAs *x509.CertPool) tls.ConnectionState {
+	cs := tls.ConnectionState{HandshakeComplete: true}
+
+	for _, raw := range state.PeerCertificates {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return cs
+		}
+		cs.PeerCertificates = append(cs.PeerCertificates, cert)
+	}
+
+	if len(cs.PeerCertificates) > 0 && clientCAs != nil {
+		intermediates := x509.NewCertPool()
+		for _, cert := range cs.PeerCertificates[1:] {
+			intermediates.AddCert(cert)
+		}
+		chains, err := cs.PeerCertificates[0].Verify(x509.VerifyOptions{
+			Roots:         clientCAs,
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		})
+		if err == nil {
+			cs.VerifiedChains = chains
+		}
+	}
+
+	return cs
+}
+
+func (s *Server) goAcceptDTLS(l *listener) {
+	listener := l.dtls
+
+	s.spawn(l, func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			// Handshake in the session goroutine, so a slow peer does not hold
+			// up the others
+			listener.sessions.add(conn)
+			s.spawn(l, func() { s.serveDTLS(l, conn) })
+		}
+	})
+}
+
+func (s *Server) serveDTLS(l *listener, conn net.Conn) {
+	listener, done := l.dtls, l.done
+	client := conn.RemoteAddr().String()
+	tracked := s.openConn(l, client)
+
+	config, dtlsConf, err := dtlsConfig(listener.config)
+	var dtlsConn *dtls.Conn
+	if err == nil {
+		dtlsConn, err = dtls.Server(conn, dtlsConf)
+	}
+	if err != nil {
+		listener.sessions.remove(conn)
+		conn.Close()
+		s.closeConn(tracked, err)
+		return
+	}
+	// Replace the raw session so closing the server sends a close notify
+	listener.sessions.add(dtlsConn)
+	defer listener.sessions.remove(dtlsConn)
+	defer dtlsConn.Close()
+
+	var reason error
+	defer func() { s.closeConn(tracked, reason) }()
+
+	state := dtlsConnectionState(dtlsConn.ConnectionState(), config.ClientCAs)
+	if reason = s.tlsPeerRevoked(&state, client); reason != nil {
+		return
+	}
+	tlsPeer, reason := s.dtlsPeer(&state)
+	if reason != nil {
+		return
+	}
+	connParts := tlsConnParts(&state)
+	s.authenticated(tracked, tlsPeer, &state)
+
+	// A DTLS record carries at most 2^14 bytes of data
+	buf := make([]byte, 1<<14)
+	for {
+		if s.readTimeoutMilliseconds > 0 {
+			err := dtlsConn.SetReadDeadline(time.Now().Add(time.Duration(s.readTimeoutMilliseconds) * time.Millisecond))
+			if err != nil {
+				s.report(err)
+			}
+		}
+
+		// Every read returns a single record
+		n, err := dtlsConn.Read(buf)
+		tracked.received(n)
+		if err != nil {
+			select {
+			case <-done:
+				reason = ErrListenerStopped
+			default:
+				if !errors.Is(err, io.EOF) {
+					reason = err
+				}
+			}
+			return
+		}
+
+		// Records are taken like UDP datagrams
+		if n := s.trimDatagram(buf[:n]); n > 0 {
+			tracked.messages.Add(1)
+			s.parseDatagram(l, buf[:n], client, tlsPeer, connParts)
+		}
+	}
+}
+
+// dtlsPeer names the peer of a DTLS session like TLS peers are named: not at
+// all if both peer functions are nil, with the TlsPeerStateFunc if set, and by
+// the CN of the certificate otherwise. A TlsPeerNameFunc needs a *tls.Conn,
+// so sessions are rejected if one was set without a TlsPeerStateFunc.
+func (s *Server) dtlsPeer(state *tls.ConnectionState) (tlsPeer string, err error) {
+	ok := true
+	switch {
+	case s.tlsPeerStateFunc != nil:
+		tlsPeer, ok = s.tlsPeerStateFunc(state)
+	case s.tlsPeerNameFunc == nil:
+	case s.customTlsPeerName:
+		return "", ErrDTLSPeerNameFunc
+	default:
+		tlsPeer, ok = defaultTlsPeerState(state)
+	}
+	if !ok {
+		return "", ErrPeerRejected
+	}
+	return tlsPeer, nil
+}
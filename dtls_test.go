@@ -0,0 +1,168 @@
+package syslog
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/GLMONTER/go-syslog/format"
+	"github.com/pion/dtls/v2"
+	. "gopkg.in/check.v1"
+)
+
+func (p *testPKI) dtlsClientConfig() *dtls.Config {
+	return &dtls.Config{
+		Certificates:         []tls.Certificate{p.client},
+		RootCAs:              p.pool,
+		ExtendedMasterSecret: dtls.RequireExtendedMasterSecret,
+	}
+}
+
+func (s *ServerSuite) TestDTLS(c *C) {
+	channel := make(LogPartsChannel, 3)
+	server := NewServer()
+	server.SetFormat(&format.RFC6587{})
+	server.SetHandler(NewChannelHandler(channel))
+	pki := newTestPKI()
+	err := server.ListenDTLS("127.0.0.1:0", pki.serverConfig())
+	c.Assert(err, IsNil)
+	err = server.Boot()
+	c.Assert(err, IsNil)
+
+	addr := server.entries[0].Addr().(*net.UDPAddr)
+	conn, err := dtls.Dial("udp", addr, pki.dtlsClientConfig())
+	c.Assert(err, IsNil)
+	// RFC6012 octet counted frames, two of them in the second record
+	frame := fmt.Sprintf("%d %s", len(exampleRFC5424Syslog), exampleRFC5424Syslog)
+	_, err = conn.Write([]byte(frame))
+	c.Assert(err, IsNil)
+	_, err = conn.Write([]byte(frame + frame))
+	c.Assert(err, IsNil)
+
+	for i := 0; i < 3; i++ {
+		select {
+		case logParts := <-channel:
+			c.Check(logParts["hostname"], Equals, "mymachine.example.com")
+			c.Check(logParts["tls_peer"], Equals, "device1")
+			c.Check(logParts["client"], Equals, conn.LocalAddr().String())
+		case <-time.After(5 * time.Second):
+			c.Fatal("timed out waiting for DTLS message")
+		}
+	}
+
+	conn.Close()
+	server.Kill()
+	server.Wait()
+}
+
+func (s *ServerSuite) TestDTLSConfigForClient(c *C) {
+	channel := make(LogPartsChannel, 1)
+	server := NewServer()
+	server.SetFormat(RFC5424)
+	server.SetHandler(NewChannelHandler(channel))
+	pki := newTestPKI()
+	reloaded := pki
+	reloader, err := NewTlsReloader(func() (*tls.Config, error) {
+		// Only a GetCertificate, as with certificates picked by name
+		config := reloaded.serverConfig()
+		certificate := config.Certificates[0]
+		config.Certificates = nil
+		config.GetCertificate = func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return &certificate, nil
+		}
+		return config, nil
+	})
+	c.Assert(err, IsNil)
+	err = server.ListenDTLS("127.0.0.1:0", reloader.Config())
+	c.Assert(err, IsNil)
+	err = server.Boot()
+	c.Assert(err, IsNil)
+	addr := server.entries[0].Addr().(*net.UDPAddr)
+
+	send := func(pki *testPKI) {
+		conn, err := dtls.Dial("udp", addr, pki.dtlsClientConfig())
+		c.Assert(err, IsNil)
+		defer conn.Close()
+		_, err = conn.Write([]byte(exampleRFC5424Syslog))
+		c.Assert(err, IsNil)
+
+		select {
+		case logParts := <-channel:
+			c.Check(logParts["tls_peer"], Equals, "device1")
+		case <-time.After(5 * time.Second):
+			c.Fatal("timed out waiting for DTLS message")
+		}
+	}
+	send(pki)
+
+	// New sessions get the certificates and CAs reloaded
+	reloaded = newTestPKI()
+	c.Assert(reloader.Reload(), IsNil)
+	send(reloaded)
+
+	server.Kill()
+	server.Wait()
+}
+
+func (s *ServerSuite) TestDTLSNoPeerCheck(c *C) {
+	channel := make(LogPartsChannel, 1)
+	server := NewServer()
+	server.SetFormat(RFC5424)
+	server.SetHandler(NewChannelHandler(channel))
+	server.SetTlsPeerNameFunc(nil)
+	pki := newTestPKI()
+	config := pki.serverConfig()
+	config.ClientAuth = tls.NoClientCert
+	err := server.ListenDTLS("127.0.0.1:0", config)
+	c.Assert(err, IsNil)
+	err = server.Boot()
+	c.Assert(err, IsNil)
+
+	addr := server.entries[0].Addr().(*net.UDPAddr)
+	conn, err := dtls.Dial("udp", addr, &dtls.Config{RootCAs: pki.pool, ExtendedMasterSecret: dtls.RequireExtendedMasterSecret})
+	c.Assert(err, IsNil)
+	_, err = conn.Write([]byte(exampleRFC5424Syslog))
+	c.Assert(err, IsNil)
+
+	select {
+	case logParts := <-channel:
+		c.Check(logParts["tls_peer"], Equals, "")
+	case <-time.After(5 * time.Second):
+		c.Fatal("timed out waiting for DTLS message")
+	}
+
+	conn.Close()
+	server.Kill()
+	server.Wait()
+}
+
+func (s *ServerSuite) TestDTLSPeer(c *C) {
+	pki := newTestPKI()
+	state := &tls.ConnectionState{PeerCertificates: []*x509.Certificate{pki.client.Leaf}}
+	server := NewServer()
+
+	tlsPeer, err := server.dtlsPeer(state)
+	c.Check(err, IsNil)
+	c.Check(tlsPeer, Equals, pki.client.Leaf.Subject.CommonName)
+	_, err = server.dtlsPeer(&tls.ConnectionState{})
+	c.Check(err, Equals, ErrPeerRejected)
+
+	server.SetTlsPeerNameFunc(func(*tls.Conn) (string, bool) { return "custom", true })
+	_, err = server.dtlsPeer(state)
+	c.Check(err, Equals, ErrDTLSPeerNameFunc)
+
+	server.SetTlsPeerStateFunc(func(*tls.ConnectionState) (string, bool) { return "state", true })
+	tlsPeer, err = server.dtlsPeer(state)
+	c.Check(err, IsNil)
+	c.Check(tlsPeer, Equals, "state")
+}
+
+func (s *ServerSuite) TestDTLSConfig(c *C) {
+	_, config, err := dtlsConfig(getServerConfig())
+	c.Assert(err, IsNil)
+	c.Check(config.ClientAuth, Equals, dtls.RequireAndVerifyClientCert)
+	c.Check(config.Certificates, HasLen, 1)
+	c.Check(config.ClientCAs, NotNil)
+}
@@ -0,0 +1,12 @@
+//go:build !unix
+
+package syslog
+
+import (
+	"os"
+)
+
+// fileID returns 0, 0 as files are only known by their path on this system
+func fileID(info os.FileInfo) (device uint64, inode uint64) {
+	return 0, 0
+}
@@ -0,0 +1,439 @@
+package syslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/GLMONTER/go-syslog/format"
+)
+
+const (
+	defaultFilePollInterval  = time.Second
+	defaultFileStateInterval = 5 * time.Second
+	fileReadBufferSize       = 64 * 1024
+	// fileHeadSize is how much of the start of a file is kept to tell if it
+	// was truncated and written again past its former size
+	fileHeadSize = 256
+)
+
+// FileOptions configure the files followed by ListenFiles
+type FileOptions struct {
+	// Paths are files or glob patterns, matched again on every poll so new
+	// files are picked up
+	Paths []string
+	// StateFile keeps the offsets read across restarts. Without it, files
+	// are read from their end on start.
+	StateFile string
+	// PollInterval is how often the files are checked, 0 means 1 second
+	PollInterval time.Duration
+	// StateInterval is how often the offsets read are saved, 0 means 5
+	// seconds. They are also saved when files are rotated or truncated, and
+	// when the listener stops.
+	StateInterval time.Duration
+	// FromBeginning reads the files found on start, which have no offset in
+	// the state file, from their beginning. Files which show up later are
+	// always read from their beginning.
+	FromBeginning bool
+	// Dialects selects the vendor dialects tried on the lines, as
+	// ListenerOptions do for the other listeners
+	Dialects *format.DialectSelection
+}
+
+// fileState is the offset of a file, kept in the state file. The device and
+// inode tell if the file at the path is still the same.
+type fileState struct {
+	Device uint64 `json:"device,omitempty"`
+	Inode  uint64 `json:"inode,omitempty"`
+	Offset int64  `json:"offset"`
+}
+
+// fileTailer follows the files of a listener
+type fileTailer struct {
+	l     *listener
+	opts  FileOptions
+	files map[string]*tailedFile
+	state map[string]fileState
+	// started is set after the first poll
+	started bool
+	dirty   bool
+	// flush saves the state on the next poll, after a file was rotated or
+	// truncated
+	flush bool
+	saved time.Time
+}
+
+type tailedFile struct {
+	path string
+	file *os.File
+	info os.FileInfo
+	// pos is the offset read up to, offset the one of the lines delivered
+	pos      int64
+	offset   int64
+	partial  []byte
+	skipping bool
+	head     []byte
+}
+
+// ListenFiles Configure the server for following log files, line by line. Each
+// line is parsed with the server format, and the dialects of opts, and carries
+// its file as "source". Files rotated by rename are followed under their new
+// name if the paths match it, or read to their end, and the new file is read
+// from its beginning. Truncated files are read again from their beginning.
+// The listener is known to RemoveListener by its paths, joined with commas.
+func (s *Server) ListenFiles(opts FileOptions) error {
+	if len(opts.Paths) == 0 {
+		return errors.New("no file to follow")
+	}
+	for _, pattern := range opts.Paths {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("%s: %w", pattern, err)
+		}
+	}
+
+	l := &listener{
+		kind:      fileListener,
+		network:   "file",
+		requested: strings.Join(opts.Paths, ","),
+		dialects:  opts.Dialects,
+		open: func(l *listener, addr string, reopen bool) error {
+			if l.files != nil {
+				return nil
+			}
+			state, err := loadFileState(opts.StateFile)
+			if err != nil {
+				return err
+			}
+			l.files = &fileTailer{l: l, opts: opts, files: map[string]*tailedFile{}, state: state, saved: time.Now()}
+			return nil
+		},
+	}
+	return s.addListener(l)
+}
+
+// goTailFiles polls the files of l until it stops
+func (s *Server) goTailFiles(l *listener) {
+	t, done := l.files, l.done
+	interval := t.opts.PollInterval
+	if interval <= 0 {
+		interval = defaultFilePollInterval
+	}
+
+	s.spawn(l, func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		defer t.close(s)
+
+		for {
+			t.poll(s)
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	})
+}
+
+// poll delivers the lines written since the last poll
+func (t *fileTailer) poll(s *Server) {
+	matches := map[string]bool{}
+	for _, pattern := range t.opts.Paths {
+		paths, err := filepath.Glob(pattern)
+		if err != nil {
+			s.report(fmt.Errorf("%s: %w", pattern, err))
+			continue
+		}
+		for _, path := range paths {
+			matches[path] = true
+		}
+	}
+
+	paths := make([]string, 0, len(matches))
+	infos := make(map[string]os.FileInfo, len(matches))
+	for path := range matches {
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		paths = append(paths, path)
+		infos[path] = info
+	}
+	sort.Strings(paths)
+
+	t.rotate(s, paths, infos)
+
+	for _, path := range paths {
+		info := infos[path]
+		tf, ok := t.files[path]
+		fromBeginning := t.started || t.opts.FromBeginning
+
+		if !ok {
+			var err error
+			if tf, err = t.open(path, info, fromBeginning); err != nil {
+				s.report(fmt.Errorf("%s: %w", path, err))
+				continue
+			}
+		} else if tf.truncated(info.Size()) {
+			// Truncated, read it again
+			if _, err := tf.file.Seek(0, io.SeekStart); err != nil {
+				s.report(fmt.Errorf("%s: %w", path, err))
+				continue
+			}
+			tf.pos, tf.offset, tf.partial, tf.skipping, tf.head = 0, 0, nil, false, nil
+			t.dirty, t.flush = true, true
+		}
+		tf.info = info
+		t.read(s, tf)
+	}
+	t.started = true
+
+	interval := t.opts.StateInterval
+	if interval <= 0 {
+		interval = defaultFileStateInterval
+	}
+	if t.dirty && (t.flush || time.Since(t.saved) >= interval) {
+		t.save(s)
+	}
+}
+
+// rotate follows the files which are no longer at their path: to their new
+// one if it matches, so their lines are not read again from the offset of the
+// state, or to their end before forgetting them
+func (t *fileTailer) rotate(s *Server, paths []string, infos map[string]os.FileInfo) {
+	var moved []*tailedFile
+	for path, tf := range t.files {
+		if info, ok := infos[path]; !ok || !os.SameFile(tf.info, info) {
+			delete(t.files, path)
+			moved = append(moved, tf)
+		}
+	}
+
+	for _, tf := range moved {
+		renamed := ""
+		for _, path := range paths {
+			if _, taken := t.files[path]; !taken && os.SameFile(tf.info, infos[path]) {
+				renamed = path
+				break
+			}
+		}
+		if renamed == "" {
+			// Gone, or renamed out of the paths, finish it
+			t.read(s, tf)
+			t.forget(tf)
+			continue
+		}
+		// The rest of the old file comes first
+		t.read(s, tf)
+		tf.path = renamed
+		t.files[renamed] = tf
+		t.dirty, t.flush = true, true
+	}
+}
+
+// open starts following path, from the offset of the state file if it has
+// one for this file
+func (t *fileTailer) open(path string, info os.FileInfo, fromBeginning bool) (*tailedFile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	offset := info.Size()
+	if fromBeginning {
+		offset = 0
+	}
+	if state, ok := t.lookup(path, info); ok {
+		offset = state.Offset
+	} else if _, ok := t.state[path]; ok {
+		// Another file was there, this one came after a rotation
+		offset = 0
+	}
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	tf := &tailedFile{path: path, file: file, info: info, pos: offset, offset: offset}
+	t.files[path] = tf
+	t.dirty = true
+	return tf, nil
+}
+
+// lookup returns the state of the file, which may have been renamed since
+func (t *fileTailer) lookup(path string, info os.FileInfo) (fileState, bool) {
+	device, inode := fileID(info)
+	if state, ok := t.state[path]; ok && state.Device == device && state.Inode == inode && state.Offset <= info.Size() {
+		return state, true
+	}
+	if inode == 0 {
+		return fileState{}, false
+	}
+	for _, state := range t.state {
+		if state.Device == device && state.Inode == inode && state.Offset <= info.Size() {
+			return state, true
+		}
+	}
+	return fileState{}, false
+}
+
+// forget stops following tf, keeping the offset it was read up to until the
+// state is saved again
+func (t *fileTailer) forget(tf *tailedFile) {
+	tf.file.Close()
+	if t.files[tf.path] == tf {
+		delete(t.files, tf.path)
+	}
+	device, inode := fileID(tf.info)
+	t.state[tf.path] = fileState{Device: device, Inode: inode, Offset: tf.offset}
+	t.dirty, t.flush = true, true
+}
+
+// truncated tells if tf is shorter than what was read, or starts with other
+// bytes than it did
+func (tf *tailedFile) truncated(size int64) bool {
+	if size < tf.pos {
+		return true
+	}
+	head := make([]byte, len(tf.head))
+	if _, err := tf.file.ReadAt(head, 0); err != nil {
+		return true
+	}
+	return !bytes.Equal(head, tf.head)
+}
+
+// read delivers the complete lines of tf up to its end
+func (t *fileTailer) read(s *Server, tf *tailedFile) {
+	buf := make([]byte, fileReadBufferSize)
+	for {
+		n, err := tf.file.Read(buf)
+		if n > 0 {
+			tf.pos += int64(n)
+			t.lines(s, tf, buf[:n])
+		}
+		if err != nil {
+			if err != io.EOF {
+				s.report(fmt.Errorf("%s: %w", tf.path, err))
+			}
+			break
+		}
+	}
+
+	if len(tf.head) < fileHeadSize && tf.pos > int64(len(tf.head)) {
+		head := make([]byte, min(tf.pos, fileHeadSize))
+		if n, err := tf.file.ReadAt(head, 0); err == nil || err == io.EOF {
+			tf.head = head[:n]
+		}
+	}
+}
+
+// lines delivers the lines data completes. Lines longer than the read buffer
+// are cut down to its size, and delivered if the server delivers truncated
+// frames.
+func (t *fileTailer) lines(s *Server, tf *tailedFile, data []byte) {
+	sourceParts := format.LogParts{"source": tf.path}
+
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			if !tf.skipping {
+				tf.partial = append(tf.partial, data...)
+				if len(tf.partial) >= datagramReadBufferSize {
+					if s.deliverTruncated {
+						s.parser(t.l, tf.partial[:datagramReadBufferSize], "", "", format.LogParts{"source": tf.path, "truncated": true})
+					} else {
+						s.report(fmt.Errorf("%s: dropped a line longer than %d bytes", tf.path, datagramReadBufferSize))
+					}
+					tf.partial, tf.skipping = nil, true
+				}
+			}
+			break
+		}
+
+		line := data[:i]
+		data = data[i+1:]
+		if tf.skipping {
+			tf.skipping = false
+			continue
+		}
+		if len(tf.partial) > 0 {
+			line = append(tf.partial, line...)
+			tf.partial = nil
+		}
+		line = bytes.TrimRight(line, "\r")
+		if len(line) > 0 {
+			s.parser(t.l, line, "", "", sourceParts)
+		}
+	}
+
+	tf.offset = tf.pos - int64(len(tf.partial))
+	t.dirty = true
+}
+
+// close stops following the files, keeping their offsets so the listener
+// resumes from them
+func (t *fileTailer) close(s *Server) {
+	t.save(s)
+	for _, tf := range t.files {
+		tf.file.Close()
+	}
+	t.files = map[string]*tailedFile{}
+}
+
+// save records the offsets of the files followed, in the state file if any
+func (t *fileTailer) save(s *Server) {
+	state := make(map[string]fileState, len(t.files))
+	for path, tf := range t.files {
+		device, inode := fileID(tf.info)
+		state[path] = fileState{Device: device, Inode: inode, Offset: tf.offset}
+	}
+	t.state = state
+	t.dirty, t.flush = false, false
+	t.saved = time.Now()
+
+	if t.opts.StateFile == "" {
+		return
+	}
+	if err := writeFileState(t.opts.StateFile, state); err != nil {
+		s.report(fmt.Errorf("%s: %w", t.opts.StateFile, err))
+	}
+}
+
+func loadFileState(stateFile string) (map[string]fileState, error) {
+	state := map[string]fileState{}
+	if stateFile == "" {
+		return state, nil
+	}
+	data, err := os.ReadFile(stateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("%s: %w", stateFile, err)
+	}
+	return state, nil
+}
+
+// writeFileState replaces the state file at once, so a crash leaves either
+// the old or the new one
+func writeFileState(stateFile string, state map[string]fileState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := stateFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, stateFile)
+}
@@ -0,0 +1,217 @@
+package syslog
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/GLMONTER/go-syslog/format"
+	. "gopkg.in/check.v1"
+)
+
+func appendLines(c *C, path string, texts ...string) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	c.Assert(err, IsNil)
+	defer f.Close()
+	for _, text := range texts {
+		_, err = f.WriteString("<34>1 2003-10-11T22:14:15.003Z host app - - - " + text + "\n")
+		c.Assert(err, IsNil)
+	}
+}
+
+// messages returns the texts delivered since the last call
+func (h *handlerCollector) messages() []string {
+	var texts []string
+	for _, logParts := range h.logParts {
+		message := logParts["message"].(string)
+		texts = append(texts, message[strings.LastIndex(message, " ")+1:])
+	}
+	h.logParts = nil
+	return texts
+}
+
+func (s *ServerSuite) TestListenFiles(c *C) {
+	dir := c.MkDir()
+	path := filepath.Join(dir, "app.log")
+	stateFile := filepath.Join(dir, "state.json")
+	appendLines(c, path, "before")
+
+	handler := new(handlerCollector)
+	server := NewServer()
+	server.SetFormat(RFC5424)
+	server.SetHandler(handler)
+	c.Assert(server.ListenFiles(FileOptions{Paths: []string{filepath.Join(dir, "*.log")}, StateFile: stateFile}), IsNil)
+	tailer := server.entries[0].files
+
+	// Lines already there are skipped
+	tailer.poll(server)
+	c.Check(handler.messages(), HasLen, 0)
+
+	appendLines(c, path, "first", "second")
+	tailer.poll(server)
+	c.Check(handler.messages(), DeepEquals, []string{"first", "second"})
+	c.Check(handler.logParts, HasLen, 0)
+
+	// A partial line waits for its end
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	c.Assert(err, IsNil)
+	f.WriteString("<34>1 2003-10-11T22:14:15.003Z host app - - - par")
+	tailer.poll(server)
+	c.Check(handler.messages(), HasLen, 0)
+	f.WriteString("tial\n")
+	f.Close()
+
+	// Rotated by rename, the rest of the old file comes first
+	c.Assert(os.Rename(path, path+".1"), IsNil)
+	appendLines(c, path+".1", "late")
+	appendLines(c, path, "rotated")
+	tailer.poll(server)
+	c.Check(handler.messages(), DeepEquals, []string{"partial", "late", "rotated"})
+
+	// Truncated in place
+	c.Assert(os.Truncate(path, 0), IsNil)
+	appendLines(c, path, "truncated")
+	tailer.poll(server)
+	c.Check(handler.messages(), DeepEquals, []string{"truncated"})
+
+	data, err := os.ReadFile(stateFile)
+	c.Assert(err, IsNil)
+	var state map[string]fileState
+	c.Assert(json.Unmarshal(data, &state), IsNil)
+	info, err := os.Stat(path)
+	c.Assert(err, IsNil)
+	c.Check(state[path].Offset, Equals, info.Size())
+
+	// Another server resumes from the state file
+	appendLines(c, path, "offline")
+	handler = new(handlerCollector)
+	server = NewServer()
+	server.SetFormat(RFC5424)
+	server.SetHandler(handler)
+	c.Assert(server.ListenFiles(FileOptions{Paths: []string{path}, StateFile: stateFile}), IsNil)
+	server.entries[0].files.poll(server)
+	c.Check(handler.messages(), DeepEquals, []string{"offline"})
+}
+
+func (s *ServerSuite) TestListenFilesRotatedNameMatches(c *C) {
+	dir := c.MkDir()
+	path := filepath.Join(dir, "app.log")
+	appendLines(c, path, "before")
+
+	handler := new(handlerCollector)
+	server := NewServer()
+	server.SetFormat(RFC5424)
+	server.SetHandler(handler)
+	c.Assert(server.ListenFiles(FileOptions{Paths: []string{path + "*"}, StateFile: filepath.Join(dir, "state.json")}), IsNil)
+	tailer := server.entries[0].files
+
+	tailer.poll(server)
+	appendLines(c, path, "first")
+	tailer.poll(server)
+	c.Check(handler.messages(), DeepEquals, []string{"first"})
+
+	// The rotated file keeps being followed under its new name
+	appendLines(c, path, "late")
+	c.Assert(os.Rename(path, path+".1"), IsNil)
+	appendLines(c, path, "rotated")
+	tailer.poll(server)
+	c.Check(handler.messages(), DeepEquals, []string{"late", "rotated"})
+	c.Check(tailer.files, HasLen, 2)
+
+	appendLines(c, path+".1", "after")
+	tailer.poll(server)
+	c.Check(handler.messages(), DeepEquals, []string{"after"})
+	c.Check(handler.logParts, HasLen, 0)
+
+	// Rotated again, out of the paths
+	c.Assert(os.Rename(path+".1", filepath.Join(dir, "old")), IsNil)
+	c.Assert(os.Rename(path, path+".1"), IsNil)
+	appendLines(c, path, "newest")
+	tailer.poll(server)
+	c.Check(handler.messages(), DeepEquals, []string{"newest"})
+
+	server.Kill()
+	server.Wait()
+}
+
+func (s *ServerSuite) TestListenFilesBoot(c *C) {
+	dir := c.MkDir()
+	path := filepath.Join(dir, "app.log")
+	appendLines(c, path, "existing")
+
+	channel := make(LogPartsChannel, 10)
+	server := NewServer()
+	server.SetFormat(RFC5424)
+	server.SetHandler(NewChannelHandler(channel))
+	c.Assert(server.ListenFiles(FileOptions{Paths: []string{path}, FromBeginning: true, PollInterval: 10e6}), IsNil)
+	c.Assert(server.Boot(), IsNil)
+
+	logParts := receiveParts(c, channel)
+	c.Check(strings.HasSuffix(logParts["message"].(string), "existing"), Equals, true)
+	c.Check(logParts["source"], Equals, path)
+
+	c.Assert(server.RemoveListener(path), IsNil)
+	server.Kill()
+	server.Wait()
+}
+
+func (s *ServerSuite) TestListenFilesStateInterval(c *C) {
+	dir := c.MkDir()
+	path := filepath.Join(dir, "app.log")
+	stateFile := filepath.Join(dir, "state.json")
+	appendLines(c, path, "first")
+
+	handler := new(handlerCollector)
+	server := NewServer()
+	server.SetFormat(RFC5424)
+	server.SetHandler(handler)
+	c.Assert(server.ListenFiles(FileOptions{Paths: []string{path}, StateFile: stateFile, FromBeginning: true, StateInterval: time.Hour}), IsNil)
+	tailer := server.entries[0].files
+
+	// Not saved on every poll which reads lines
+	tailer.poll(server)
+	appendLines(c, path, "second")
+	tailer.poll(server)
+	c.Check(handler.messages(), DeepEquals, []string{"first", "second"})
+	_, err := os.Stat(stateFile)
+	c.Check(os.IsNotExist(err), Equals, true)
+
+	// But when the listener stops
+	tailer.close(server)
+	data, err := os.ReadFile(stateFile)
+	c.Assert(err, IsNil)
+	var state map[string]fileState
+	c.Assert(json.Unmarshal(data, &state), IsNil)
+	info, err := os.Stat(path)
+	c.Assert(err, IsNil)
+	c.Check(state[path].Offset, Equals, info.Size())
+}
+
+func (s *ServerSuite) TestListenFilesDialects(c *C) {
+	dir := c.MkDir()
+	path := filepath.Join(dir, "fw.log")
+	c.Assert(os.WriteFile(path, []byte(`<133>date=2024-01-31 time=13:36:54 eventtime=1706726214463347261 action="start"`+"\n"), 0o644), IsNil)
+
+	channel := make(LogPartsChannel, 10)
+	server := NewServer()
+	server.SetFormat(RFC3164)
+	server.SetHandler(NewChannelHandler(channel))
+	opts := FileOptions{Paths: []string{path}, FromBeginning: true, PollInterval: 10e6}
+	c.Assert(server.ListenFiles(opts), IsNil)
+	opts.Paths = []string{filepath.Join(dir, "*.log")}
+	opts.Dialects = &format.DialectSelection{Disable: []string{"fortios"}}
+	c.Assert(server.ListenFiles(opts), IsNil)
+	c.Assert(server.Boot(), IsNil)
+
+	// The line once with the FortiOS dialect, once without
+	var fields []interface{}
+	for i := 0; i < 2; i++ {
+		fields = append(fields, receiveParts(c, channel)["fields"])
+	}
+	c.Check(fields[0] == nil, Not(Equals), fields[1] == nil)
+
+	server.Kill()
+	server.Wait()
+}
@@ -5,7 +5,6 @@ import (
 	"bytes"
 	"strconv"
 
-	"github.com/GLMONTER/go-syslog/internal/syslogparser/rfc3164"
 	"github.com/GLMONTER/go-syslog/internal/syslogparser/rfc5424"
 )
 
@@ -21,7 +20,11 @@ import (
  * format, it would be best to select it explicitly.
  */
 
-type Automatic struct{}
+type Automatic struct {
+	// Dialects selects the vendor dialects tried on RFC3164 messages without
+	// a RFC3164 timestamp, all the registered ones by default
+	Dialects DialectSelection
+}
 
 const (
 	detectedUnknown = iota
@@ -65,7 +68,7 @@ func detect(data []byte) int {
 func (f *Automatic) GetParser(line []byte) LogParser {
 	switch format := detect(line); format {
 	case detectedRFC3164:
-		return &parserWrapper{rfc3164.NewParser(line)}
+		return &parserWrapper{f.Dialects.newRFC3164Parser(line)}
 	case detectedRFC5424:
 		return &parserWrapper{rfc5424.NewParser(line)}
 	default:
@@ -75,30 +78,18 @@ func (f *Automatic) GetParser(line []byte) LogParser {
 		// will return detectedRFC6587. The line may also simply be malformed after the length in
 		// which case we will have detectedUnknown. In this case we return the simplest parser so
 		// the illegally formatted line is properly handled
-		return &parserWrapper{rfc3164.NewParser(line)}
+		return &parserWrapper{f.Dialects.newRFC3164Parser(line)}
 	}
 }
 
 func (f *Automatic) GetSplitFunc() bufio.SplitFunc {
-	return f.automaticScannerSplit
+	return f.GetFramer(nil).Split
 }
 
-func (f *Automatic) automaticScannerSplit(data []byte, atEOF bool) (advance int, token []byte, err error) {
-	if atEOF && len(data) == 0 {
-		return 0, nil, nil
-	}
-
-	switch format := detect(data); format {
-	case detectedRFC6587:
-		return rfc6587ScannerSplit(data, atEOF)
-	case detectedRFC3164, detectedRFC5424:
-		// the default
-		return bufio.ScanLines(data, atEOF)
-	default:
-		if err != nil {
-			return 0, nil, err
-		}
-		// Request more data
-		return 0, nil, nil
-	}
+// GetFramer returns a Framer which splits octet counted frames, and takes
+// anything else up to the next LF as a non-transparent frame
+func (f *Automatic) GetFramer(report func(error)) *Framer {
+	framer := NewFramer(TrailerLF, 0, report)
+	framer.lenient = true
+	return framer
 }
@@ -0,0 +1,188 @@
+package format
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// cefSeverities maps the named CEF severities onto their numeric range, the
+// highest value of it standing for the name
+var cefSeverities = map[string]int{
+	"unknown":   -1,
+	"low":       3,
+	"medium":    6,
+	"high":      8,
+	"very-high": 10,
+}
+
+// parseCEF parses an ArcSight Common Event Format payload:
+//
+//	CEF:Version|Device Vendor|Device Product|Device Version|Signature ID|Name|Severity|Extension
+//
+// The header fields become "cef_version", "cef_device_vendor",
+// "cef_device_product", "cef_device_version", "cef_signature_id", "cef_name"
+// and "cef_severity", and the key=value pairs of the extension the
+// map[string]string "cef_extension". "cef_syslog_severity" maps the CEF
+// severity onto the syslog ones: 9 and 10 are critical, 7 and 8 error, 4 to 6
+// warning and 0 to 3 notice.
+func parseCEF(payload string) (LogParts, error) {
+	if !strings.HasPrefix(payload, "CEF:") {
+		return nil, errors.New("cef: missing CEF: prefix")
+	}
+	fields, extension, err := headerFields(payload[len("CEF:"):], 7)
+	if err != nil {
+		return nil, fmt.Errorf("cef: %w", err)
+	}
+
+	version, err := strconv.Atoi(strings.TrimSpace(fields[0]))
+	if err != nil {
+		return nil, fmt.Errorf("cef: invalid version %q", fields[0])
+	}
+	pairs, err := cefExtension(strings.TrimRight(extension, " \r\n"))
+	if err != nil {
+		return nil, err
+	}
+
+	parts := LogParts{
+		"cef_version":        version,
+		"cef_device_vendor":  fields[1],
+		"cef_device_product": fields[2],
+		"cef_device_version": fields[3],
+		"cef_signature_id":   fields[4],
+		"cef_name":           fields[5],
+		"cef_severity":       fields[6],
+		"cef_extension":      pairs,
+	}
+	if severity, ok := cefSyslogSeverity(fields[6]); ok {
+		parts["cef_syslog_severity"] = severity
+	}
+	return parts, nil
+}
+
+// headerFields splits n | separated header fields off the rest of s,
+// undoing the \| and \\ escapes of the fields
+func headerFields(s string, n int) (fields []string, rest string, err error) {
+	var field strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\' && i+1 < len(s) && (s[i+1] == '|' || s[i+1] == '\\'):
+			field.WriteByte(s[i+1])
+			i++
+		case c == '|':
+			fields = append(fields, field.String())
+			field.Reset()
+			if len(fields) == n {
+				return fields, s[i+1:], nil
+			}
+		default:
+			field.WriteByte(c)
+		}
+	}
+	return nil, "", fmt.Errorf("header has %d fields out of %d", len(fields), n)
+}
+
+// cefExtension parses space separated key=value pairs whose values may hold
+// spaces: a pair ends where a space followed by a key and an unescaped = starts
+// the next one
+func cefExtension(s string) (map[string]string, error) {
+	pairs := map[string]string{}
+	if strings.TrimSpace(s) == "" {
+		return pairs, nil
+	}
+
+	type keyAt struct{ start, eq int }
+	var keys []keyAt
+	for i := 0; i < len(s); i++ {
+		if s[i] != '=' || cefEscaped(s, i) {
+			continue
+		}
+		start := i
+		for start > 0 && cefKeyChar(s[start-1]) {
+			start--
+		}
+		if start < i && (start == 0 || s[start-1] == ' ') {
+			keys = append(keys, keyAt{start, i})
+		}
+	}
+	if len(keys) == 0 || strings.TrimSpace(s[:keys[0].start]) != "" {
+		return nil, errors.New("cef: extension does not start with a key")
+	}
+
+	for n, key := range keys {
+		end := len(s)
+		if n+1 < len(keys) {
+			end = keys[n+1].start - 1
+		}
+		pairs[s[key.start:key.eq]] = cefUnescapeValue(s[key.eq+1 : end])
+	}
+	return pairs, nil
+}
+
+// cefEscaped tells if the byte at i follows an odd number of backslashes
+func cefEscaped(s string, i int) bool {
+	n := 0
+	for j := i - 1; j >= 0 && s[j] == '\\'; j-- {
+		n++
+	}
+	return n%2 == 1
+}
+
+func cefKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '_' || c == '.' || c == '-' || c == '[' || c == ']'
+}
+
+// cefUnescapeValue undoes the \=, \\, \n and \r escapes of extension values,
+// keeping other backslashes as they are
+func cefUnescapeValue(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			switch s[i+1] {
+			case '=', '\\', '|':
+				b.WriteByte(s[i+1])
+				i++
+				continue
+			case 'n':
+				b.WriteByte('\n')
+				i++
+				continue
+			case 'r':
+				b.WriteByte('\r')
+				i++
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// cefSyslogSeverity maps a CEF severity, 0 to 10 or its name, onto a syslog
+// severity
+func cefSyslogSeverity(severity string) (int, bool) {
+	level, err := strconv.Atoi(strings.TrimSpace(severity))
+	if err != nil {
+		var ok bool
+		if level, ok = cefSeverities[strings.ToLower(strings.TrimSpace(severity))]; !ok {
+			return 0, false
+		}
+	}
+	switch {
+	case level < 0 || level > 10:
+		return 0, false
+	case level >= 9:
+		return 2, true
+	case level >= 7:
+		return 3, true
+	case level >= 4:
+		return 4, true
+	default:
+		return 5, true
+	}
+}
@@ -0,0 +1,61 @@
+package format
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+func (s *FormatSuite) TestCEF_RFC3164(c *C) {
+	line := `<134>Oct 11 22:14:15 fw01 CEF:0|Security|threat\|manager|1.0|100|worm successfully stopped|10|src=10.0.0.1 dst=2.1.2.2 spt=1232 msg=Detected a threat. No action needed cs1Label=path\=C:\\temp cs1=a\nb`
+	p := (&RFC3164{}).GetParser([]byte(line))
+	c.Assert(p.Parse(), IsNil)
+	parts := p.Dump()
+
+	c.Check(parts["severity"], Equals, 6)
+	c.Check(parts["cef_version"], Equals, 0)
+	c.Check(parts["cef_device_vendor"], Equals, "Security")
+	c.Check(parts["cef_device_product"], Equals, "threat|manager")
+	c.Check(parts["cef_device_version"], Equals, "1.0")
+	c.Check(parts["cef_signature_id"], Equals, "100")
+	c.Check(parts["cef_name"], Equals, "worm successfully stopped")
+	c.Check(parts["cef_severity"], Equals, "10")
+	c.Check(parts["cef_syslog_severity"], Equals, 2)
+	c.Check(parts["cef_extension"], DeepEquals, map[string]string{
+		"src":      "10.0.0.1",
+		"dst":      "2.1.2.2",
+		"spt":      "1232",
+		"msg":      "Detected a threat. No action needed",
+		"cs1Label": `path=C:\temp`,
+		"cs1":      "a\nb",
+	})
+}
+
+func (s *FormatSuite) TestCEF_RFC5424(c *C) {
+	line := `<165>1 2003-10-11T22:14:15.003Z host app - - - CEF:1|Vendor|Product|2|login|User login|Medium|suser=bob`
+	p := (&RFC5424{}).GetParser([]byte(line))
+	c.Assert(p.Parse(), IsNil)
+	parts := p.Dump()
+
+	c.Check(parts["cef_version"], Equals, 1)
+	c.Check(parts["cef_severity"], Equals, "Medium")
+	c.Check(parts["cef_syslog_severity"], Equals, 4)
+	c.Check(parts["cef_extension"], DeepEquals, map[string]string{"suser": "bob"})
+}
+
+func (s *FormatSuite) TestCEF_Malformed(c *C) {
+	for _, line := range []string{
+		`<134>Oct 11 22:14:15 fw01 CEF:0|Vendor|Product|1.0|100`,
+		`<134>Oct 11 22:14:15 fw01 CEF:x|Vendor|Product|1.0|100|Name|5|`,
+		`<134>Oct 11 22:14:15 fw01 CEF:0|Vendor|Product|1.0|100|Name|5|no key here`,
+		`<134>Oct 11 22:14:15 fw01 NOTCEF:0|Vendor|Product|1.0|100|Name|5|`,
+	} {
+		p := (&RFC3164{}).GetParser([]byte(line))
+		c.Assert(p.Parse(), IsNil)
+		c.Check(p.Dump()["cef_version"], IsNil, Commentf("%s", line))
+		c.Check(p.Dump()["content"], Equals, line)
+	}
+
+	p := (&RFC3164{}).GetParser([]byte(`<134>Oct 11 22:14:15 fw01 CEF:0|V|P|1|2|N|Unknown|`))
+	c.Assert(p.Parse(), IsNil)
+	c.Check(p.Dump()["cef_extension"], DeepEquals, map[string]string{})
+	c.Check(p.Dump()["cef_syslog_severity"], IsNil)
+}
@@ -0,0 +1,79 @@
+package format
+
+import (
+	"time"
+
+	"github.com/GLMONTER/go-syslog/internal/syslogparser/rfc3164"
+)
+
+// Dialect parses the messages of devices which do not follow RFC3164. The
+// RFC3164 and Automatic formats try the dialects, highest Priority first, on
+// messages without a RFC3164 timestamp, and the first one detecting the
+// message parses it. Messages whose hostname does not parse are not theirs.
+// The built-in dialects are "cisco-ios", of priority 450, "cisco-asa", 400,
+// "sonicwall", 300, "fortios", 200, and "cisco-asa-rfc5424", 100. "cisco-ios"
+// claims its messages.
+type Dialect struct {
+	// Name identifies the dialect in a DialectSelection
+	Name     string
+	Priority int
+	// Claim has the dialect tried before the RFC3164 header too, for
+	// messages the header would parse. The header is parsed if Parse fails.
+	Claim bool
+	// Detect tells if line, priority included, is of the dialect
+	Detect func(line []byte) bool
+	// Parse returns the parts of line. "timestamp", a time.Time, and
+	// "hostname", "tag" and "content", strings, replace the ones of RFC3164,
+	// which default to the current time, no hostname, no tag and the whole
+	// line. The other parts are added to them.
+	Parse func(line []byte, location *time.Location) (LogParts, error)
+}
+
+// RegisterDialect adds d to the dialects tried by the RFC3164 and Automatic
+// formats. Its name must not be taken.
+func RegisterDialect(d Dialect) error {
+	dialect := rfc3164.Dialect{Name: d.Name, Priority: d.Priority, Claim: d.Claim, Detect: d.Detect}
+	if parse := d.Parse; parse != nil {
+		dialect.Parse = func(buff []byte, location *time.Location) (map[string]interface{}, error) {
+			return parse(buff, location)
+		}
+	}
+	return rfc3164.RegisterDialect(dialect)
+}
+
+// RegisteredDialects returns the names of the registered dialects, in the
+// order they are tried
+func RegisteredDialects() []string {
+	var names []string
+	for _, d := range rfc3164.Dialects(nil, nil) {
+		names = append(names, d.Name)
+	}
+	return names
+}
+
+// DialectSelection selects the dialects a format tries. Listeners which need
+// other dialects than the server format take their own selection in the
+// ListenerOptions of AddListenerWithOptions.
+type DialectSelection struct {
+	// Enable lists the only dialects tried, all the registered ones if empty
+	Enable []string
+	// Disable lists the dialects not tried
+	Disable []string
+}
+
+// dialects returns the dialects selected, nil if all the registered ones
+func (s DialectSelection) dialects() []rfc3164.Dialect {
+	if len(s.Enable) == 0 && len(s.Disable) == 0 {
+		return nil
+	}
+	return rfc3164.Dialects(s.Enable, s.Disable)
+}
+
+// newRFC3164Parser returns an RFC3164 parser trying the dialects of s
+func (s DialectSelection) newRFC3164Parser(line []byte) *rfc3164.Parser {
+	parser := rfc3164.NewParser(line)
+	if dialects := s.dialects(); dialects != nil {
+		parser.Dialects(dialects)
+	}
+	return parser
+}
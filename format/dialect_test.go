@@ -0,0 +1,65 @@
+package format
+
+import (
+	"bytes"
+	"strings"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+// testDialect parses <13>DEV|host|message lines
+var testDialect = Dialect{
+	Name:     "test-device",
+	Priority: 500,
+	Detect: func(line []byte) bool {
+		return bytes.Contains(line, []byte(">DEV|"))
+	},
+	Parse: func(line []byte, location *time.Location) (LogParts, error) {
+		fields := strings.Split(string(line), "|")
+		return LogParts{
+			"timestamp": time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+			"hostname":  fields[1],
+			"content":   fields[2],
+			"device":    "test",
+		}, nil
+	},
+}
+
+var errTestDialect = RegisterDialect(testDialect)
+
+func (s *FormatSuite) TestDialect_Register(c *C) {
+	c.Assert(errTestDialect, IsNil)
+	c.Check(RegisterDialect(testDialect), ErrorMatches, "dialect test-device already registered")
+	c.Check(RegisterDialect(Dialect{Name: "incomplete"}), NotNil)
+	c.Check(RegisteredDialects(), DeepEquals, []string{"test-device", "cisco-ios", "cisco-asa", "sonicwall", "fortios", "cisco-asa-rfc5424"})
+
+	p := (&RFC3164{}).GetParser([]byte("<13>DEV|router1|link down"))
+	c.Assert(p.Parse(), IsNil)
+	parts := p.Dump()
+	c.Check(parts["hostname"], Equals, "router1")
+	c.Check(parts["content"], Equals, "link down")
+	c.Check(parts["tag"], Equals, "")
+	c.Check(parts["severity"], Equals, 5)
+	c.Check(parts["device"], Equals, "test")
+	c.Check(parts["timestamp"], Equals, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+}
+
+func (s *FormatSuite) TestDialect_Selection(c *C) {
+	fortiOS := []byte(`<133>date=2024-01-31 time=13:36:54 eventtime=1706726214463347261 action="start"`)
+
+	p := (&Automatic{}).GetParser(fortiOS)
+	c.Assert(p.Parse(), IsNil)
+	c.Check(p.Dump()["fields"], NotNil)
+
+	p = (&RFC3164{Dialects: DialectSelection{Disable: []string{"fortios"}}}).GetParser(fortiOS)
+	c.Check(p.Parse(), NotNil)
+	c.Check(p.Dump()["fields"], IsNil)
+
+	p = (&RFC3164{Dialects: DialectSelection{Enable: []string{"test-device"}}}).GetParser(fortiOS)
+	c.Check(p.Parse(), NotNil)
+
+	p = (&RFC3164{Dialects: DialectSelection{Enable: []string{"test-device"}}}).GetParser([]byte("<13>DEV|router1|link down"))
+	c.Assert(p.Parse(), IsNil)
+	c.Check(p.Dump()["hostname"], Equals, "router1")
+}
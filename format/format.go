@@ -2,6 +2,9 @@ package format
 
 import (
 	"bufio"
+	"math"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/GLMONTER/go-syslog/internal/syslogparser"
@@ -20,10 +23,48 @@ type Format interface {
 	GetSplitFunc() bufio.SplitFunc
 }
 
+// FramingFormat is implemented by formats which split streams with a Framer.
+// Unlike the plain split function, the Framer recovers from framing errors,
+// passing each of them to report, and can be tuned per stream.
+type FramingFormat interface {
+	GetFramer(report func(error)) *Framer
+}
+
 type parserWrapper struct {
 	syslogparser.LogParser
 }
 
+// Dump returns the parts of the message, along with the fields of its
+// payload if it is a structured one
 func (w *parserWrapper) Dump() LogParts {
-	return LogParts(w.LogParser.Dump())
+	parts := LogParts(w.LogParser.Dump())
+	decodePayload(parts)
+	return parts
+}
+
+// EpochTime converts seconds since the epoch, with an optional decimal
+// fraction or in exponent notation, as GELF and the Splunk HEC send them
+func EpochTime(value string) (time.Time, error) {
+	sec, frac, _ := strings.Cut(value, ".")
+	seconds, err := strconv.ParseInt(sec, 10, 64)
+	if err != nil || strings.ContainsAny(frac, "eE") {
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		sec, frac := math.Modf(f)
+		return time.Unix(int64(sec), int64(frac*1e9)).UTC(), nil
+	}
+
+	var nanos int64
+	if frac != "" {
+		frac = (frac + "000000000")[:9]
+		if nanos, err = strconv.ParseInt(frac, 10, 64); err != nil {
+			return time.Time{}, err
+		}
+		if strings.HasPrefix(sec, "-") {
+			nanos = -nanos
+		}
+	}
+	return time.Unix(seconds, nanos).UTC(), nil
 }
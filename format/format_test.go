@@ -2,6 +2,7 @@ package format
 
 import (
 	"testing"
+	"time"
 
 	. "gopkg.in/check.v1"
 )
@@ -11,3 +12,21 @@ func Test(t *testing.T) { TestingT(t) }
 type FormatSuite struct{}
 
 var _ = Suite(&FormatSuite{})
+
+func (s *FormatSuite) TestEpochTime(c *C) {
+	for value, expected := range map[string]time.Time{
+		"1385053862":        time.Unix(1385053862, 0),
+		"1385053862.3072":   time.Unix(1385053862, 307200000),
+		"-1.5":              time.Unix(-1, -500000000),
+		"1.385053862e9":     time.Unix(1385053862, 0),
+		".5":                time.Unix(0, 500000000),
+		"1426279439.123456": time.Unix(1426279439, 123456000),
+	} {
+		t, err := EpochTime(value)
+		c.Check(err, IsNil)
+		c.Check(t, Equals, expected.UTC(), Commentf("%s", value))
+	}
+
+	_, err := EpochTime("soon")
+	c.Check(err, NotNil)
+}
@@ -0,0 +1,338 @@
+package format
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Trailer selects the byte sequence which terminates a non-transparent frame
+// (RFC6587 section 3.4.2)
+type Trailer int
+
+const (
+	TrailerLF   Trailer = iota // "\n", a trailing "\r" is dropped from the frame
+	TrailerNUL                 // "\x00"
+	TrailerCRLF                // "\r\n"
+)
+
+// maxOctetCountDigits bounds the MSG-LEN field of an octet counted frame,
+// anything longer can not be a sane frame length
+const maxOctetCountDigits = 9
+
+func (t Trailer) bytes() []byte {
+	switch t {
+	case TrailerNUL:
+		return []byte{0}
+	case TrailerCRLF:
+		return []byte("\r\n")
+	default:
+		return []byte("\n")
+	}
+}
+
+// A FramingError describes a framing problem the Framer recovered from. The
+// Discarded bytes were dropped from the stream to get back in sync.
+type FramingError struct {
+	Reason    string
+	Discarded int
+}
+
+func (e *FramingError) Error() string {
+	return fmt.Sprintf("framing error: %s (%d bytes discarded)", e.Reason, e.Discarded)
+}
+
+// Framer splits a stream which mixes octet counted (RFC6587 section 3.4.1)
+// and non-transparent (RFC6587 section 3.4.2) frames. Instead of failing, it
+// skips over garbage and oversized frames and reports them as FramingError.
+//
+// A Framer keeps state between calls, so use one per stream.
+type Framer struct {
+	trailer        []byte
+	stripCR        bool
+	maxFrameLength int
+	report         func(error)
+	// frames which are neither octet counted nor start with a priority are
+	// taken as non-transparent frames instead of garbage
+	lenient bool
+	// deliver over long and unfinished frames cut down instead of dropping them
+	truncate  bool
+	truncated bool
+
+	// bytes of an oversized octet counted frame still to be skipped
+	skip int
+	// skipping an oversized non-transparent frame up to its trailer
+	skipToTrailer bool
+	// skipping garbage up to something looking like a frame start
+	resync bool
+	// error being built while skipping, reported once back in sync
+	pending *FramingError
+}
+
+// NewFramer returns a Framer which terminates non-transparent frames on
+// trailer and drops frames longer than maxFrameLength bytes (0 means no
+// limit). Framing errors are passed to report, which may be nil.
+func NewFramer(trailer Trailer, maxFrameLength int, report func(error)) *Framer {
+	return &Framer{
+		trailer:        trailer.bytes(),
+		stripCR:        trailer == TrailerLF,
+		maxFrameLength: maxFrameLength,
+		report:         report,
+	}
+}
+
+// SetTruncate makes the Framer deliver frames longer than the maximum frame
+// length cut down to it, and frames left unfinished at the end of the stream
+// as they are, instead of dropping them. Truncated tells these apart.
+func (f *Framer) SetTruncate(truncate bool) {
+	f.truncate = truncate
+}
+
+// Truncated reports whether the last frame returned by Split was cut short
+func (f *Framer) Truncated() bool {
+	return f.truncated
+}
+
+// FitBuffer lowers the maximum frame length so that any accepted frame, along
+// with its octet count, fits a scan buffer of size bytes
+func (f *Framer) FitBuffer(size int) {
+	limit := size - maxOctetCountDigits - 1
+	if f.maxFrameLength == 0 || f.maxFrameLength > limit {
+		f.maxFrameLength = limit
+	}
+}
+
+// Split is a bufio.SplitFunc. Skipped bytes are consumed in the same call as
+// the next frame, as bufio.Scanner stops at EOF on the first call which does
+// not return a token.
+func (f *Framer) Split(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	f.truncated = false
+	for {
+		n, token, err := f.split(data[advance:], atEOF)
+		advance += n
+		if token != nil || err != nil || n == 0 {
+			return advance, token, err
+		}
+	}
+}
+
+func (f *Framer) split(data []byte, atEOF bool) (int, []byte, error) {
+	if f.skip > 0 {
+		n := min(f.skip, len(data))
+		f.skip -= n
+		if atEOF {
+			f.skip = 0
+		}
+		return n, nil, nil
+	}
+
+	if f.skipToTrailer {
+		return f.splitSkipToTrailer(data, atEOF)
+	}
+
+	if len(data) == 0 {
+		if atEOF {
+			f.flush()
+		}
+		return 0, nil, nil
+	}
+
+	if f.resync && data[0] != '<' {
+		return f.splitResync(data, atEOF, 0)
+	}
+	f.flush()
+
+	switch c := data[0]; {
+	case c == '\n' || c == '\r' || c == 0:
+		// Padding between frames, or what is left of a longer trailer
+		return 1, nil, nil
+	case c >= '1' && c <= '9':
+		return f.splitOctetCounted(data, atEOF)
+	case c == '<', f.lenient:
+		return f.splitNonTransparent(data, atEOF)
+	default:
+		f.startResync("frame does not start with a length or a priority")
+		return f.splitResync(data, atEOF, 1)
+	}
+}
+
+func (f *Framer) splitOctetCounted(data []byte, atEOF bool) (int, []byte, error) {
+	length := 0
+	for i, c := range data {
+		if c == ' ' {
+			start, end := i+1, i+1+length
+			if f.maxFrameLength > 0 && length > f.maxFrameLength {
+				return f.splitOversized(data, atEOF, start, end)
+			}
+			if len(data) >= end {
+				// Return the frame with the length removed
+				return end, data[start:end], nil
+			}
+			if atEOF {
+				if f.truncate && len(data) > start {
+					f.truncated = true
+					return len(data), data[start:], nil
+				}
+				f.fail("stream ended inside an octet counted frame", len(data))
+				return len(data), nil, nil
+			}
+			// Request more data
+			return 0, nil, nil
+		}
+		if c < '0' || c > '9' || i >= maxOctetCountDigits {
+			if f.lenient {
+				return f.splitNonTransparent(data, atEOF)
+			}
+			f.startResync("invalid octet count")
+			return f.splitResync(data, atEOF, 1)
+		}
+		length = length*10 + int(c-'0')
+	}
+
+	if atEOF {
+		if f.lenient {
+			return f.splitNonTransparent(data, atEOF)
+		}
+		f.fail("stream ended inside an octet count", len(data))
+		return len(data), nil, nil
+	}
+
+	// Request more data
+	return 0, nil, nil
+}
+
+// splitOversized drops, or cuts down, the octet counted frame found between
+// start and end
+func (f *Framer) splitOversized(data []byte, atEOF bool, start int, end int) (int, []byte, error) {
+	reason := fmt.Sprintf("frame length %d exceeds maximum of %d", end-start, f.maxFrameLength)
+
+	if !f.truncate {
+		f.fail(reason, end)
+		n := min(end, len(data))
+		if !atEOF {
+			f.skip = end - n
+		}
+		return n, nil, nil
+	}
+
+	cut := start + f.maxFrameLength
+	if len(data) < cut && !atEOF {
+		// Request more data
+		return 0, nil, nil
+	}
+	cut = min(cut, len(data))
+	f.fail(reason, end-cut)
+	if !atEOF {
+		f.skip = end - cut
+	}
+	f.truncated = true
+	return cut, data[start:cut], nil
+}
+
+func (f *Framer) splitNonTransparent(data []byte, atEOF bool) (int, []byte, error) {
+	i := bytes.Index(data, f.trailer)
+
+	if f.maxFrameLength > 0 && (i > f.maxFrameLength || (i < 0 && len(data) > f.maxFrameLength)) {
+		f.skipToTrailer = true
+		f.pending = &FramingError{Reason: fmt.Sprintf("frame exceeds maximum length of %d", f.maxFrameLength)}
+		if f.truncate {
+			f.truncated = true
+			return f.maxFrameLength, data[:f.maxFrameLength], nil
+		}
+		return f.splitSkipToTrailer(data, atEOF)
+	}
+
+	if i >= 0 {
+		return i + len(f.trailer), f.trimFrame(data[:i]), nil
+	}
+
+	if atEOF {
+		// The final frame is allowed to omit its trailer
+		frame := f.trimFrame(data)
+		f.truncated = f.truncate && frame != nil
+		return len(data), frame, nil
+	}
+
+	// Request more data
+	return 0, nil, nil
+}
+
+func (f *Framer) splitSkipToTrailer(data []byte, atEOF bool) (int, []byte, error) {
+	n := len(data)
+	if i := bytes.Index(data, f.trailer); i >= 0 {
+		n = i + len(f.trailer)
+		f.skipToTrailer = false
+	} else if atEOF {
+		f.skipToTrailer = false
+	} else {
+		// Keep a possibly partial trailer for the next call
+		n = max(n-len(f.trailer)+1, 0)
+	}
+
+	f.pending.Discarded += n
+	if !f.skipToTrailer {
+		f.flush()
+	}
+	return n, nil, nil
+}
+
+// trimFrame drops the CR of a CRLF terminated frame when splitting on LF.
+// Empty frames are returned as nil so that they are skipped.
+func (f *Framer) trimFrame(frame []byte) []byte {
+	if f.stripCR && len(frame) > 0 && frame[len(frame)-1] == '\r' {
+		frame = frame[:len(frame)-1]
+	}
+	if len(frame) == 0 {
+		return nil
+	}
+	return frame
+}
+
+// splitResync drops bytes up to the next trailer or priority start, which
+// are the only places a new frame can reliably be found
+func (f *Framer) splitResync(data []byte, atEOF bool, from int) (int, []byte, error) {
+	next := -1
+	if i := bytes.IndexByte(data[from:], '<'); i >= 0 {
+		next = from + i
+	}
+	if i := bytes.Index(data, f.trailer); i >= 0 && (next < 0 || i+len(f.trailer) < next) {
+		next = i + len(f.trailer)
+	}
+
+	n := next
+	if n < 0 {
+		n = len(data)
+		if !atEOF {
+			// Keep a possibly partial trailer for the next call
+			n = max(n-len(f.trailer)+1, 0)
+		}
+	}
+
+	f.pending.Discarded += n
+	if next >= 0 || atEOF {
+		f.resync = false
+		f.flush()
+	}
+	return n, nil, nil
+}
+
+func (f *Framer) startResync(reason string) {
+	f.resync = true
+	f.pending = &FramingError{Reason: reason}
+}
+
+// flush reports the error built while skipping, if any
+func (f *Framer) flush() {
+	f.resync = false
+	if f.pending != nil {
+		if f.report != nil {
+			f.report(f.pending)
+		}
+		f.pending = nil
+	}
+}
+
+func (f *Framer) fail(reason string, discarded int) {
+	if f.report != nil {
+		f.report(&FramingError{Reason: reason, Discarded: discarded})
+	}
+}
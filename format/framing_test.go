@@ -0,0 +1,126 @@
+package format
+
+import (
+	"bufio"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+func scanFrames(framer *Framer, input string) ([]string, error) {
+	scanner := bufio.NewScanner(strings.NewReader(input))
+	scanner.Split(framer.Split)
+
+	var frames []string
+	for scanner.Scan() {
+		frames = append(frames, scanner.Text())
+	}
+	return frames, scanner.Err()
+}
+
+func (s *FormatSuite) TestFramer_Trailers(c *C) {
+	tests := []struct {
+		trailer Trailer
+		input   string
+	}{
+		{TrailerLF, "<1>a\n<2>b\r\n<3>c"},
+		{TrailerNUL, "<1>a\x00<2>b\x00<3>c\x00"},
+		{TrailerCRLF, "<1>a\r\n<2>b\r\n\r\n<3>c\r\n"},
+	}
+
+	for _, test := range tests {
+		frames, err := scanFrames(NewFramer(test.trailer, 0, nil), test.input)
+		c.Assert(err, IsNil)
+		c.Assert(frames, DeepEquals, []string{"<1>a", "<2>b", "<3>c"}, Commentf("trailer %d", test.trailer))
+	}
+}
+
+func (s *FormatSuite) TestFramer_MaxFrameLength(c *C) {
+	var errs []error
+	framer := NewFramer(TrailerLF, 8, func(err error) { errs = append(errs, err) })
+
+	frames, err := scanFrames(framer, "<1>short\n12 <2>too long!<3>much too long\n3 <4>")
+	c.Assert(err, IsNil)
+	c.Assert(frames, DeepEquals, []string{"<1>short", "<4>"})
+	c.Assert(errs, DeepEquals, []error{
+		&FramingError{Reason: "frame length 12 exceeds maximum of 8", Discarded: 15},
+		&FramingError{Reason: "frame exceeds maximum length of 8", Discarded: 17},
+	})
+}
+
+func (s *FormatSuite) TestFramer_Resync(c *C) {
+	var errs []error
+	framer := NewFramer(TrailerLF, 0, func(err error) { errs = append(errs, err) })
+
+	frames, err := scanFrames(framer, "<1>a\n12x34 junk<2>b\n\x01\x02\n3 <3>garbage")
+	c.Assert(err, IsNil)
+	c.Assert(frames, DeepEquals, []string{"<1>a", "<2>b", "<3>"})
+	c.Assert(errs, DeepEquals, []error{
+		&FramingError{Reason: "invalid octet count", Discarded: 10},
+		&FramingError{Reason: "frame does not start with a length or a priority", Discarded: 3},
+		&FramingError{Reason: "frame does not start with a length or a priority", Discarded: 7},
+	})
+}
+
+func (s *FormatSuite) TestFramer_PaddingBetweenFrames(c *C) {
+	var errs []error
+	framer := NewFramer(TrailerLF, 0, func(err error) { errs = append(errs, err) })
+
+	frames, err := scanFrames(framer, "\n\n<1>a\n\n\r\n6 <2>b\r\n\x00\n4 <3>c\r\n<4>d\n")
+	c.Assert(err, IsNil)
+	c.Assert(frames, DeepEquals, []string{"<1>a", "<2>b\r\n", "<3>c", "<4>d"})
+	c.Assert(errs, IsNil)
+}
+
+func (s *FormatSuite) TestFramer_TruncatedOctetCountedFrame(c *C) {
+	var errs []error
+	framer := NewFramer(TrailerLF, 0, func(err error) { errs = append(errs, err) })
+
+	frames, err := scanFrames(framer, "4 <1>a10 <2>b")
+	c.Assert(err, IsNil)
+	c.Assert(frames, DeepEquals, []string{"<1>a"})
+	c.Assert(errs, DeepEquals, []error{
+		&FramingError{Reason: "stream ended inside an octet counted frame", Discarded: 7},
+	})
+}
+
+func (s *FormatSuite) TestFramer_Truncate(c *C) {
+	var errs []error
+	framer := NewFramer(TrailerLF, 4, func(err error) { errs = append(errs, err) })
+	framer.SetTruncate(true)
+
+	scanner := bufio.NewScanner(strings.NewReader("<1>a\n9 <2>bbbbbb<3>cccccc\n<4>d\n4 <5>"))
+	scanner.Split(framer.Split)
+
+	type frame struct {
+		text      string
+		truncated bool
+	}
+	var frames []frame
+	for scanner.Scan() {
+		frames = append(frames, frame{scanner.Text(), framer.Truncated()})
+	}
+
+	c.Assert(scanner.Err(), IsNil)
+	c.Assert(frames, DeepEquals, []frame{
+		{"<1>a", false},
+		{"<2>b", true},
+		{"<3>c", true},
+		{"<4>d", false},
+		{"<5>", true},
+	})
+	c.Assert(errs, DeepEquals, []error{
+		&FramingError{Reason: "frame length 9 exceeds maximum of 4", Discarded: 5},
+		&FramingError{Reason: "frame exceeds maximum length of 4", Discarded: 6},
+	})
+}
+
+func (s *FormatSuite) TestFramer_FitBuffer(c *C) {
+	framer := NewFramer(TrailerLF, 0, nil)
+	framer.FitBuffer(100)
+	c.Assert(framer.maxFrameLength, Equals, 90)
+
+	framer = NewFramer(TrailerLF, 50, nil)
+	framer.FitBuffer(100)
+	c.Assert(framer.maxFrameLength, Equals, 50)
+}
@@ -0,0 +1,337 @@
+package format
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	gelfChunkHeaderSize     = 12
+	gelfMaxChunks           = 128
+	defaultGelfChunkTimeout = 5 * time.Second
+	// defaultGelfMaxPendingMessages and defaultGelfMaxPendingBytes bound the
+	// chunked messages being reassembled
+	defaultGelfMaxPendingMessages = 1024
+	defaultGelfMaxPendingBytes    = 32 * 1024 * 1024
+	// gelfMaxMessageSize bounds decompressed messages
+	gelfMaxMessageSize = 8 * 1024 * 1024
+)
+
+var gelfChunkMagic = []byte{0x1e, 0x0f}
+
+// DatagramFormat is implemented by formats which may spread a message over
+// several datagrams
+type DatagramFormat interface {
+	// Reassemble takes a datagram received from client. It returns the
+	// message once complete, nil while parts of it are missing. The error
+	// reports datagrams which were dropped.
+	Reassemble(datagram []byte, client string) ([]byte, error)
+}
+
+// ReassemblingFormat is implemented by the DatagramFormats which keep the
+// messages being reassembled. Each server asks for a reassembler of its own
+// instead of sharing the state of the format value.
+type ReassemblingFormat interface {
+	DatagramFormat
+	NewReassembler() DatagramFormat
+}
+
+// GELF parses Graylog Extended Log Format messages: JSON objects, which may
+// be gzip or zlib compressed, sent as UDP datagrams, chunked if large, or
+// as NUL terminated TCP frames. Its fields are mapped onto the ones of the
+// syslog formats: host to "hostname", short_message to "message" and
+// "content", level to "severity" and timestamp to "timestamp". The other
+// fields, including the additional "_" ones, keep their name.
+//
+// Servers reassemble chunks with a reassembler of their own. Calling
+// Reassemble on the GELF value uses the one it holds, so it must not be
+// copied once in use.
+type GELF struct {
+	// ChunkTimeout drops a chunked message if it is not complete that long
+	// after its first chunk, 0 means 5 seconds
+	ChunkTimeout time.Duration
+	// MaxPendingMessages and MaxPendingBytes bound the chunked messages
+	// being reassembled, the oldest one being dropped to make room. 0 means
+	// 1024 messages and 32MiB of chunks.
+	MaxPendingMessages int
+	MaxPendingBytes    int
+
+	once        sync.Once
+	reassembler *gelfReassembler
+}
+
+func (f *GELF) GetParser(line []byte) LogParser {
+	return &gelfParser{buff: line}
+}
+
+// GetSplitFunc splits TCP streams on NUL
+func (f *GELF) GetSplitFunc() bufio.SplitFunc {
+	return scanNUL
+}
+
+func scanNUL(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	for {
+		if i := bytes.IndexByte(data[advance:], 0); i >= 0 {
+			frame := data[advance : advance+i]
+			advance += i + 1
+			if len(frame) > 0 {
+				return advance, frame, nil
+			}
+			continue
+		}
+		if atEOF && len(data) > advance {
+			return len(data), data[advance:], nil
+		}
+		return advance, nil, nil
+	}
+}
+
+// Reassemble returns unchunked datagrams as they are and collects chunks
+// until the message is complete
+func (f *GELF) Reassemble(datagram []byte, client string) ([]byte, error) {
+	f.once.Do(func() { f.reassembler = f.newReassembler() })
+	return f.reassembler.Reassemble(datagram, client)
+}
+
+// NewReassembler returns a reassembler of chunked messages with the limits of f
+func (f *GELF) NewReassembler() DatagramFormat {
+	return f.newReassembler()
+}
+
+func (f *GELF) newReassembler() *gelfReassembler {
+	r := &gelfReassembler{
+		timeout:     f.ChunkTimeout,
+		maxMessages: f.MaxPendingMessages,
+		maxBytes:    f.MaxPendingBytes,
+		pending:     make(map[string]*gelfChunks),
+	}
+	if r.timeout <= 0 {
+		r.timeout = defaultGelfChunkTimeout
+	}
+	if r.maxMessages <= 0 {
+		r.maxMessages = defaultGelfMaxPendingMessages
+	}
+	if r.maxBytes <= 0 {
+		r.maxBytes = defaultGelfMaxPendingBytes
+	}
+	return r
+}
+
+// gelfReassembler collects the chunks of the messages of its clients
+type gelfReassembler struct {
+	timeout     time.Duration
+	maxMessages int
+	maxBytes    int
+
+	mu      sync.Mutex
+	pending map[string]*gelfChunks
+	// bytes is the size of the chunks pending
+	bytes int
+}
+
+type gelfChunks struct {
+	first    time.Time
+	chunks   [][]byte
+	received int
+	bytes    int
+}
+
+func (r *gelfReassembler) Reassemble(datagram []byte, client string) ([]byte, error) {
+	now := time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Every datagram expires the messages left incomplete
+	dropped := r.expire(now)
+
+	if !bytes.HasPrefix(datagram, gelfChunkMagic) {
+		return datagram, dropped
+	}
+	if len(datagram) < gelfChunkHeaderSize {
+		return nil, errors.New("gelf: chunk header too short")
+	}
+
+	id := string(datagram[2:10])
+	seq, count := int(datagram[10]), int(datagram[11])
+	if count == 0 || count > gelfMaxChunks || seq >= count {
+		return nil, fmt.Errorf("gelf: invalid chunk %d of %d", seq, count)
+	}
+
+	key := client + "/" + id
+	message, ok := r.pending[key]
+	if !ok {
+		message = &gelfChunks{first: now, chunks: make([][]byte, count)}
+		r.pending[key] = message
+	}
+	if len(message.chunks) != count {
+		r.drop(key)
+		return nil, fmt.Errorf("gelf: chunk count of message %x changed from %d to %d", id, len(message.chunks), count)
+	}
+
+	if message.chunks[seq] == nil {
+		// The datagram buffer is reused once we return
+		message.chunks[seq] = append([]byte(nil), datagram[gelfChunkHeaderSize:]...)
+		message.received++
+		message.bytes += len(message.chunks[seq])
+		r.bytes += len(message.chunks[seq])
+	}
+	if message.received < count {
+		if evicted := r.evict(key); evicted > 0 {
+			err := fmt.Errorf("gelf: dropped %d incomplete chunked messages over the limit of %d messages or %d bytes", evicted, r.maxMessages, r.maxBytes)
+			return nil, errors.Join(dropped, err)
+		}
+		return nil, dropped
+	}
+
+	r.drop(key)
+	return bytes.Join(message.chunks, nil), dropped
+}
+
+// expire drops the messages not complete within the timeout. r.mu is held.
+func (r *gelfReassembler) expire(now time.Time) error {
+	dropped := 0
+	for key, message := range r.pending {
+		if now.Sub(message.first) > r.timeout {
+			r.drop(key)
+			dropped++
+		}
+	}
+	if dropped > 0 {
+		return fmt.Errorf("gelf: dropped %d incomplete chunked messages after %s", dropped, r.timeout)
+	}
+	return nil
+}
+
+// evict drops the oldest messages, but the one of key, until the pending
+// ones fit the limits, and returns how many it dropped. r.mu is held.
+func (r *gelfReassembler) evict(key string) int {
+	evicted := 0
+	for len(r.pending) > r.maxMessages || r.bytes > r.maxBytes {
+		oldest := ""
+		for k, message := range r.pending {
+			if k != key && (oldest == "" || message.first.Before(r.pending[oldest].first)) {
+				oldest = k
+			}
+		}
+		if oldest == "" {
+			// The message of key alone is over the limits
+			oldest = key
+		}
+		r.drop(oldest)
+		evicted++
+		if oldest == key {
+			break
+		}
+	}
+	return evicted
+}
+
+func (r *gelfReassembler) drop(key string) {
+	if message, ok := r.pending[key]; ok {
+		r.bytes -= message.bytes
+		delete(r.pending, key)
+	}
+}
+
+type gelfParser struct {
+	buff  []byte
+	parts LogParts
+}
+
+func (p *gelfParser) Location(*time.Location) {}
+
+func (p *gelfParser) Dump() LogParts {
+	return p.parts
+}
+
+func (p *gelfParser) Parse() error {
+	p.parts = LogParts{}
+
+	payload, err := gelfDecompress(p.buff)
+	if err != nil {
+		return err
+	}
+
+	var fields map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	if err := decoder.Decode(&fields); err != nil {
+		return fmt.Errorf("gelf: %w", err)
+	}
+
+	for name, value := range fields {
+		switch name {
+		case "host":
+			p.parts["hostname"] = value
+		case "short_message":
+			p.parts["message"] = value
+			p.parts["content"] = value
+		case "level":
+			if number, ok := value.(json.Number); ok {
+				if level, err := number.Int64(); err == nil {
+					p.parts["severity"] = int(level)
+				}
+			}
+		case "timestamp":
+			if number, ok := value.(json.Number); ok {
+				if ts, err := EpochTime(number.String()); err == nil {
+					p.parts["timestamp"] = ts
+				}
+			}
+		default:
+			if number, ok := value.(json.Number); ok {
+				value = gelfNumber(number)
+			}
+			p.parts[name] = value
+		}
+	}
+
+	if _, ok := p.parts["message"]; !ok {
+		return errors.New("gelf: short_message missing")
+	}
+	return nil
+}
+
+// gelfNumber returns integers as int64 and anything else as float64
+func gelfNumber(number json.Number) interface{} {
+	if i, err := number.Int64(); err == nil {
+		return i
+	}
+	f, _ := number.Float64()
+	return f
+}
+
+// gelfDecompress inflates gzip and zlib payloads, leaving plain JSON as is
+func gelfDecompress(payload []byte) ([]byte, error) {
+	var reader io.Reader
+	var err error
+	switch {
+	case len(payload) >= 2 && payload[0] == 0x1f && payload[1] == 0x8b:
+		reader, err = gzip.NewReader(bytes.NewReader(payload))
+	case len(payload) >= 2 && payload[0] == 0x78 && binary.BigEndian.Uint16(payload)%31 == 0:
+		reader, err = zlib.NewReader(bytes.NewReader(payload))
+	default:
+		return payload, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("gelf: %w", err)
+	}
+
+	inflated, err := io.ReadAll(io.LimitReader(reader, gelfMaxMessageSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("gelf: %w", err)
+	}
+	if len(inflated) > gelfMaxMessageSize {
+		return nil, fmt.Errorf("gelf: message exceeds %d bytes", gelfMaxMessageSize)
+	}
+	return inflated, nil
+}
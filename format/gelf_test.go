@@ -0,0 +1,145 @@
+package format
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"strings"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+const exampleGELF = `{"version":"1.1","host":"example.org","short_message":"A short message","full_message":"Backtrace here\n\nmore stuff","timestamp":1385053862.3072,"level":1,"_user_id":9001,"_some_info":"foo","_ratio":0.5}`
+
+func gzipped(c *C, data []byte) []byte {
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	_, err := w.Write(data)
+	c.Assert(err, IsNil)
+	c.Assert(w.Close(), IsNil)
+	return b.Bytes()
+}
+
+func zlibbed(c *C, data []byte) []byte {
+	var b bytes.Buffer
+	w := zlib.NewWriter(&b)
+	_, err := w.Write(data)
+	c.Assert(err, IsNil)
+	c.Assert(w.Close(), IsNil)
+	return b.Bytes()
+}
+
+// gelfChunk builds chunk seq of count of message id
+func gelfChunk(id string, seq int, count int, data []byte) []byte {
+	chunk := append([]byte{0x1e, 0x0f}, id...)
+	chunk = append(chunk, byte(seq), byte(count))
+	return append(chunk, data...)
+}
+
+func (s *FormatSuite) TestGELF_Parse(c *C) {
+	f := GELF{}
+	for _, payload := range [][]byte{[]byte(exampleGELF), gzipped(c, []byte(exampleGELF)), zlibbed(c, []byte(exampleGELF))} {
+		parser := f.GetParser(payload)
+		c.Assert(parser.Parse(), IsNil)
+		parts := parser.Dump()
+		c.Check(parts["hostname"], Equals, "example.org")
+		c.Check(parts["message"], Equals, "A short message")
+		c.Check(parts["content"], Equals, "A short message")
+		c.Check(parts["full_message"], Equals, "Backtrace here\n\nmore stuff")
+		c.Check(parts["severity"], Equals, 1)
+		c.Check(parts["timestamp"], Equals, time.Unix(1385053862, 307200000).UTC())
+		c.Check(parts["_user_id"], Equals, int64(9001))
+		c.Check(parts["_some_info"], Equals, "foo")
+		c.Check(parts["_ratio"], Equals, 0.5)
+	}
+
+	parser := f.GetParser([]byte(`{"version":"1.1","host":"example.org"}`))
+	c.Check(parser.Parse(), ErrorMatches, "gelf: short_message missing")
+	c.Check(parser.Dump()["hostname"], Equals, "example.org")
+
+	parser = f.GetParser([]byte(`<34>1 not json`))
+	c.Check(parser.Parse(), ErrorMatches, "gelf: .*")
+}
+
+func (s *FormatSuite) TestGELF_Split(c *C) {
+	f := GELF{}
+	scanner := bufio.NewScanner(strings.NewReader("{\"a\":1}\x00\x00{\"b\":2}\x00{\"c\":3}"))
+	scanner.Split(f.GetSplitFunc())
+
+	var frames []string
+	for scanner.Scan() {
+		frames = append(frames, scanner.Text())
+	}
+	c.Check(scanner.Err(), IsNil)
+	c.Check(frames, DeepEquals, []string{`{"a":1}`, `{"b":2}`, `{"c":3}`})
+}
+
+func (s *FormatSuite) TestGELF_Reassemble(c *C) {
+	f := GELF{}
+	payload := gzipped(c, []byte(exampleGELF))
+	third := len(payload) / 3
+
+	message, err := f.Reassemble(payload, "client")
+	c.Check(err, IsNil)
+	c.Check(message, DeepEquals, payload)
+
+	// Out of order, with a duplicate, interleaved with another client
+	chunks := [][]byte{payload[:third], payload[third : 2*third], payload[2*third:]}
+	for _, seq := range []int{2, 0, 0} {
+		message, err = f.Reassemble(gelfChunk("abcdefgh", seq, 3, chunks[seq]), "client")
+		c.Check(err, IsNil)
+		c.Check(message, IsNil)
+	}
+	message, err = f.Reassemble(gelfChunk("abcdefgh", 0, 3, chunks[0]), "other")
+	c.Check(message, IsNil)
+	message, err = f.Reassemble(gelfChunk("abcdefgh", 1, 3, chunks[1]), "client")
+	c.Check(err, IsNil)
+	c.Check(message, DeepEquals, payload)
+
+	_, err = f.Reassemble(gelfChunk("abcdefgh", 3, 3, nil), "client")
+	c.Check(err, ErrorMatches, "gelf: invalid chunk 3 of 3")
+	_, err = f.Reassemble(gelfChunk("abcdefgh", 0, 129, nil), "client")
+	c.Check(err, ErrorMatches, "gelf: invalid chunk 0 of 129")
+	_, err = f.Reassemble([]byte{0x1e, 0x0f, 1}, "client")
+	c.Check(err, ErrorMatches, "gelf: chunk header too short")
+}
+
+func (s *FormatSuite) TestGELF_ChunkTimeout(c *C) {
+	f := GELF{ChunkTimeout: 10 * time.Millisecond}
+	message, err := f.Reassemble(gelfChunk("12345678", 0, 2, []byte("{")), "client")
+	c.Check(err, IsNil)
+	c.Check(message, IsNil)
+
+	time.Sleep(20 * time.Millisecond)
+	message, err = f.Reassemble(gelfChunk("12345678", 1, 2, []byte("}")), "client")
+	c.Check(err, ErrorMatches, "gelf: dropped 1 incomplete chunked messages after 10ms")
+	c.Check(message, IsNil)
+}
+
+func (s *FormatSuite) TestGELF_PendingLimits(c *C) {
+	f := &GELF{MaxPendingMessages: 2, MaxPendingBytes: 10}
+	r := f.NewReassembler()
+
+	_, err := r.Reassemble(gelfChunk("aaaaaaaa", 0, 2, []byte("1234")), "client")
+	c.Check(err, IsNil)
+	_, err = r.Reassemble(gelfChunk("bbbbbbbb", 0, 2, []byte("1234")), "client")
+	c.Check(err, IsNil)
+	// A third message evicts the oldest one
+	_, err = r.Reassemble(gelfChunk("cccccccc", 0, 2, []byte("1")), "client")
+	c.Check(err, ErrorMatches, "gelf: dropped 1 incomplete chunked messages over the limit of 2 messages or 10 bytes")
+	message, err := r.Reassemble(gelfChunk("aaaaaaaa", 1, 2, []byte("5")), "client")
+	c.Check(err, ErrorMatches, "gelf: dropped 1 incomplete .*")
+	c.Check(message, IsNil)
+	message, err = r.Reassemble(gelfChunk("cccccccc", 1, 2, []byte("2")), "client")
+	c.Check(err, IsNil)
+	c.Check(message, DeepEquals, []byte("12"))
+
+	// Over the byte limit
+	_, err = r.Reassemble(gelfChunk("dddddddd", 0, 2, []byte("1234567890")), "client")
+	c.Check(err, ErrorMatches, "gelf: dropped 1 incomplete .*")
+
+	// The state is the reassembler's, not the format's
+	c.Check(f.reassembler, IsNil)
+}
@@ -0,0 +1,201 @@
+package format
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Journal parses systemd journal entries, in the export format, as written
+// by journalctl -o export and read with IngestReader, or sent with the native
+// protocol as unixgram datagrams, one entry each, to ListenUnixgram. Entries
+// passed in a memfd, when too large for a datagram, are not supported.
+//
+// Fields are NAME=value lines, or binary fields: the name, a newline, the
+// size as a little endian 64 bit integer, the value and a newline. They are
+// mapped onto the ones of the syslog formats: MESSAGE to "message" and
+// "content", PRIORITY to "severity", SYSLOG_FACILITY to "facility", along
+// with "priority" when both are set, SYSLOG_IDENTIFIER to "tag" and
+// "app_name", and _HOSTNAME to "hostname". "timestamp" is taken from
+// _SOURCE_REALTIME_TIMESTAMP or __REALTIME_TIMESTAMP. The other fields keep
+// their name, with a string value, or a []string one if the entry repeats
+// the field.
+type Journal struct{}
+
+func (f *Journal) GetParser(line []byte) LogParser {
+	return &journalParser{buff: line}
+}
+
+// GetSplitFunc splits export format streams on the empty line ending each
+// entry
+func (f *Journal) GetSplitFunc() bufio.SplitFunc {
+	return ScanJournalEntries
+}
+
+// Reassemble returns datagrams as they are, each native protocol datagram
+// being a whole entry whose binary fields must not be trimmed
+func (f *Journal) Reassemble(datagram []byte, client string) ([]byte, error) {
+	return datagram, nil
+}
+
+// ScanJournalEntries is a split function returning the entries of a journal
+// export stream, field by field so binary values may hold empty lines
+func ScanJournalEntries(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	// Empty lines before an entry
+	for advance < len(data) && data[advance] == '\n' {
+		advance++
+	}
+
+	start, end := advance, advance
+	for end < len(data) {
+		if data[end] == '\n' {
+			return end + 1, data[start:end], nil
+		}
+		_, _, n, err := journalField(data[end:], atEOF)
+		if err != nil {
+			return 0, nil, err
+		}
+		if n == 0 {
+			return start, nil, nil
+		}
+		end += n
+	}
+	if atEOF && end > start {
+		return end, data[start:end], nil
+	}
+	return start, nil, nil
+}
+
+// journalField reads the field data starts with, and returns its name, its
+// value and its length with the newline ending it. An empty line returns an
+// empty name. The length is 0 if the field is not complete before atEOF.
+func journalField(data []byte, atEOF bool) (name string, value []byte, n int, err error) {
+	i := bytes.IndexByte(data, '\n')
+	if i < 0 {
+		if !atEOF {
+			return "", nil, 0, nil
+		}
+		i = len(data)
+	}
+	if i == 0 {
+		return "", nil, 1, nil
+	}
+	line := data[:i]
+
+	if eq := bytes.IndexByte(line, '='); eq >= 0 {
+		if eq == 0 {
+			return "", nil, 0, errors.New("journal: field without a name")
+		}
+		return string(line[:eq]), line[eq+1:], min(i+1, len(data)), nil
+	}
+
+	// A binary field
+	name = string(line)
+	if len(data) < i+9 {
+		if !atEOF {
+			return "", nil, 0, nil
+		}
+		return "", nil, 0, fmt.Errorf("journal: field %s truncated", name)
+	}
+	size := binary.LittleEndian.Uint64(data[i+1:])
+	if size > uint64(len(data)-i-9) {
+		if !atEOF {
+			return "", nil, 0, nil
+		}
+		return "", nil, 0, fmt.Errorf("journal: field %s truncated", name)
+	}
+	end := i + 9 + int(size)
+	switch {
+	case end < len(data) && data[end] != '\n':
+		return "", nil, 0, fmt.Errorf("journal: field %s not followed by a newline", name)
+	case end < len(data):
+		end++
+	case !atEOF:
+		// The newline is still to come
+		return "", nil, 0, nil
+	}
+	return name, data[i+9 : i+9+int(size)], end, nil
+}
+
+type journalParser struct {
+	buff  []byte
+	parts LogParts
+}
+
+func (p *journalParser) Location(*time.Location) {}
+
+func (p *journalParser) Dump() LogParts {
+	return p.parts
+}
+
+func (p *journalParser) Parse() error {
+	p.parts = LogParts{}
+
+	fields := map[string][]string{}
+	var names []string
+	data := p.buff
+	for len(data) > 0 {
+		name, value, n, err := journalField(data, true)
+		if err != nil {
+			return err
+		}
+		data = data[n:]
+		if name == "" {
+			// The empty line ending the entry
+			break
+		}
+		if _, ok := fields[name]; !ok {
+			names = append(names, name)
+		}
+		fields[name] = append(fields[name], string(value))
+	}
+	if len(names) == 0 {
+		return errors.New("journal: empty entry")
+	}
+
+	for _, name := range names {
+		values := fields[name]
+		switch name {
+		case "MESSAGE":
+			p.parts["message"] = values[0]
+			p.parts["content"] = values[0]
+		case "PRIORITY":
+			if severity, err := strconv.Atoi(values[0]); err == nil && severity >= 0 && severity <= 7 {
+				p.parts["severity"] = severity
+			}
+		case "SYSLOG_FACILITY":
+			if facility, err := strconv.Atoi(values[0]); err == nil && facility >= 0 && facility <= 23 {
+				p.parts["facility"] = facility
+			}
+		case "SYSLOG_IDENTIFIER":
+			p.parts["tag"] = values[0]
+			p.parts["app_name"] = values[0]
+		case "_HOSTNAME":
+			p.parts["hostname"] = values[0]
+		default:
+			if len(values) == 1 {
+				p.parts[name] = values[0]
+			} else {
+				p.parts[name] = values
+			}
+		}
+	}
+
+	severity, ok := p.parts["severity"].(int)
+	if facility, ok2 := p.parts["facility"].(int); ok && ok2 {
+		p.parts["priority"] = facility<<3 | severity
+	}
+	for _, name := range []string{"_SOURCE_REALTIME_TIMESTAMP", "__REALTIME_TIMESTAMP"} {
+		if values, ok := fields[name]; ok {
+			if usec, err := strconv.ParseInt(values[0], 10, 64); err == nil {
+				p.parts["timestamp"] = time.UnixMicro(usec).UTC()
+				break
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package format
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func journalBinaryField(name, value string) string {
+	size := make([]byte, 8)
+	binary.LittleEndian.PutUint64(size, uint64(len(value)))
+	return name + "\n" + string(size) + value + "\n"
+}
+
+func (s *FormatSuite) TestJournal_Parse(c *C) {
+	entry := "__REALTIME_TIMESTAMP=1700000000123456\n" +
+		"_HOSTNAME=web1\n" +
+		"PRIORITY=3\n" +
+		"SYSLOG_FACILITY=4\n" +
+		"SYSLOG_IDENTIFIER=sshd\n" +
+		"_PID=812\n" +
+		"_SYSTEMD_UNIT=sshd.service\n" +
+		journalBinaryField("MESSAGE", "two\nlines\n") +
+		"TAG=a\n" +
+		"TAG=b\n"
+
+	p := (&Journal{}).GetParser([]byte(entry))
+	c.Assert(p.Parse(), IsNil)
+	parts := p.Dump()
+	c.Check(parts["message"], Equals, "two\nlines\n")
+	c.Check(parts["content"], Equals, "two\nlines\n")
+	c.Check(parts["severity"], Equals, 3)
+	c.Check(parts["facility"], Equals, 4)
+	c.Check(parts["priority"], Equals, 35)
+	c.Check(parts["tag"], Equals, "sshd")
+	c.Check(parts["app_name"], Equals, "sshd")
+	c.Check(parts["hostname"], Equals, "web1")
+	c.Check(parts["timestamp"], Equals, time.UnixMicro(1700000000123456).UTC())
+	c.Check(parts["_PID"], Equals, "812")
+	c.Check(parts["_SYSTEMD_UNIT"], Equals, "sshd.service")
+	c.Check(parts["TAG"], DeepEquals, []string{"a", "b"})
+	c.Check(parts["PRIORITY"], IsNil)
+
+	c.Check((&Journal{}).GetParser([]byte("MESSAGE\n\x10\x00")).Parse(), ErrorMatches, "journal: field MESSAGE truncated")
+	c.Check((&Journal{}).GetParser([]byte("\n")).Parse(), ErrorMatches, "journal: empty entry")
+}
+
+func (s *FormatSuite) TestJournal_Split(c *C) {
+	stream := "MESSAGE=first\n_PID=1\n\n" +
+		journalBinaryField("MESSAGE", "second\n\nwith an empty line") + "\n" +
+		"MESSAGE=third\n"
+
+	scanner := bufio.NewScanner(bytes.NewReader([]byte(stream)))
+	scanner.Split((&Journal{}).GetSplitFunc())
+	var messages []interface{}
+	for scanner.Scan() {
+		p := (&Journal{}).GetParser(scanner.Bytes())
+		c.Assert(p.Parse(), IsNil)
+		messages = append(messages, p.Dump()["message"])
+	}
+	c.Assert(scanner.Err(), IsNil)
+	c.Check(messages, DeepEquals, []interface{}{"first", "second\n\nwith an empty line", "third"})
+}
@@ -0,0 +1,38 @@
+package format
+
+import (
+	"github.com/GLMONTER/go-syslog/internal/syslogparser"
+)
+
+// KeyValues extracts the key=value pairs of message bodies, such as
+//
+//	action=deny srcip=10.0.0.1 msg="connection refused"
+//
+// Values may be quoted with " or ', words which are not pairs are skipped.
+type KeyValues struct {
+	// PairSeparators are the characters separating pairs, a space if empty
+	PairSeparators string
+	// ValueSeparators are the characters separating keys from their value, =
+	// if empty
+	ValueSeparators string
+}
+
+// Parse returns the key=value pairs of text, after its priority if it starts
+// with one
+func (kv *KeyValues) Parse(text string) map[string]string {
+	if len(text) > 0 && text[0] == syslogparser.PRI_PART_START {
+		cursor := 0
+		if _, err := syslogparser.ParsePriority([]byte(text), &cursor, len(text)); err == nil {
+			text = text[cursor:]
+		}
+	}
+
+	pairSeparators, valueSeparators := kv.PairSeparators, kv.ValueSeparators
+	if pairSeparators == "" {
+		pairSeparators = " "
+	}
+	if valueSeparators == "" {
+		valueSeparators = "="
+	}
+	return syslogparser.ParseKeyValues(text, pairSeparators, valueSeparators)
+}
@@ -0,0 +1,165 @@
+package format
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kmsg parses the records of the Linux /dev/kmsg device:
+//
+//	priority,sequence,timestamp,flags;message
+//	 KEY=value
+//
+// The priority gives "priority", "facility" and "severity", the sequence
+// number "sequence", so dropped records can be told, and the timestamp,
+// microseconds since boot, "monotonic" and the wall clock "timestamp". The
+// message, with its \x escapes decoded, is "message" and "content", and the
+// KEY=value continuation lines keep their KEY. Kernel records, of the kern
+// facility, are tagged "kernel".
+type Kmsg struct {
+	// BootTime turns the timestamps into wall clock times. If zero, it is
+	// taken from the system clocks on first use.
+	BootTime time.Time
+
+	once     sync.Once
+	bootTime time.Time
+}
+
+func (f *Kmsg) GetParser(line []byte) LogParser {
+	f.once.Do(func() {
+		f.bootTime = f.BootTime
+		if f.bootTime.IsZero() {
+			f.bootTime = kmsgBootTime()
+		}
+	})
+	return &kmsgParser{buff: line, bootTime: f.bootTime}
+}
+
+// GetSplitFunc splits records on newlines which do not start a continuation
+// line
+func (f *Kmsg) GetSplitFunc() bufio.SplitFunc {
+	return ScanKmsgRecords
+}
+
+// ScanKmsgRecords is a split function returning whole kmsg records, along
+// with their continuation lines
+func ScanKmsgRecords(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	for {
+		start := advance
+		for i := start; i < len(data); i++ {
+			if data[i] != '\n' {
+				continue
+			}
+			if i+1 == len(data) && !atEOF {
+				// Whether a continuation line follows is not known yet
+				return start, nil, nil
+			}
+			if i+1 < len(data) && data[i+1] == ' ' {
+				continue
+			}
+			advance = i + 1
+			if i > start {
+				return advance, data[start:i], nil
+			}
+			break
+		}
+		if advance > start {
+			// An empty line
+			continue
+		}
+		if atEOF && len(data) > start {
+			return len(data), bytes.TrimRight(data[start:], "\n"), nil
+		}
+		return start, nil, nil
+	}
+}
+
+type kmsgParser struct {
+	buff     []byte
+	bootTime time.Time
+	parts    LogParts
+}
+
+func (p *kmsgParser) Location(*time.Location) {}
+
+func (p *kmsgParser) Dump() LogParts {
+	return p.parts
+}
+
+func (p *kmsgParser) Parse() error {
+	p.parts = LogParts{}
+
+	header, body, ok := bytes.Cut(p.buff, []byte(";"))
+	if !ok {
+		return errors.New("kmsg: missing ';' after the record header")
+	}
+	fields := strings.Split(string(header), ",")
+	if len(fields) < 3 {
+		return fmt.Errorf("kmsg: record header %q has %d fields", header, len(fields))
+	}
+
+	priority, err := strconv.Atoi(fields[0])
+	if err != nil || priority < 0 {
+		return fmt.Errorf("kmsg: invalid priority %q", fields[0])
+	}
+	sequence, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return fmt.Errorf("kmsg: invalid sequence number %q", fields[1])
+	}
+	usec, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return fmt.Errorf("kmsg: invalid timestamp %q", fields[2])
+	}
+
+	// Userspace writes may carry any facility
+	facility := priority >> 3
+	p.parts["priority"] = priority
+	p.parts["facility"] = facility
+	p.parts["severity"] = priority & 7
+	p.parts["sequence"] = sequence
+	monotonic := time.Duration(usec) * time.Microsecond
+	p.parts["monotonic"] = monotonic
+	if !p.bootTime.IsZero() {
+		p.parts["timestamp"] = p.bootTime.Add(monotonic).UTC()
+	}
+	if facility == 0 {
+		p.parts["tag"] = "kernel"
+	}
+
+	lines := strings.Split(string(body), "\n")
+	message := kmsgUnescape(lines[0])
+	p.parts["message"] = message
+	p.parts["content"] = message
+	for _, line := range lines[1:] {
+		if key, value, ok := strings.Cut(strings.TrimPrefix(line, " "), "="); ok && key != "" {
+			p.parts[key] = kmsgUnescape(value)
+		}
+	}
+	return nil
+}
+
+// kmsgUnescape decodes the \xNN escapes the kernel writes for non printable
+// bytes and backslashes
+func kmsgUnescape(s string) string {
+	if !strings.Contains(s, `\x`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) && s[i+1] == 'x' {
+			if v, err := strconv.ParseUint(s[i+2:i+4], 16, 8); err == nil {
+				b.WriteByte(byte(v))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
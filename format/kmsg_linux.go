@@ -0,0 +1,19 @@
+//go:build linux
+
+package format
+
+import (
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// kmsgBootTime returns when the monotonic clock the kernel stamps its
+// records with started
+func kmsgBootTime() time.Time {
+	var ts unix.Timespec
+	if err := unix.ClockGettime(unix.CLOCK_MONOTONIC, &ts); err != nil {
+		return time.Time{}
+	}
+	return time.Now().Add(-time.Duration(ts.Nano()))
+}
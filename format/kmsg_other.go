@@ -0,0 +1,12 @@
+//go:build !linux
+
+package format
+
+import (
+	"time"
+)
+
+// kmsgBootTime returns the zero time, kmsg records only exist on Linux
+func kmsgBootTime() time.Time {
+	return time.Time{}
+}
@@ -0,0 +1,50 @@
+package format
+
+import (
+	"bufio"
+	"strings"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *FormatSuite) TestKmsg_Parse(c *C) {
+	boot := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	f := &Kmsg{BootTime: boot}
+
+	p := f.GetParser([]byte("6,339,5140900,-;NET: Registered \\x5cx protocol family 10\n SUBSYSTEM=net\n DEVICE=+net:eth0"))
+	c.Assert(p.Parse(), IsNil)
+	parts := p.Dump()
+	c.Check(parts["priority"], Equals, 6)
+	c.Check(parts["facility"], Equals, 0)
+	c.Check(parts["severity"], Equals, 6)
+	c.Check(parts["sequence"], Equals, uint64(339))
+	c.Check(parts["monotonic"], Equals, 5140900*time.Microsecond)
+	c.Check(parts["timestamp"], Equals, boot.Add(5140900*time.Microsecond))
+	c.Check(parts["tag"], Equals, "kernel")
+	c.Check(parts["message"], Equals, `NET: Registered \x protocol family 10`)
+	c.Check(parts["content"], Equals, parts["message"])
+	c.Check(parts["SUBSYSTEM"], Equals, "net")
+	c.Check(parts["DEVICE"], Equals, "+net:eth0")
+
+	p = f.GetParser([]byte("30,340,5141000,c;systemd[1]: started"))
+	c.Assert(p.Parse(), IsNil)
+	c.Check(p.Dump()["facility"], Equals, 3)
+	c.Check(p.Dump()["tag"], IsNil)
+
+	c.Check(f.GetParser([]byte("6,339,5140900 no header end")).Parse(), ErrorMatches, "kmsg: missing ';'.*")
+	c.Check(f.GetParser([]byte("6,x,5140900,-;message")).Parse(), ErrorMatches, `kmsg: invalid sequence number "x"`)
+}
+
+func (s *FormatSuite) TestKmsg_Split(c *C) {
+	input := "6,1,10,-;first\n SUBSYSTEM=net\n\n6,2,20,-;second\n"
+	scanner := bufio.NewScanner(strings.NewReader(input))
+	scanner.Split((&Kmsg{}).GetSplitFunc())
+
+	var records []string
+	for scanner.Scan() {
+		records = append(records, scanner.Text())
+	}
+	c.Assert(scanner.Err(), IsNil)
+	c.Check(records, DeepEquals, []string{"6,1,10,-;first\n SUBSYSTEM=net", "6,2,20,-;second"})
+}
@@ -0,0 +1,91 @@
+package format
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// parseLEEF parses an IBM QRadar Log Event Extended Format payload, of
+// version 1.0, whose attributes are separated by tabs:
+//
+//	LEEF:1.0|Vendor|Product|Version|EventID|Attributes
+//
+// or of version 2.0, which may set another delimiter, as a character or its
+// code in hexadecimal, such as x09 or 0x5E:
+//
+//	LEEF:2.0|Vendor|Product|Version|EventID|Delimiter|Attributes
+//
+// The header fields become "leef_version", "leef_vendor", "leef_product",
+// "leef_product_version" and "leef_event_id", and the key=value attributes
+// the map[string]string "leef_attributes".
+func parseLEEF(payload string) (LogParts, error) {
+	if !strings.HasPrefix(payload, "LEEF:") {
+		return nil, errors.New("leef: missing LEEF: prefix")
+	}
+	fields, attributes, err := headerFields(payload[len("LEEF:"):], 5)
+	if err != nil {
+		return nil, fmt.Errorf("leef: %w", err)
+	}
+
+	delimiter := "\t"
+	switch version := strings.TrimSpace(fields[0]); version {
+	case "1.0", "1":
+	case "2.0", "2":
+		// The delimiter field may be left out, tabs separating the attributes
+		if spec, rest, ok := strings.Cut(attributes, "|"); ok {
+			if d, err := leefDelimiter(spec); err == nil {
+				delimiter, attributes = d, rest
+			} else if !strings.Contains(spec, "=") {
+				return nil, err
+			}
+		}
+	default:
+		return nil, fmt.Errorf("leef: unknown version %q", fields[0])
+	}
+
+	pairs := map[string]string{}
+	for _, attribute := range strings.Split(strings.TrimRight(attributes, "\r\n"), delimiter) {
+		if strings.TrimSpace(attribute) == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(attribute, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("leef: attribute %q is not key=value", attribute)
+		}
+		pairs[strings.TrimSpace(key)] = value
+	}
+
+	return LogParts{
+		"leef_version":         strings.TrimSpace(fields[0]),
+		"leef_vendor":          fields[1],
+		"leef_product":         fields[2],
+		"leef_product_version": fields[3],
+		"leef_event_id":        fields[4],
+		"leef_attributes":      pairs,
+	}, nil
+}
+
+// leefDelimiter returns the delimiter a LEEF 2.0 header specifies: a single
+// character, its code prefixed with x or 0x, or nothing for a tab
+func leefDelimiter(spec string) (string, error) {
+	if spec == "" {
+		return "\t", nil
+	}
+	if utf8.RuneCountInString(spec) == 1 {
+		return spec, nil
+	}
+
+	lower := strings.ToLower(spec)
+	hex := strings.TrimPrefix(strings.TrimPrefix(lower, "0x"), "x")
+	if hex == lower || len(hex) == 0 || len(hex) > 4 {
+		return "", fmt.Errorf("leef: invalid delimiter %q", spec)
+	}
+	code, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil || code == 0 {
+		return "", fmt.Errorf("leef: invalid delimiter %q", spec)
+	}
+	return string(rune(code)), nil
+}
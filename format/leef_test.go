@@ -0,0 +1,58 @@
+package format
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+func (s *FormatSuite) TestLEEF_Version1(c *C) {
+	line := "<134>Oct 11 22:14:15 qradar LEEF:1.0|Microsoft|MSExchange|4.0 SP1|15345|src=192.0.2.0\tdst=172.50.123.1\tsev=5\tmsg=mail sent to bob"
+	p := (&RFC3164{}).GetParser([]byte(line))
+	c.Assert(p.Parse(), IsNil)
+	parts := p.Dump()
+
+	c.Check(parts["leef_version"], Equals, "1.0")
+	c.Check(parts["leef_vendor"], Equals, "Microsoft")
+	c.Check(parts["leef_product"], Equals, "MSExchange")
+	c.Check(parts["leef_product_version"], Equals, "4.0 SP1")
+	c.Check(parts["leef_event_id"], Equals, "15345")
+	c.Check(parts["leef_attributes"], DeepEquals, map[string]string{
+		"src": "192.0.2.0",
+		"dst": "172.50.123.1",
+		"sev": "5",
+		"msg": "mail sent to bob",
+	})
+}
+
+func (s *FormatSuite) TestLEEF_Version2(c *C) {
+	for _, test := range []struct {
+		payload    string
+		attributes map[string]string
+	}{
+		{"LEEF:2.0|Lancope|StealthWatch|1.0|41|^|src=10.0.1.8^dst=10.0.0.5^sev=5", map[string]string{"src": "10.0.1.8", "dst": "10.0.0.5", "sev": "5"}},
+		{"LEEF:2.0|Lancope|StealthWatch|1.0|41|x09|src=10.0.1.8\tdst=10.0.0.5", map[string]string{"src": "10.0.1.8", "dst": "10.0.0.5"}},
+		{"LEEF:2.0|Lancope|StealthWatch|1.0|41|0x7C|src=10.0.1.8|dst=10.0.0.5", map[string]string{"src": "10.0.1.8", "dst": "10.0.0.5"}},
+		{"LEEF:2.0|Lancope|StealthWatch|1.0|41||src=10.0.1.8\tdst=10.0.0.5", map[string]string{"src": "10.0.1.8", "dst": "10.0.0.5"}},
+		{"LEEF:2.0|Lancope|StealthWatch|1.0|41|src=10.0.1.8\tdst=10.0.0.5", map[string]string{"src": "10.0.1.8", "dst": "10.0.0.5"}},
+	} {
+		line := "<165>1 2003-10-11T22:14:15.003Z host app - - - " + test.payload
+		p := (&RFC5424{}).GetParser([]byte(line))
+		c.Assert(p.Parse(), IsNil)
+		c.Check(p.Dump()["leef_version"], Equals, "2.0", Commentf("%s", test.payload))
+		c.Check(p.Dump()["leef_attributes"], DeepEquals, test.attributes, Commentf("%s", test.payload))
+	}
+}
+
+func (s *FormatSuite) TestLEEF_Malformed(c *C) {
+	for _, payload := range []string{
+		"LEEF:1.0|Vendor|Product",
+		"LEEF:3.0|Vendor|Product|1.0|41|src=10.0.1.8",
+		"LEEF:1.0|Vendor|Product|1.0|41|src=10.0.1.8\tnot an attribute",
+		"LEEF:2.0|Vendor|Product|1.0|41|xZZ|src=10.0.1.8",
+	} {
+		line := "<134>Oct 11 22:14:15 qradar " + payload
+		p := (&RFC3164{}).GetParser([]byte(line))
+		c.Assert(p.Parse(), IsNil)
+		c.Check(p.Dump()["leef_version"], IsNil, Commentf("%s", payload))
+		c.Check(p.Dump()["content"], Equals, line)
+	}
+}
@@ -0,0 +1,44 @@
+package format
+
+import "strings"
+
+// payloadParsers parse the structured payloads devices send as the message
+// of their syslog messages, which start with their prefix
+var payloadParsers = []struct {
+	prefix string
+	parse  func(payload string) (LogParts, error)
+}{
+	{"CEF:", parseCEF},
+	{"LEEF:", parseLEEF},
+}
+
+// decodePayload adds the fields of the structured payload found in the
+// message of parts, at its start or after a space. Payloads which do not
+// parse leave parts as they are.
+func decodePayload(parts LogParts) {
+	for _, name := range []string{"content", "message"} {
+		text, ok := parts[name].(string)
+		if !ok {
+			continue
+		}
+		for _, p := range payloadParsers {
+			for from := 0; ; {
+				i := strings.Index(text[from:], p.prefix)
+				if i < 0 {
+					break
+				}
+				i += from
+				from = i + len(p.prefix)
+				if i > 0 && text[i-1] != ' ' {
+					continue
+				}
+				if fields, err := p.parse(text[i:]); err == nil {
+					for k, v := range fields {
+						parts[k] = v
+					}
+					return
+				}
+			}
+		}
+	}
+}
@@ -2,14 +2,16 @@ package format
 
 import (
 	"bufio"
-
-	"github.com/GLMONTER/go-syslog/internal/syslogparser/rfc3164"
 )
 
-type RFC3164 struct{}
+type RFC3164 struct {
+	// Dialects selects the vendor dialects tried on messages without a
+	// RFC3164 timestamp, all the registered ones by default
+	Dialects DialectSelection
+}
 
 func (f *RFC3164) GetParser(line []byte) LogParser {
-	return &parserWrapper{rfc3164.NewParser(line)}
+	return &parserWrapper{f.Dialects.newRFC3164Parser(line)}
 }
 
 func (f *RFC3164) GetSplitFunc() bufio.SplitFunc {
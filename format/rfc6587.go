@@ -2,44 +2,28 @@ package format
 
 import (
 	"bufio"
-	"bytes"
-	"strconv"
 
 	"github.com/GLMONTER/go-syslog/internal/syslogparser/rfc5424"
 )
 
-type RFC6587 struct{}
+// RFC6587 accepts both octet counted and non-transparent framing, mixed on
+// the same stream. The zero value splits non-transparent frames on LF and
+// does not limit the frame length.
+type RFC6587 struct {
+	// Trailer terminates non-transparent frames
+	Trailer Trailer
+	// MaxFrameLength drops longer frames, 0 means no limit
+	MaxFrameLength int
+}
 
 func (f *RFC6587) GetParser(line []byte) LogParser {
 	return &parserWrapper{rfc5424.NewParser(line)}
 }
 
 func (f *RFC6587) GetSplitFunc() bufio.SplitFunc {
-	return rfc6587ScannerSplit
+	return f.GetFramer(nil).Split
 }
 
-func rfc6587ScannerSplit(data []byte, atEOF bool) (advance int, token []byte, err error) {
-	if atEOF && len(data) == 0 {
-		return 0, nil, nil
-	}
-
-	if i := bytes.IndexByte(data, ' '); i > 0 {
-		pLength := data[0:i]
-		length, err := strconv.Atoi(string(pLength))
-		if err != nil {
-			if string(data[0:1]) == "<" {
-				// Assume this frame uses non-transparent-framing
-				return len(data), data, nil
-			}
-			return 0, nil, err
-		}
-		end := length + i + 1
-		if len(data) >= end {
-			// Return the frame with the length removed
-			return end, data[i+1 : end], nil
-		}
-	}
-
-	// Request more data
-	return 0, nil, nil
+func (f *RFC6587) GetFramer(report func(error)) *Framer {
+	return NewFramer(f.Trailer, f.MaxFrameLength, report)
 }
@@ -55,35 +55,58 @@ func (s *FormatSuite) TestRFC6587_GetSplitFuncMultiSplitNonTransparentFraming(c
 	}
 	buf := new(bytes.Buffer)
 	for _, i := range find {
-		fmt.Fprintf(buf, "%s", i)
+		fmt.Fprintf(buf, "%s\n", i)
 	}
 	scanner := bufio.NewScanner(buf)
 	scanner.Split(f.GetSplitFunc())
 
 	i := 0
 	for scanner.Scan() {
-		c.Assert(scanner.Text(), Equals, strings.Join(find, ""))
+		c.Assert(scanner.Text(), Equals, find[i])
 		i++
 	}
 
-	c.Assert(i, Equals, 1)
+	c.Assert(i, Equals, len(find))
+}
+
+func (s *FormatSuite) TestRFC6587_GetSplitFuncMixedFraming(c *C) {
+	f := RFC6587{Trailer: TrailerNUL}
+
+	buf := strings.NewReader("<1> first\x0010 <2> second<3> third\x00")
+	scanner := bufio.NewScanner(buf)
+	scanner.Split(f.GetSplitFunc())
+
+	var found []string
+	for scanner.Scan() {
+		found = append(found, scanner.Text())
+	}
+
+	c.Assert(scanner.Err(), IsNil)
+	c.Assert(found, DeepEquals, []string{"<1> first", "<2> second", "<3> third"})
 }
 
 func (s *FormatSuite) TestRFC6587_GetSplitBadSplit(c *C) {
 	f := RFC6587{}
 
 	find := "I am test.2 ab"
-	buf := strings.NewReader("9 " + find)
+	buf := strings.NewReader("9 " + find + "\n4 next")
 	scanner := bufio.NewScanner(buf)
-	scanner.Split(f.GetSplitFunc())
+	var errs []error
+	scanner.Split(f.GetFramer(func(err error) {
+		errs = append(errs, err)
+	}).Split)
 
 	r := scanner.Scan()
-	c.Assert(r, NotNil)
+	c.Assert(r, Equals, true)
 	c.Assert(scanner.Text(), Equals, find[0:9])
 
+	// The garbage up to the trailer is skipped and the stream carries on
 	r = scanner.Scan()
-	c.Assert(r, NotNil)
+	c.Assert(r, Equals, true)
+	c.Assert(scanner.Text(), Equals, "next")
 
-	err := scanner.Err()
-	c.Assert(err, ErrorMatches, "strconv.*: parsing \".2\": invalid syntax")
+	c.Assert(scanner.Scan(), Equals, false)
+	c.Assert(scanner.Err(), IsNil)
+	c.Assert(errs, HasLen, 1)
+	c.Assert(errs[0], DeepEquals, &FramingError{Reason: "frame does not start with a length or a priority", Discarded: 6})
 }
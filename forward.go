@@ -0,0 +1,643 @@
+package syslog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/GLMONTER/go-syslog/format"
+	"github.com/vmihailenco/msgpack/v5"
+	"github.com/vmihailenco/msgpack/v5/msgpcode"
+)
+
+// ForwardMode selects how a ForwardHandler packs its entries, as described by
+// the Fluentd Forward protocol
+type ForwardMode int
+
+const (
+	ForwardMessage       ForwardMode = iota // one [tag, time, record] message per entry
+	ForwardForward                          // batches as [tag, [[time, record], ...]]
+	ForwardPackedForward                    // batches as [tag, bin of concatenated entries]
+)
+
+const (
+	forwardEventTimeExt         = 0
+	defaultForwardBatchSize     = 100
+	defaultForwardFlushInterval = time.Second
+	defaultForwardTimeout       = 10 * time.Second
+	// forwardMaxPackedSize bounds decompressed PackedForward entries
+	forwardMaxPackedSize = 64 * 1024 * 1024
+)
+
+// ForwardHandler forwards every syslog entry to a Fluentd or Fluent Bit
+// aggregator with the Forward protocol. The entry "timestamp" becomes the
+// event time, every other part a field of the record.
+type ForwardHandler struct {
+	addr          string
+	tag           string
+	mode          ForwardMode
+	ack           bool
+	batchSize     int
+	flushInterval time.Duration
+	timeout       time.Duration
+	errorFunc     func(error)
+
+	mu      sync.Mutex
+	conn    net.Conn
+	decoder *msgpack.Decoder
+	entries bytes.Buffer
+	count   int
+	// entry is the scratch buffer entries are encoded in
+	entry bytes.Buffer
+	timer *time.Timer
+}
+
+// NewForwardHandler returns a new ForwardHandler sending the entries tagged
+// with tag to the aggregator at addr. It connects on the first entry.
+func NewForwardHandler(addr string, tag string, mode ForwardMode) *ForwardHandler {
+	return &ForwardHandler{
+		addr:          addr,
+		tag:           tag,
+		mode:          mode,
+		batchSize:     defaultForwardBatchSize,
+		flushInterval: defaultForwardFlushInterval,
+		timeout:       defaultForwardTimeout,
+	}
+}
+
+// SetAck Asks the aggregator to acknowledge every message, using the chunk
+// option. Messages which are not acknowledged are sent again, once.
+func (h *ForwardHandler) SetAck(ack bool) {
+	h.ack = ack
+}
+
+// SetBatchSize Sets how many entries the Forward and PackedForward modes send
+// at once, 100 by default
+func (h *ForwardHandler) SetBatchSize(size int) {
+	h.batchSize = size
+}
+
+// SetFlushInterval Sets how long the Forward and PackedForward modes hold an
+// incomplete batch, 1 second by default. 0 holds it until Flush.
+func (h *ForwardHandler) SetFlushInterval(interval time.Duration) {
+	h.flushInterval = interval
+}
+
+// SetTimeout Sets the timeout to connect, write and wait for acks, 10 seconds
+// by default
+func (h *ForwardHandler) SetTimeout(timeout time.Duration) {
+	h.timeout = timeout
+}
+
+// SetErrorFunc Sets the function receiving the errors of sending entries,
+// which are dropped otherwise
+func (h *ForwardHandler) SetErrorFunc(errorFunc func(error)) {
+	h.errorFunc = errorFunc
+}
+
+// Syslog entry receiver
+func (h *ForwardHandler) Handle(logParts format.LogParts, messageLength int64, err error) {
+	h.report(h.handle(logParts))
+}
+
+func (h *ForwardHandler) handle(logParts format.LogParts) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.mode == ForwardMessage {
+		var message bytes.Buffer
+		enc := msgpack.NewEncoder(&message)
+		enc.SetSortMapKeys(true)
+		chunk := h.chunkID()
+		err := enc.EncodeArrayLen(h.arrayLen(chunk))
+		if err == nil {
+			err = enc.EncodeString(h.tag)
+		}
+		if err == nil {
+			err = encodeEventTime(enc, forwardEventTime(logParts))
+		}
+		if err == nil {
+			err = enc.EncodeMap(forwardRecord(logParts))
+		}
+		if err == nil {
+			err = h.encodeOptions(enc, chunk, 0)
+		}
+		if err != nil {
+			return h.wrap(err)
+		}
+		return h.send(message.Bytes(), chunk)
+	}
+
+	// Encoded apart, so an entry failing halfway does not corrupt the batch
+	h.entry.Reset()
+	enc := msgpack.NewEncoder(&h.entry)
+	enc.SetSortMapKeys(true)
+	err := enc.EncodeArrayLen(2)
+	if err == nil {
+		err = encodeEventTime(enc, forwardEventTime(logParts))
+	}
+	if err == nil {
+		err = enc.EncodeMap(forwardRecord(logParts))
+	}
+	if err != nil {
+		return h.wrap(err)
+	}
+	h.entries.Write(h.entry.Bytes())
+	h.count++
+
+	if h.count >= h.batchSize {
+		return h.flush()
+	}
+	if h.timer == nil && h.flushInterval > 0 {
+		h.timer = time.AfterFunc(h.flushInterval, func() {
+			h.report(h.Flush())
+		})
+	}
+	return nil
+}
+
+// Flush sends the entries batched so far
+func (h *ForwardHandler) Flush() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.flush()
+}
+
+// flush sends the batched entries. h.mu is held.
+func (h *ForwardHandler) flush() error {
+	if h.timer != nil {
+		h.timer.Stop()
+		h.timer = nil
+	}
+	if h.count == 0 {
+		return nil
+	}
+	count := h.count
+	entries := h.entries.Bytes()
+	defer func() {
+		h.entries.Reset()
+		h.count = 0
+	}()
+
+	var message bytes.Buffer
+	enc := msgpack.NewEncoder(&message)
+	chunk := h.chunkID()
+	err := enc.EncodeArrayLen(h.arrayLen(chunk))
+	if err == nil {
+		err = enc.EncodeString(h.tag)
+	}
+	if err == nil {
+		if h.mode == ForwardPackedForward {
+			err = enc.EncodeBytes(entries)
+		} else if err = enc.EncodeArrayLen(count); err == nil {
+			_, err = message.Write(entries)
+		}
+	}
+	if err == nil {
+		err = h.encodeOptions(enc, chunk, count)
+	}
+	if err != nil {
+		return h.wrap(err)
+	}
+
+	if err := h.send(message.Bytes(), chunk); err != nil {
+		return fmt.Errorf("%w, dropped %d entries", err, count)
+	}
+	return nil
+}
+
+// Close sends the batched entries and closes the connection
+func (h *ForwardHandler) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	err := h.flush()
+	if h.conn != nil {
+		if closeErr := h.conn.Close(); err == nil {
+			err = closeErr
+		}
+		h.conn, h.decoder = nil, nil
+	}
+	return err
+}
+
+// chunkID returns a new chunk id if acks are on. h.mu is held.
+func (h *ForwardHandler) chunkID() string {
+	if !h.ack {
+		return ""
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+	return base64.StdEncoding.EncodeToString(id)
+}
+
+// arrayLen returns the length of a message, which has options with acks or
+// batches
+func (h *ForwardHandler) arrayLen(chunk string) int {
+	length := 2
+	if h.mode == ForwardMessage {
+		length++
+	}
+	if chunk != "" || h.mode != ForwardMessage {
+		length++
+	}
+	return length
+}
+
+func (h *ForwardHandler) encodeOptions(enc *msgpack.Encoder, chunk string, size int) error {
+	options := map[string]interface{}{}
+	if chunk != "" {
+		options["chunk"] = chunk
+	}
+	if h.mode != ForwardMessage {
+		options["size"] = size
+	}
+	if len(options) == 0 {
+		return nil
+	}
+	return enc.EncodeMap(options)
+}
+
+// send writes message, on a new connection if the current one fails. h.mu
+// is held.
+func (h *ForwardHandler) send(message []byte, chunk string) error {
+	err := h.sendOnce(message, chunk)
+	if err != nil {
+		// The aggregator may have closed an idle connection
+		err = h.sendOnce(message, chunk)
+	}
+	return h.wrap(err)
+}
+
+func (h *ForwardHandler) sendOnce(message []byte, chunk string) (err error) {
+	if h.conn == nil {
+		conn, err := net.DialTimeout("tcp", h.addr, h.timeout)
+		if err != nil {
+			return err
+		}
+		h.conn, h.decoder = conn, msgpack.NewDecoder(conn)
+	}
+	defer func() {
+		if err != nil {
+			h.conn.Close()
+			h.conn, h.decoder = nil, nil
+		}
+	}()
+
+	if err := h.conn.SetDeadline(time.Now().Add(h.timeout)); err != nil {
+		return err
+	}
+	if _, err := h.conn.Write(message); err != nil {
+		return err
+	}
+	if chunk == "" {
+		return nil
+	}
+
+	response, err := h.decoder.DecodeMap()
+	if err != nil {
+		return fmt.Errorf("waiting for ack: %w", err)
+	}
+	if ack, _ := response["ack"].(string); ack != chunk {
+		return fmt.Errorf("ack %q does not match chunk %q", response["ack"], chunk)
+	}
+	return nil
+}
+
+func (h *ForwardHandler) wrap(err error) error {
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("forward to %s: %w", h.addr, err)
+}
+
+func (h *ForwardHandler) report(err error) {
+	if err != nil && h.errorFunc != nil {
+		h.errorFunc(err)
+	}
+}
+
+// forwardEventTime returns the timestamp of logParts, now if it has none
+func forwardEventTime(logParts format.LogParts) time.Time {
+	if timestamp, ok := logParts["timestamp"].(time.Time); ok && !timestamp.IsZero() {
+		return timestamp
+	}
+	return time.Now()
+}
+
+// forwardRecord returns the parts of logParts but the timestamp, with times
+// as RFC3339 strings
+func forwardRecord(logParts format.LogParts) map[string]interface{} {
+	record := make(map[string]interface{}, len(logParts))
+	for name, value := range logParts {
+		if name == "timestamp" {
+			continue
+		}
+		if t, ok := value.(time.Time); ok {
+			value = t.Format(time.RFC3339Nano)
+		}
+		record[name] = value
+	}
+	return record
+}
+
+// encodeEventTime encodes t as the EventTime extension, seconds and
+// nanoseconds as two big endian uint32
+func encodeEventTime(enc *msgpack.Encoder, t time.Time) error {
+	if err := enc.EncodeExtHeader(forwardEventTimeExt, 8); err != nil {
+		return err
+	}
+	var b [8]byte
+	binary.BigEndian.PutUint32(b[:4], uint32(t.Unix()))
+	binary.BigEndian.PutUint32(b[4:], uint32(t.Nanosecond()))
+	_, err := enc.Writer().Write(b[:])
+	return err
+}
+
+// decodeEventTime decodes an EventTime, or the integer or float seconds older
+// clients send
+func decodeEventTime(dec *msgpack.Decoder) (time.Time, error) {
+	code, err := dec.PeekCode()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	switch {
+	case msgpcode.IsExt(code):
+		extID, extLen, err := dec.DecodeExtHeader()
+		if err != nil {
+			return time.Time{}, err
+		}
+		if extID != forwardEventTimeExt || extLen != 8 {
+			return time.Time{}, fmt.Errorf("unexpected ext %d of %d bytes as event time", extID, extLen)
+		}
+		var b [8]byte
+		if err := dec.ReadFull(b[:]); err != nil {
+			return time.Time{}, err
+		}
+		return time.Unix(int64(binary.BigEndian.Uint32(b[:4])), int64(binary.BigEndian.Uint32(b[4:]))).UTC(), nil
+	case code == msgpcode.Float || code == msgpcode.Double:
+		seconds, err := dec.DecodeFloat64()
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Unix(0, int64(seconds*1e9)).UTC(), nil
+	default:
+		seconds, err := dec.DecodeInt64()
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Unix(seconds, 0).UTC(), nil
+	}
+}
+
+// ListenForward Configure the server for receiving Fluentd Forward protocol
+// traffic on a TCP addr. Every record becomes a message: its fields are kept,
+// "log" is used as "message" and "content" when there is no "message",
+// "host" as "hostname", the event time as "timestamp" and the tag ends up in
+// "fluent_tag". The server format is not used.
+func (s *Server) ListenForward(addr string) error {
+	_, err := s.AddListener("forward", addr, nil)
+	return err
+}
+
+// goServeForward serves a Forward connection l accepted
+func (s *Server) goServeForward(l *listener, connection net.Conn) {
+	if !l.track(connection) {
+		connection.Close()
+		return
+	}
+
+	var client string
+	if remoteAddr := connection.RemoteAddr(); remoteAddr != nil {
+		client = remoteAddr.String()
+	}
+	conn := s.openConn(l, client)
+
+	s.spawn(l, func() {
+		reason := s.serveForward(l, connection, conn, client)
+		l.untrack(connection)
+		if err := connection.Close(); err != nil {
+			s.report(err)
+		}
+		s.closeConn(conn, reason)
+	})
+}
+
+// serveForward delivers the records of a Forward connection of l until it
+// ends, returning why
+func (s *Server) serveForward(l *listener, connection net.Conn, conn *trackedConn, client string) error {
+	done := l.done
+	dec := msgpack.NewDecoder(countingReader{connection, conn})
+
+	for {
+		s.setReadTimeout(l, connection)
+
+		chunk, err := s.forwardMessage(dec, conn, client)
+		if err == nil && chunk != "" {
+			var ack bytes.Buffer
+			err = msgpack.NewEncoder(&ack).EncodeMap(map[string]interface{}{"ack": chunk})
+			if err == nil {
+				_, err = connection.Write(ack.Bytes())
+			}
+		}
+
+		if err != nil {
+			select {
+			case <-done:
+				return ErrListenerStopped
+			default:
+			}
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			s.report(fmt.Errorf("%s: forward: %w", client, err))
+			return err
+		}
+	}
+}
+
+// forwardMessage delivers the records of a Message, Forward, PackedForward or
+// CompressedPackedForward message, and returns the chunk to acknowledge
+func (s *Server) forwardMessage(dec *msgpack.Decoder, conn *trackedConn, client string) (chunk string, err error) {
+	length, err := dec.DecodeArrayLen()
+	if err != nil {
+		return "", err
+	}
+	if length < 2 || length > 4 {
+		return "", fmt.Errorf("unexpected message of %d elements", length)
+	}
+	tag, err := dec.DecodeString()
+	if err != nil {
+		return "", err
+	}
+
+	code, err := dec.PeekCode()
+	if err != nil {
+		return "", err
+	}
+
+	var deliver []func()
+	var options map[string]interface{}
+	switch {
+	case msgpcode.IsFixedArray(code) || code == msgpcode.Array16 || code == msgpcode.Array32:
+		count, err := dec.DecodeArrayLen()
+		if err != nil {
+			return "", err
+		}
+		for i := 0; i < count; i++ {
+			entry, err := dec.DecodeRaw()
+			if err != nil {
+				return "", err
+			}
+			f, err := s.forwardEntry(tag, entry, conn, client)
+			if err != nil {
+				return "", err
+			}
+			deliver = append(deliver, f)
+		}
+		if length > 2 {
+			if options, err = dec.DecodeMap(); err != nil {
+				return "", err
+			}
+		}
+
+	case msgpcode.IsBin(code) || msgpcode.IsString(code):
+		packed, err := dec.DecodeBytes()
+		if err != nil {
+			return "", err
+		}
+		if length > 2 {
+			if options, err = dec.DecodeMap(); err != nil {
+				return "", err
+			}
+		}
+		if compressed, _ := options["compressed"].(string); compressed == "gzip" {
+			if packed, err = gunzipForward(packed); err != nil {
+				return "", err
+			}
+		}
+		entries := msgpack.NewDecoder(bytes.NewReader(packed))
+		for {
+			entry, err := entries.DecodeRaw()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return "", err
+			}
+			f, err := s.forwardEntry(tag, entry, conn, client)
+			if err != nil {
+				return "", err
+			}
+			deliver = append(deliver, f)
+		}
+
+	default:
+		eventTime, err := decodeEventTime(dec)
+		if err != nil {
+			return "", err
+		}
+		record, err := dec.DecodeRaw()
+		if err != nil {
+			return "", err
+		}
+		fields, err := msgpack.NewDecoder(bytes.NewReader(record)).DecodeMap()
+		if err != nil {
+			return "", err
+		}
+		if length > 3 {
+			if options, err = dec.DecodeMap(); err != nil {
+				return "", err
+			}
+		}
+		deliver = append(deliver, s.forwardDelivery(tag, eventTime, fields, int64(len(record)), conn, client))
+	}
+
+	for _, f := range deliver {
+		f()
+	}
+	chunk, _ = options["chunk"].(string)
+	return chunk, nil
+}
+
+// forwardEntry decodes a [time, record] entry and returns the function
+// delivering it
+func (s *Server) forwardEntry(tag string, entry []byte, conn *trackedConn, client string) (func(), error) {
+	dec := msgpack.NewDecoder(bytes.NewReader(entry))
+	if length, err := dec.DecodeArrayLen(); err != nil {
+		return nil, err
+	} else if length != 2 {
+		return nil, fmt.Errorf("unexpected entry of %d elements", length)
+	}
+	eventTime, err := decodeEventTime(dec)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := dec.DecodeMap()
+	if err != nil {
+		return nil, err
+	}
+	return s.forwardDelivery(tag, eventTime, fields, int64(len(entry)), conn, client), nil
+}
+
+func (s *Server) forwardDelivery(tag string, eventTime time.Time, fields map[string]interface{}, length int64, conn *trackedConn, client string) func() {
+	return func() {
+		conn.messages.Add(1)
+		s.deliver(forwardParts(tag, eventTime, fields), length, nil, client, "", nil)
+	}
+}
+
+// forwardParts maps a record onto the parts of the syslog formats
+func forwardParts(tag string, eventTime time.Time, fields map[string]interface{}) format.LogParts {
+	logParts := make(format.LogParts, len(fields)+4)
+	for name, value := range fields {
+		logParts[name] = value
+	}
+
+	if _, ok := logParts["message"]; !ok {
+		if log, ok := fields["log"]; ok {
+			if b, ok := log.([]byte); ok {
+				log = string(b)
+			}
+			logParts["message"] = log
+		}
+	}
+	if _, ok := logParts["content"]; !ok {
+		if message, ok := logParts["message"]; ok {
+			logParts["content"] = message
+		}
+	}
+	if _, ok := logParts["hostname"]; !ok {
+		if host, ok := fields["host"]; ok {
+			logParts["hostname"] = host
+		}
+	}
+	logParts["timestamp"] = eventTime
+	logParts["fluent_tag"] = tag
+	return logParts
+}
+
+func gunzipForward(packed []byte) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(packed))
+	if err != nil {
+		return nil, err
+	}
+	// Fluent Bit concatenates gzip members, which the reader handles
+	entries, err := io.ReadAll(io.LimitReader(reader, forwardMaxPackedSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) > forwardMaxPackedSize {
+		return nil, fmt.Errorf("packed entries exceed %d bytes", forwardMaxPackedSize)
+	}
+	return entries, nil
+}
@@ -0,0 +1,141 @@
+package syslog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net"
+	"time"
+
+	"github.com/GLMONTER/go-syslog/format"
+	"github.com/vmihailenco/msgpack/v5"
+	. "gopkg.in/check.v1"
+)
+
+func receiveParts(c *C, channel LogPartsChannel) format.LogParts {
+	select {
+	case logParts := <-channel:
+		return logParts
+	case <-time.After(5 * time.Second):
+		c.Fatal("timed out waiting for a message")
+	}
+	return nil
+}
+
+func (s *ServerSuite) TestForward(c *C) {
+	channel := make(LogPartsChannel, 10)
+	server := NewServer()
+	server.SetFormat(RFC5424)
+	server.SetHandler(NewChannelHandler(channel))
+	addr, err := server.AddListener("forward", "127.0.0.1:0", nil)
+	c.Assert(err, IsNil)
+	server.Boot()
+
+	timestamp := time.Date(2023, 5, 17, 10, 11, 12, 345678900, time.UTC)
+	for _, mode := range []ForwardMode{ForwardMessage, ForwardForward, ForwardPackedForward} {
+		for _, ack := range []bool{false, true} {
+			var errs []error
+			handler := NewForwardHandler(addr.String(), "syslog.test", mode)
+			handler.SetAck(ack)
+			handler.SetFlushInterval(0)
+			handler.SetErrorFunc(func(err error) { errs = append(errs, err) })
+
+			handler.Handle(format.LogParts{"hostname": "host1", "message": "first", "severity": 3, "timestamp": timestamp}, 0, nil)
+			handler.Handle(format.LogParts{"hostname": "host2", "message": "second"}, 0, nil)
+			c.Assert(handler.Close(), IsNil)
+			c.Assert(errs, HasLen, 0)
+
+			logParts := receiveParts(c, channel)
+			c.Check(logParts["hostname"], Equals, "host1")
+			c.Check(logParts["message"], Equals, "first")
+			c.Check(logParts["severity"], Equals, int8(3))
+			c.Check(logParts["timestamp"], Equals, timestamp)
+			c.Check(logParts["fluent_tag"], Equals, "syslog.test")
+
+			logParts = receiveParts(c, channel)
+			c.Check(logParts["message"], Equals, "second")
+			c.Check(logParts["content"], Equals, "second")
+		}
+	}
+
+	server.Kill()
+	server.Wait()
+}
+
+func (s *ServerSuite) TestForwardEncodeError(c *C) {
+	channel := make(LogPartsChannel, 10)
+	server := NewServer()
+	server.SetFormat(RFC5424)
+	server.SetHandler(NewChannelHandler(channel))
+	addr, err := server.AddListener("forward", "127.0.0.1:0", nil)
+	c.Assert(err, IsNil)
+	server.Boot()
+
+	var errs []error
+	handler := NewForwardHandler(addr.String(), "syslog.test", ForwardPackedForward)
+	handler.SetFlushInterval(0)
+	handler.SetErrorFunc(func(err error) { errs = append(errs, err) })
+
+	// Fails halfway through its record, after "a" was encoded
+	handler.Handle(format.LogParts{"a": "first", "b": make(chan int)}, 0, nil)
+	c.Check(errs, HasLen, 1)
+	handler.Handle(format.LogParts{"message": "second"}, 0, nil)
+	c.Assert(handler.Close(), IsNil)
+
+	logParts := receiveParts(c, channel)
+	c.Check(logParts["message"], Equals, "second")
+	select {
+	case err := <-server.ErrChan:
+		c.Errorf("unexpected error: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	server.Kill()
+	server.Wait()
+	c.Check(channel, HasLen, 0)
+}
+
+func (s *ServerSuite) TestForwardCompressedPacked(c *C) {
+	channel := make(LogPartsChannel, 10)
+	server := NewServer()
+	server.SetFormat(RFC5424)
+	server.SetHandler(NewChannelHandler(channel))
+	addr, err := server.AddListener("forward", "127.0.0.1:0", nil)
+	c.Assert(err, IsNil)
+	server.Boot()
+
+	// Entries as Fluent Bit sends them, with integer times
+	var entries bytes.Buffer
+	enc := msgpack.NewEncoder(&entries)
+	c.Assert(enc.Encode([]interface{}{1684318272, map[string]interface{}{"log": "tail line", "host": "web1"}}), IsNil)
+	c.Assert(enc.Encode([]interface{}{1684318273, map[string]interface{}{"log": "next line"}}), IsNil)
+	var compressed bytes.Buffer
+	w := gzip.NewWriter(&compressed)
+	w.Write(entries.Bytes())
+	w.Close()
+
+	message, err := msgpack.Marshal([]interface{}{"app.logs", compressed.Bytes(), map[string]interface{}{"size": 2, "compressed": "gzip", "chunk": "abc"}})
+	c.Assert(err, IsNil)
+
+	conn, err := net.Dial("tcp", addr.String())
+	c.Assert(err, IsNil)
+	_, err = conn.Write(message)
+	c.Assert(err, IsNil)
+
+	logParts := receiveParts(c, channel)
+	c.Check(logParts["message"], Equals, "tail line")
+	c.Check(logParts["hostname"], Equals, "web1")
+	c.Check(logParts["timestamp"], Equals, time.Unix(1684318272, 0).UTC())
+	c.Check(logParts["fluent_tag"], Equals, "app.logs")
+	c.Check(logParts["client"], Equals, conn.LocalAddr().String())
+	logParts = receiveParts(c, channel)
+	c.Check(logParts["message"], Equals, "next line")
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	response, err := msgpack.NewDecoder(conn).DecodeMap()
+	c.Assert(err, IsNil)
+	c.Check(response["ack"], Equals, "abc")
+
+	conn.Close()
+	server.Kill()
+	server.Wait()
+}
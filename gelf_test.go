@@ -0,0 +1,71 @@
+package syslog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *ServerSuite) TestGELF(c *C) {
+	channel := make(LogPartsChannel, 10)
+	server := NewServer()
+	server.SetFormat(GELF)
+	server.SetHandler(NewChannelHandler(channel))
+	udpAddr, err := server.AddListener("udp", "127.0.0.1:0", nil)
+	c.Assert(err, IsNil)
+	tcpAddr, err := server.AddListener("tcp", "127.0.0.1:0", nil)
+	c.Assert(err, IsNil)
+	server.Boot()
+
+	message := `{"version":"1.1","host":"gelfhost","short_message":"over udp","level":3,"timestamp":1385053862,"_app":"web"}`
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	w.Write([]byte(message))
+	w.Close()
+	payload := b.Bytes()
+
+	// Two chunks, the second sent first
+	half := len(payload) / 2
+	chunk := func(seq int, data []byte) []byte {
+		return append([]byte{0x1e, 0x0f, 1, 2, 3, 4, 5, 6, 7, 8, byte(seq), 2}, data...)
+	}
+	udp, err := net.Dial("udp", udpAddr.String())
+	c.Assert(err, IsNil)
+	_, err = udp.Write(chunk(1, payload[half:]))
+	c.Assert(err, IsNil)
+	_, err = udp.Write(chunk(0, payload[:half]))
+	c.Assert(err, IsNil)
+
+	select {
+	case logParts := <-channel:
+		c.Check(logParts["hostname"], Equals, "gelfhost")
+		c.Check(logParts["message"], Equals, "over udp")
+		c.Check(logParts["severity"], Equals, 3)
+		c.Check(logParts["timestamp"], Equals, time.Unix(1385053862, 0).UTC())
+		c.Check(logParts["_app"], Equals, "web")
+		c.Check(logParts["client"], Equals, udp.LocalAddr().String())
+	case <-time.After(5 * time.Second):
+		c.Fatal("timed out waiting for the GELF message")
+	}
+
+	tcp, err := net.Dial("tcp", tcpAddr.String())
+	c.Assert(err, IsNil)
+	_, err = tcp.Write([]byte(`{"version":"1.1","host":"a","short_message":"first"}` + "\x00" + `{"version":"1.1","host":"b","short_message":"second"}` + "\x00"))
+	c.Assert(err, IsNil)
+	for _, expected := range []string{"first", "second"} {
+		select {
+		case logParts := <-channel:
+			c.Check(logParts["message"], Equals, expected)
+		case <-time.After(5 * time.Second):
+			c.Fatal("timed out waiting for the GELF message")
+		}
+	}
+
+	udp.Close()
+	tcp.Close()
+	server.Kill()
+	server.Wait()
+}
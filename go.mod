@@ -2,10 +2,20 @@ module github.com/GLMONTER/go-syslog
 
 go 1.21
 
-require gopkg.in/check.v1 v1.0.0-20201130134442-10cb98267c6c
+require (
+	github.com/pion/dtls/v2 v2.2.12
+	github.com/pion/transport/v2 v2.2.4
+	github.com/vmihailenco/msgpack/v5 v5.4.1
+	golang.org/x/net v0.20.0
+	golang.org/x/sys v0.16.0
+	gopkg.in/check.v1 v1.0.0-20201130134442-10cb98267c6c
+)
 
 require (
 	github.com/kr/pretty v0.3.1 // indirect
 	github.com/kr/text v0.2.0 // indirect
+	github.com/pion/logging v0.2.2 // indirect
 	github.com/rogpeppe/go-internal v1.11.0 // indirect
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
+	golang.org/x/crypto v0.18.0 // indirect
 )
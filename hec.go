@@ -0,0 +1,361 @@
+package syslog
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/GLMONTER/go-syslog/format"
+)
+
+const (
+	headerHECChannel = "X-Splunk-Request-Channel"
+	hecAuthScheme    = "Splunk "
+)
+
+// Status codes of the HEC API, sent along with the HTTP status
+const (
+	hecSuccess        = 0
+	hecTokenRequired  = 2
+	hecInvalidAuth    = 3
+	hecInvalidToken   = 4
+	hecNoData         = 5
+	hecInvalidFormat  = 6
+	hecChannelMissing = 10
+	hecInvalidChannel = 11
+	hecEventRequired  = 12
+	hecEventBlank     = 13
+	hecHealthy        = 17
+)
+
+// SetHECTokens Sets the tokens Splunk HTTP Event Collector clients have to
+// present in their "Authorization: Splunk <token>" header. Without tokens
+// every request is accepted.
+func (s *Server) SetHECTokens(tokens ...string) {
+	s.hecTokens = tokens
+}
+
+// ListenHEC Configure the server for receiving Splunk HTTP Event Collector
+// requests on a TCP addr
+func (s *Server) ListenHEC(addr string) error {
+	_, err := s.AddListener("hec", addr, nil)
+	return err
+}
+
+// ListenHECS Configure the server for receiving Splunk HTTP Event Collector
+// requests on a TCP addr over TLS
+func (s *Server) ListenHECS(addr string, config *tls.Config) error {
+	_, err := s.AddListener("hecs", addr, config)
+	return err
+}
+
+// HECHandler returns a http.Handler implementing the Splunk HTTP Event
+// Collector API, so the server can be mounted on an existing HTTP server.
+//
+// /services/collector/event takes a batch of concatenated JSON events. The
+// event, when a string, or its JSON text otherwise, becomes the "message" and
+// "content", host the "hostname" and time the "timestamp". source,
+// sourcetype, index and the indexed fields keep their name.
+//
+// /services/collector/raw takes lines which are parsed with the server
+// format. The source, sourcetype and index query parameters are added to each
+// of them, the host one replaces their "hostname".
+//
+// Messages carry the channel of the request as "hec_channel". A batch is
+// handed to the handler once it is valid as a whole, so clients can send it
+// again on error.
+func (s *Server) HECHandler() http.Handler {
+	return s.hecHandler(nil)
+}
+
+// hecHandler is the HECHandler of l, which may be nil
+func (s *Server) hecHandler(l *listener) http.Handler {
+	serveRaw := func(w http.ResponseWriter, r *http.Request, channel string) {
+		s.serveHECRaw(l, w, r, channel)
+	}
+	mux := http.NewServeMux()
+	for _, path := range []string{"/services/collector", "/services/collector/event", "/services/collector/event/1.0"} {
+		mux.HandleFunc(path, s.hecRequest(s.serveHECEvent))
+	}
+	for _, path := range []string{"/services/collector/raw", "/services/collector/raw/1.0"} {
+		mux.HandleFunc(path, s.hecRequest(serveRaw))
+	}
+	mux.HandleFunc("/services/collector/health", func(w http.ResponseWriter, r *http.Request) {
+		hecReply(w, http.StatusOK, hecHealthy, "HEC is healthy", -1)
+	})
+	return mux
+}
+
+// hecRequest checks the method, token and channel of a request before
+// handing it to serve
+func (s *Server) hecRequest(serve func(w http.ResponseWriter, r *http.Request, channel string)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		if len(s.hecTokens) > 0 {
+			auth := r.Header.Get("Authorization")
+			if auth == "" {
+				hecReply(w, http.StatusUnauthorized, hecTokenRequired, "Token is required", -1)
+				return
+			}
+			if len(auth) <= len(hecAuthScheme) || !strings.EqualFold(auth[:len(hecAuthScheme)], hecAuthScheme) {
+				hecReply(w, http.StatusUnauthorized, hecInvalidAuth, "Invalid authorization", -1)
+				return
+			}
+			if !s.hecTokenValid(auth[len(hecAuthScheme):]) {
+				hecReply(w, http.StatusForbidden, hecInvalidToken, "Invalid token", -1)
+				return
+			}
+		}
+
+		channel := r.Header.Get(headerHECChannel)
+		if channel == "" {
+			channel = r.URL.Query().Get("channel")
+		}
+		if channel != "" && !validHECChannel(channel) {
+			hecReply(w, http.StatusBadRequest, hecInvalidChannel, "Invalid data channel", -1)
+			return
+		}
+
+		serve(w, r, channel)
+	}
+}
+
+func (s *Server) hecTokenValid(token string) bool {
+	valid := false
+	for _, expected := range s.hecTokens {
+		// Compare with every token so the time taken does not tell which matched
+		if secureCompare(token, expected) {
+			valid = true
+		}
+	}
+	return valid
+}
+
+// validHECChannel tells if channel is a GUID, as HEC channels are
+func validHECChannel(channel string) bool {
+	if len(channel) != 36 {
+		return false
+	}
+	for i, r := range channel {
+		switch i {
+		case 8, 13, 18, 23:
+			if r != '-' {
+				return false
+			}
+		default:
+			if !strings.ContainsRune("0123456789abcdefABCDEF", r) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// hecEvent is an event of the /services/collector/event endpoint
+type hecEvent struct {
+	Time       json.Number                `json:"time"`
+	Host       *string                    `json:"host"`
+	Source     *string                    `json:"source"`
+	Sourcetype *string                    `json:"sourcetype"`
+	Index      *string                    `json:"index"`
+	Event      json.RawMessage            `json:"event"`
+	Fields     map[string]json.RawMessage `json:"fields"`
+}
+
+func (s *Server) serveHECEvent(w http.ResponseWriter, r *http.Request, channel string) {
+	client := r.RemoteAddr
+	body, ok := hecBody(w, r)
+	if !ok {
+		return
+	}
+
+	type parsed struct {
+		logParts format.LogParts
+		length   int64
+	}
+	var events []parsed
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	for {
+		offset := decoder.InputOffset()
+		var event hecEvent
+		err := decoder.Decode(&event)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			s.report(fmt.Errorf("%s: hec: %w", client, err))
+			hecReply(w, http.StatusBadRequest, hecInvalidFormat, "Invalid data format", len(events))
+			return
+		}
+
+		logParts, code, text := hecEventParts(&event, r)
+		if code != hecSuccess {
+			hecReply(w, http.StatusBadRequest, code, text, len(events))
+			return
+		}
+		events = append(events, parsed{logParts, decoder.InputOffset() - offset})
+	}
+	if len(events) == 0 {
+		hecReply(w, http.StatusBadRequest, hecNoData, "No data", -1)
+		return
+	}
+
+	for _, event := range events {
+		s.deliver(event.logParts, event.length, nil, client, "", hecParts(channel))
+	}
+	hecReply(w, http.StatusOK, hecSuccess, "Success", -1)
+}
+
+// hecEventParts maps an event onto the parts of the syslog formats. The
+// query parameters are the defaults of the metadata.
+func hecEventParts(event *hecEvent, r *http.Request) (logParts format.LogParts, code int, text string) {
+	raw := bytes.TrimSpace(event.Event)
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return nil, hecEventRequired, "Event field is required"
+	}
+
+	var message string
+	if raw[0] == '"' {
+		if err := json.Unmarshal(raw, &message); err != nil {
+			return nil, hecInvalidFormat, "Invalid data format"
+		}
+		if message == "" {
+			return nil, hecEventBlank, "Event field cannot be blank"
+		}
+	} else {
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, raw); err != nil {
+			return nil, hecInvalidFormat, "Invalid data format"
+		}
+		message = compact.String()
+	}
+
+	logParts = format.LogParts{}
+	for name, value := range event.Fields {
+		var v interface{}
+		if err := json.Unmarshal(value, &v); err == nil {
+			logParts[name] = v
+		}
+	}
+	logParts["message"] = message
+	logParts["content"] = message
+
+	query := r.URL.Query()
+	metadata := func(name string, value *string) {
+		if value != nil {
+			logParts[name] = *value
+		} else if v := query.Get(name); v != "" {
+			logParts[name] = v
+		}
+	}
+	metadata("host", event.Host)
+	metadata("source", event.Source)
+	metadata("sourcetype", event.Sourcetype)
+	metadata("index", event.Index)
+	if host, ok := logParts["host"]; ok {
+		delete(logParts, "host")
+		logParts["hostname"] = host
+	}
+
+	if event.Time != "" {
+		timestamp, err := format.EpochTime(event.Time.String())
+		if err != nil {
+			return nil, hecInvalidFormat, "Invalid data format"
+		}
+		logParts["timestamp"] = timestamp
+	}
+	return logParts, hecSuccess, ""
+}
+
+func (s *Server) serveHECRaw(l *listener, w http.ResponseWriter, r *http.Request, channel string) {
+	if channel == "" {
+		hecReply(w, http.StatusBadRequest, hecChannelMissing, "Data channel is missing", -1)
+		return
+	}
+
+	body, ok := hecBody(w, r)
+	if !ok {
+		return
+	}
+
+	extra := hecParts(channel)
+	query := r.URL.Query()
+	for _, name := range []string{"source", "sourcetype", "index"} {
+		if v := query.Get(name); v != "" {
+			extra[name] = v
+		}
+	}
+	if host := query.Get("host"); host != "" {
+		extra["hostname"] = host
+	}
+
+	var lines [][]byte
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 0, 64*1024), datagramReadBufferSize)
+	for scanner.Scan() {
+		if line := bytes.TrimRight(scanner.Bytes(), "\r"); len(line) > 0 {
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		s.report(fmt.Errorf("%s: hec: %w", r.RemoteAddr, err))
+		hecReply(w, http.StatusBadRequest, hecInvalidFormat, "Invalid data format", -1)
+		return
+	}
+	if len(lines) == 0 {
+		hecReply(w, http.StatusBadRequest, hecNoData, "No data", -1)
+		return
+	}
+
+	for _, line := range lines {
+		s.parser(l, line, r.RemoteAddr, "", extra)
+	}
+	hecReply(w, http.StatusOK, hecSuccess, "Success", -1)
+}
+
+// hecBody reads the body of a request, replying on error
+func hecBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, httpMaxBodySize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		} else {
+			hecReply(w, http.StatusBadRequest, hecInvalidFormat, "Invalid data format", -1)
+		}
+		return nil, false
+	}
+	return body, true
+}
+
+func hecParts(channel string) format.LogParts {
+	extra := format.LogParts{}
+	if channel != "" {
+		extra["hec_channel"] = channel
+	}
+	return extra
+}
+
+// hecReply sends the JSON status of the HEC API. invalidEvent is the index of
+// the event of a batch which failed, -1 if none.
+func hecReply(w http.ResponseWriter, status int, code int, text string, invalidEvent int) {
+	reply := map[string]interface{}{"text": text, "code": code}
+	if invalidEvent >= 0 {
+		reply["invalid-event-number"] = invalidEvent
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(reply)
+}
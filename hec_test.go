@@ -0,0 +1,127 @@
+package syslog
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+const testHECChannel = "0aeeac95-ac74-4aa9-b30d-6c4c0ac581ba"
+
+func hecRequest(server *Server, path string, token string, body string) (*httptest.ResponseRecorder, map[string]interface{}) {
+	request := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	if token != "" {
+		request.Header.Set("Authorization", "Splunk "+token)
+	}
+	response := httptest.NewRecorder()
+	server.HECHandler().ServeHTTP(response, request)
+
+	var reply map[string]interface{}
+	json.Unmarshal(response.Body.Bytes(), &reply)
+	return response, reply
+}
+
+func (s *ServerSuite) TestHECEvent(c *C) {
+	handler := new(handlerCollector)
+	server := NewServer()
+	server.SetFormat(RFC5424)
+	server.SetHandler(handler)
+	server.SetHECTokens("old-token", "secret")
+
+	body := `{"time": 1426279439.123, "host": "fw1", "sourcetype": "fw", "event": "first event", "fields": {"zone": "dmz", "rule": 12}}
+	{"time": "1426279440", "event": {"action": "deny", "port": 22}}`
+	response, reply := hecRequest(server, "/services/collector/event?channel="+testHECChannel+"&index=network", "secret", body)
+	c.Assert(response.Code, Equals, http.StatusOK)
+	c.Check(reply["code"], Equals, float64(0))
+	c.Assert(handler.logParts, HasLen, 2)
+
+	logParts := handler.logParts[0]
+	c.Check(logParts["message"], Equals, "first event")
+	c.Check(logParts["content"], Equals, "first event")
+	c.Check(logParts["hostname"], Equals, "fw1")
+	c.Check(logParts["sourcetype"], Equals, "fw")
+	c.Check(logParts["index"], Equals, "network")
+	c.Check(logParts["zone"], Equals, "dmz")
+	c.Check(logParts["rule"], Equals, float64(12))
+	c.Check(logParts["timestamp"], Equals, time.Unix(1426279439, 123000000).UTC())
+	c.Check(logParts["hec_channel"], Equals, testHECChannel)
+
+	logParts = handler.logParts[1]
+	c.Check(logParts["message"], Equals, `{"action":"deny","port":22}`)
+	c.Check(logParts["timestamp"], Equals, time.Unix(1426279440, 0).UTC())
+
+	// A batch with an invalid event is rejected as a whole
+	response, reply = hecRequest(server, "/services/collector", "secret", `{"event": "fine"}{"host": "fw1"}`)
+	c.Check(response.Code, Equals, http.StatusBadRequest)
+	c.Check(reply["code"], Equals, float64(12))
+	c.Check(reply["invalid-event-number"], Equals, float64(1))
+	c.Check(handler.logParts, HasLen, 2)
+
+	response, reply = hecRequest(server, "/services/collector", "secret", `{"event": "fine"`)
+	c.Check(response.Code, Equals, http.StatusBadRequest)
+	c.Check(reply["code"], Equals, float64(6))
+
+	response, reply = hecRequest(server, "/services/collector", "secret", "")
+	c.Check(response.Code, Equals, http.StatusBadRequest)
+	c.Check(reply["code"], Equals, float64(5))
+	c.Check(handler.logParts, HasLen, 2)
+}
+
+func (s *ServerSuite) TestHECAuth(c *C) {
+	handler := new(handlerCollector)
+	server := NewServer()
+	server.SetFormat(RFC5424)
+	server.SetHandler(handler)
+	server.SetHECTokens("secret")
+
+	response, reply := hecRequest(server, "/services/collector/event", "", `{"event": "x"}`)
+	c.Check(response.Code, Equals, http.StatusUnauthorized)
+	c.Check(reply["code"], Equals, float64(2))
+
+	response, reply = hecRequest(server, "/services/collector/event", "wrong", `{"event": "x"}`)
+	c.Check(response.Code, Equals, http.StatusForbidden)
+	c.Check(reply["code"], Equals, float64(4))
+
+	response, reply = hecRequest(server, "/services/collector/event?channel=nope", "secret", `{"event": "x"}`)
+	c.Check(response.Code, Equals, http.StatusBadRequest)
+	c.Check(reply["code"], Equals, float64(11))
+
+	response, reply = hecRequest(server, "/services/collector/health", "", "")
+	c.Check(response.Code, Equals, http.StatusOK)
+	c.Check(reply["code"], Equals, float64(17))
+	c.Check(handler.logParts, HasLen, 0)
+}
+
+func (s *ServerSuite) TestHECRaw(c *C) {
+	handler := new(handlerCollector)
+	server := NewServer()
+	server.SetFormat(RFC5424)
+	server.SetHandler(handler)
+	addr, err := server.AddListener("hec", "127.0.0.1:0", nil)
+	c.Assert(err, IsNil)
+	c.Assert(server.Boot(), IsNil)
+
+	url := "http://" + addr.String() + "/services/collector/raw?sourcetype=syslog"
+	response, err := http.Post(url, "text/plain", strings.NewReader(exampleRFC5424Syslog))
+	c.Assert(err, IsNil)
+	response.Body.Close()
+	c.Check(response.StatusCode, Equals, http.StatusBadRequest)
+
+	request, err := http.NewRequest(http.MethodPost, url, strings.NewReader(exampleRFC5424Syslog+"\n"+exampleRFC5424Syslog+"\n"))
+	c.Assert(err, IsNil)
+	request.Header.Set("X-Splunk-Request-Channel", testHECChannel)
+	response, err = http.DefaultClient.Do(request)
+	c.Assert(err, IsNil)
+	response.Body.Close()
+	c.Check(response.StatusCode, Equals, http.StatusOK)
+
+	server.Kill()
+	server.Wait()
+	c.Assert(handler.logParts, HasLen, 2)
+	c.Check(handler.logParts[0]["sourcetype"], Equals, "syslog")
+	c.Check(handler.logParts[0]["hec_channel"], Equals, testHECChannel)
+}
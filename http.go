@@ -0,0 +1,196 @@
+package syslog
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GLMONTER/go-syslog/format"
+)
+
+// Headers set by Logplex style HTTP drains
+const (
+	headerDrainToken = "Logplex-Drain-Token"
+	headerFrameId    = "Logplex-Frame-Id"
+	headerMsgCount   = "Logplex-Msg-Count"
+)
+
+const httpMaxBodySize = 16 * 1024 * 1024
+
+// Limits of the HTTP listeners, so idle or slow clients do not hold their
+// connection forever
+const (
+	httpReadHeaderTimeout = 10 * time.Second
+	httpReadTimeout       = time.Minute
+	httpIdleTimeout       = 2 * time.Minute
+)
+
+// HTTPAuth holds the credentials HTTP clients have to present, either as a
+// bearer token or with basic auth. The zero value accepts every request.
+type HTTPAuth struct {
+	BearerToken string
+	Username    string
+	Password    string
+}
+
+func (a HTTPAuth) check(r *http.Request) bool {
+	if a.BearerToken == "" && a.Username == "" && a.Password == "" {
+		return true
+	}
+
+	if a.BearerToken != "" {
+		if token, ok := bearerToken(r); ok && secureCompare(token, a.BearerToken) {
+			return true
+		}
+	}
+
+	if a.Username != "" || a.Password != "" {
+		if username, password, ok := r.BasicAuth(); ok {
+			// Evaluate both so the time taken does not tell which one is wrong
+			userOk := secureCompare(username, a.Username)
+			passOk := secureCompare(password, a.Password)
+			return userOk && passOk
+		}
+	}
+
+	return false
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	const prefix = "Bearer "
+	auth := r.Header.Get("Authorization")
+	if len(auth) <= len(prefix) || !strings.EqualFold(auth[:len(prefix)], prefix) {
+		return "", false
+	}
+	return auth[len(prefix):], true
+}
+
+func secureCompare(given, expected string) bool {
+	return subtle.ConstantTimeCompare([]byte(given), []byte(expected)) == 1
+}
+
+// SetHTTPAuth Sets the credentials required from HTTP clients
+func (s *Server) SetHTTPAuth(auth HTTPAuth) {
+	s.httpAuth = auth
+}
+
+// ListenHTTP Configure the server for receiving Logplex style HTTP drains on a TCP addr
+func (s *Server) ListenHTTP(addr string) error {
+	_, err := s.AddListener("http", addr, nil)
+	return err
+}
+
+// ListenHTTPS Configure the server for receiving Logplex style HTTP drains on a TCP addr over TLS
+func (s *Server) ListenHTTPS(addr string, config *tls.Config) error {
+	_, err := s.AddListener("https", addr, config)
+	return err
+}
+
+// HTTPHandler returns a http.Handler accepting Logplex style drains, so the
+// server can be mounted on an existing HTTP server. The body of every POST
+// holds RFC6587 octet counted frames, each of them parsed with the server
+// format. The drain token and frame id headers end up in every message as
+// "drain_token" and "frame_id". The frames are handed to the handler once the
+// whole body was read, so drains can send it again on error.
+func (s *Server) HTTPHandler() http.Handler {
+	return s.httpHandler(nil)
+}
+
+// httpHandler is the HTTPHandler of l, which may be nil
+func (s *Server) httpHandler(l *listener) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.serveHTTP(l, w, r)
+	})
+}
+
+func (s *Server) serveHTTP(l *listener, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !s.httpAuth.check(r) {
+		if s.httpAuth.Username != "" || s.httpAuth.Password != "" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="syslog"`)
+		} else {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="syslog"`)
+		}
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	extra := format.LogParts{
+		"drain_token": r.Header.Get(headerDrainToken),
+		"frame_id":    r.Header.Get(headerFrameId),
+	}
+
+	client := r.RemoteAddr
+	report := func(err error) {
+		s.report(fmt.Errorf("%s: %w", client, err))
+	}
+
+	framer := RFC6587.GetFramer(report)
+	framer.FitBuffer(datagramReadBufferSize)
+
+	scanner := bufio.NewScanner(http.MaxBytesReader(w, r.Body, httpMaxBodySize))
+	scanner.Buffer(make([]byte, 0, 64*1024), datagramReadBufferSize)
+	scanner.Split(framer.Split)
+
+	// Drains send the whole body again on error, so none of it is
+	// delivered unless all of it is valid
+	var frames [][]byte
+	for scanner.Scan() {
+		frames = append(frames, []byte(scanner.Text()))
+	}
+
+	if err := scanner.Err(); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+			return
+		}
+		report(err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	if expected := r.Header.Get(headerMsgCount); expected != "" {
+		if n, err := strconv.Atoi(expected); err != nil || n != len(frames) {
+			report(fmt.Errorf("%s header says %s messages, body held %d", headerMsgCount, expected, len(frames)))
+		}
+	}
+
+	for _, frame := range frames {
+		s.parser(l, frame, client, "", extra)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) goServeHTTP(l *listener) {
+	handler := l.handler
+	if handler == nil {
+		handler = s.httpHandler(l)
+	}
+	server := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: httpReadHeaderTimeout,
+		ReadTimeout:       httpReadTimeout,
+		IdleTimeout:       httpIdleTimeout,
+	}
+	l.http = server
+	listener := l.stream
+
+	s.spawn(l, func() {
+		err := server.Serve(listener)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.report(err)
+		}
+	})
+}
@@ -0,0 +1,123 @@
+package syslog
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing/iotest"
+
+	"github.com/GLMONTER/go-syslog/format"
+	. "gopkg.in/check.v1"
+)
+
+type handlerCollector struct {
+	logParts []format.LogParts
+}
+
+func (h *handlerCollector) Handle(logParts format.LogParts, msgLen int64, err error) {
+	h.logParts = append(h.logParts, logParts)
+}
+
+func logplexBody(messages ...string) string {
+	var body strings.Builder
+	for _, message := range messages {
+		fmt.Fprintf(&body, "%d %s", len(message), message)
+	}
+	return body.String()
+}
+
+func (s *ServerSuite) TestHTTPDrain(c *C) {
+	handler := new(handlerCollector)
+	server := NewServer()
+	server.SetFormat(RFC5424)
+	server.SetHandler(handler)
+	server.SetHTTPAuth(HTTPAuth{BearerToken: "secret"})
+
+	second := "<190>1 2024-02-01T10:00:00+00:00 host app web.1 - second"
+	body := logplexBody(exampleRFC5424Syslog, second)
+	request := httptest.NewRequest(http.MethodPost, "/logs", strings.NewReader(body))
+	request.Header.Set("Authorization", "Bearer secret")
+	request.Header.Set("Logplex-Msg-Count", "2")
+	request.Header.Set("Logplex-Frame-Id", "09C557EAFCFB6CF2740EE62F62971098")
+	request.Header.Set("Logplex-Drain-Token", "d.8bf587ab-4c1e-4b1e-9e5f-3b8c5d3e2e1a")
+	response := httptest.NewRecorder()
+
+	server.HTTPHandler().ServeHTTP(response, request)
+
+	c.Assert(response.Code, Equals, http.StatusNoContent)
+	c.Assert(handler.logParts, HasLen, 2)
+	c.Check(handler.logParts[0]["hostname"], Equals, "mymachine.example.com")
+	c.Check(handler.logParts[1]["app_name"], Equals, "app")
+	for _, logParts := range handler.logParts {
+		c.Check(logParts["drain_token"], Equals, "d.8bf587ab-4c1e-4b1e-9e5f-3b8c5d3e2e1a")
+		c.Check(logParts["frame_id"], Equals, "09C557EAFCFB6CF2740EE62F62971098")
+	}
+}
+
+func (s *ServerSuite) TestHTTPDrainAuth(c *C) {
+	handler := new(handlerCollector)
+	server := NewServer()
+	server.SetFormat(RFC5424)
+	server.SetHandler(handler)
+	server.SetHTTPAuth(HTTPAuth{Username: "user", Password: "pass"})
+
+	body := logplexBody(exampleRFC5424Syslog)
+
+	request := httptest.NewRequest(http.MethodPost, "/logs", strings.NewReader(body))
+	request.SetBasicAuth("user", "wrong")
+	response := httptest.NewRecorder()
+	server.HTTPHandler().ServeHTTP(response, request)
+	c.Check(response.Code, Equals, http.StatusUnauthorized)
+	c.Check(response.Header().Get("WWW-Authenticate"), Equals, `Basic realm="syslog"`)
+
+	request = httptest.NewRequest(http.MethodGet, "/logs", nil)
+	response = httptest.NewRecorder()
+	server.HTTPHandler().ServeHTTP(response, request)
+	c.Check(response.Code, Equals, http.StatusMethodNotAllowed)
+
+	request = httptest.NewRequest(http.MethodPost, "/logs", strings.NewReader(body))
+	request.SetBasicAuth("user", "pass")
+	response = httptest.NewRecorder()
+	server.HTTPHandler().ServeHTTP(response, request)
+	c.Check(response.Code, Equals, http.StatusNoContent)
+	c.Check(handler.logParts, HasLen, 1)
+}
+
+func (s *ServerSuite) TestHTTPDrainBrokenBody(c *C) {
+	handler := new(handlerCollector)
+	server := NewServer()
+	server.SetFormat(RFC5424)
+	server.SetHandler(handler)
+
+	// The drain sends the frames delivered before the error again
+	body := io.MultiReader(strings.NewReader(logplexBody(exampleRFC5424Syslog)), iotest.ErrReader(errors.New("connection reset")))
+	request := httptest.NewRequest(http.MethodPost, "/logs", body)
+	response := httptest.NewRecorder()
+	server.HTTPHandler().ServeHTTP(response, request)
+	c.Check(response.Code, Equals, http.StatusBadRequest)
+	c.Check(handler.logParts, HasLen, 0)
+}
+
+func (s *ServerSuite) TestListenHTTP(c *C) {
+	handler := new(handlerCollector)
+	server := NewServer()
+	server.SetFormat(RFC5424)
+	server.SetHandler(handler)
+	err := server.ListenHTTP("127.0.0.1:0")
+	c.Assert(err, IsNil)
+	err = server.Boot()
+	c.Assert(err, IsNil)
+
+	url := "http://" + server.entries[0].Addr().String() + "/"
+	response, err := http.Post(url, "application/logplex-1", strings.NewReader(logplexBody(exampleRFC5424Syslog)))
+	c.Assert(err, IsNil)
+	response.Body.Close()
+	c.Check(response.StatusCode, Equals, http.StatusNoContent)
+
+	server.Kill()
+	server.Wait()
+	c.Check(handler.logParts, HasLen, 1)
+}
@@ -0,0 +1,107 @@
+package syslog
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/GLMONTER/go-syslog/format"
+)
+
+// IngestOptions configure the ingestion of a stream by IngestReader or
+// ListenReader
+type IngestOptions struct {
+	// Source names the stream. Messages carry it as "source", and the
+	// listener of ListenReader is known by it.
+	Source string
+}
+
+// IngestReader parses the messages of r, a file, stdin or a pipe, with the
+// split function and parser of the server format and hands them to the
+// handler, as they would be if received on a connection. It returns once r
+// ends. The server does not need to be booted.
+func (s *Server) IngestReader(r io.Reader, opts IngestOptions) error {
+	if s.format == nil {
+		return errors.New("please set a valid format")
+	}
+	if s.handler == nil {
+		return errors.New("please set a valid handler")
+	}
+	return s.ingest(nil, r, "", sourceParts(opts), nil)
+}
+
+// ListenReader Configure the server for ingesting r as IngestReader does, from
+// Boot on. The listener is known by the source name, "reader" if none, to
+// RemoveListener. Stopping it closes r if it is an io.Closer, otherwise waits
+// for its next message. Once r ended or was stopped, Boot after Kill leaves
+// it out.
+func (s *Server) ListenReader(r io.Reader, opts IngestOptions) error {
+	name := opts.Source
+	if name == "" {
+		name = "reader"
+	}
+	l := &listener{
+		kind:      readerListener,
+		network:   "reader",
+		requested: name,
+		open: func(l *listener, addr string, reopen bool) error {
+			l.reader = r
+			return nil
+		},
+		ingest: opts,
+	}
+	return s.addListener(l)
+}
+
+// goIngest ingests the reader of l until it ends or l stops
+func (s *Server) goIngest(l *listener) {
+	l.mu.Lock()
+	exhausted := l.exhausted
+	l.mu.Unlock()
+	if exhausted {
+		return
+	}
+
+	reader, extra, done := l.reader, sourceParts(l.ingest), l.done
+	s.spawn(l, func() {
+		err := s.ingest(l, reader, "", extra, done)
+
+		l.mu.Lock()
+		l.exhausted = true
+		l.mu.Unlock()
+
+		select {
+		case <-done:
+			// Reading a closed reader fails
+		default:
+			if err != nil {
+				s.report(fmt.Errorf("%s: %w", l.requested, err))
+			}
+		}
+	})
+}
+
+// ingest delivers the messages client sent on r, read by l which may be nil,
+// until it ends or done is closed
+func (s *Server) ingest(l *listener, r io.Reader, client string, extra format.LogParts, done chan bool) error {
+	scanner, splitter := s.newScanner(r, client)
+	scanCloser := &ScanCloser{scanner, nil, splitter}
+
+	for scanCloser.Scan() {
+		s.parser(l, []byte(scanCloser.Text()), client, "", scanCloser.frameParts(extra))
+
+		select {
+		case <-done:
+			return ErrListenerStopped
+		default:
+		}
+	}
+	return scanCloser.Err()
+}
+
+func sourceParts(opts IngestOptions) format.LogParts {
+	if opts.Source == "" {
+		return nil
+	}
+	return format.LogParts{"source": opts.Source}
+}
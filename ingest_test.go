@@ -0,0 +1,50 @@
+package syslog
+
+import (
+	"io"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *ServerSuite) TestIngestReader(c *C) {
+	handler := new(handlerCollector)
+	server := NewServer()
+	server.SetFormat(RFC5424)
+	server.SetHandler(handler)
+
+	input := strings.NewReader(exampleRFC5424Syslog + "\n" + exampleRFC5424Syslog + "\n")
+	err := server.IngestReader(input, IngestOptions{Source: "export.log"})
+	c.Assert(err, IsNil)
+	c.Assert(handler.logParts, HasLen, 2)
+	c.Check(handler.logParts[0]["source"], Equals, "export.log")
+	c.Check(handler.logParts[1]["hostname"], Equals, "mymachine.example.com")
+
+	err = NewServer().IngestReader(input, IngestOptions{})
+	c.Check(err, ErrorMatches, "please set a valid format")
+}
+
+func (s *ServerSuite) TestListenReader(c *C) {
+	channel := make(LogPartsChannel, 10)
+	server := NewServer()
+	server.SetFormat(RFC5424)
+	server.SetHandler(NewChannelHandler(channel))
+
+	reader, writer := io.Pipe()
+	err := server.ListenReader(reader, IngestOptions{Source: "stdin"})
+	c.Assert(err, IsNil)
+	c.Assert(server.Boot(), IsNil)
+
+	_, err = io.WriteString(writer, exampleRFC5424Syslog+"\n")
+	c.Assert(err, IsNil)
+	logParts := receiveParts(c, channel)
+	c.Check(logParts["source"], Equals, "stdin")
+
+	// Removing the listener closes the pipe
+	c.Assert(server.RemoveListener("stdin"), IsNil)
+	_, err = io.WriteString(writer, exampleRFC5424Syslog+"\n")
+	c.Check(err, Equals, io.ErrClosedPipe)
+
+	server.Kill()
+	server.Wait()
+}
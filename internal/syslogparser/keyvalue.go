@@ -0,0 +1,80 @@
+package syslogparser
+
+import "strings"
+
+// ParseKeyValues returns the key=value pairs of s. Pairs are separated by any
+// of pairSeparators, keys from their value by any of valueSeparators. Values
+// may be quoted with " or ', a backslash escaping the next character within
+// the quotes. Spaces around unquoted values are trimmed, unless they separate
+// pairs, and a key is the last word before its separator. Words which are not
+// pairs are skipped, and the last value of a key repeated wins.
+func ParseKeyValues(s string, pairSeparators string, valueSeparators string) map[string]string {
+	pairs := map[string]string{}
+	isPair := func(c byte) bool { return strings.IndexByte(pairSeparators, c) >= 0 }
+	isValue := func(c byte) bool { return strings.IndexByte(valueSeparators, c) >= 0 }
+
+	for i := 0; i < len(s); {
+		if isPair(s[i]) {
+			i++
+			continue
+		}
+
+		start := i
+		for i < len(s) && !isPair(s[i]) && !isValue(s[i]) {
+			if s[i] == '"' || s[i] == '\'' {
+				// A quoted word, which is no key
+				_, i = quotedValue(s, i)
+				continue
+			}
+			i++
+		}
+		if i == len(s) || isPair(s[i]) {
+			continue
+		}
+		key := strings.TrimSpace(s[start:i])
+		if j := strings.LastIndexAny(key, " \t"); j >= 0 {
+			key = key[j+1:]
+		}
+		i++
+		for i < len(s) && (s[i] == ' ' || s[i] == '\t') && !isPair(s[i]) {
+			i++
+		}
+
+		var value string
+		if i < len(s) && (s[i] == '"' || s[i] == '\'') {
+			value, i = quotedValue(s, i)
+		} else {
+			from := i
+			for i < len(s) && !isPair(s[i]) {
+				i++
+			}
+			value = strings.TrimSpace(s[from:i])
+		}
+		if key != "" && !strings.ContainsAny(key, `"'`) {
+			pairs[key] = value
+		}
+	}
+	return pairs
+}
+
+// quotedValue returns the value quoted at i, without its quotes and escapes,
+// and the index past its closing quote. An unterminated value runs to the end
+// of s.
+func quotedValue(s string, i int) (string, int) {
+	quote := s[i]
+	var b strings.Builder
+	for i++; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+			}
+			b.WriteByte(s[i])
+		case quote:
+			return b.String(), i + 1
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String(), i
+}
@@ -0,0 +1,248 @@
+package rfc3164
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const CiscoASATimestampRePattern = `^<\d+>:(?:(\w{3} +\d{1,2}(?: \d{4})? \d{2}:\d{2}:\d{2})(?: ([A-Za-z]{2,5}))?:? )?`
+
+var ciscoASATimestampCaptureRe = regexp.MustCompile(CiscoASATimestampRePattern)
+
+const ciscoASAPriorityFormat = `<\d+>:`
+
+var ciscoASARegexp = regexp.MustCompile(ciscoASAPriorityFormat)
+
+// ciscoZones are the offsets of the time zone abbreviations ASA and IOS
+// timestamps may end with. Timestamps with other zones are taken in the
+// location of the parser, their zone kept as "asa_timezone" or "ios_timezone".
+var ciscoZones = map[string]int{
+	"UTC":  0,
+	"GMT":  0,
+	"EST":  -5 * 3600,
+	"EDT":  -4 * 3600,
+	"CST":  -6 * 3600,
+	"CDT":  -5 * 3600,
+	"MST":  -7 * 3600,
+	"MDT":  -6 * 3600,
+	"PST":  -8 * 3600,
+	"PDT":  -7 * 3600,
+	"AKST": -9 * 3600,
+	"AKDT": -8 * 3600,
+	"HST":  -10 * 3600,
+	"WET":  0,
+	"WEST": 1 * 3600,
+	"BST":  1 * 3600,
+	"CET":  1 * 3600,
+	"CEST": 2 * 3600,
+	"EET":  2 * 3600,
+	"EEST": 3 * 3600,
+	"MSK":  3 * 3600,
+	"JST":  9 * 3600,
+	"KST":  9 * 3600,
+	"AEST": 10 * 3600,
+	"AEDT": 11 * 3600,
+	"NZST": 12 * 3600,
+	"NZDT": 13 * 3600,
+}
+
+// Cisco ASA firewalls have their priority/timestamp like <166>:Apr 04 19:28:05 EDT
+func detectCiscoASA(buff []byte) bool {
+	return ciscoASARegexp.Match(buff)
+}
+
+func parseCiscoASA(buff []byte, location *time.Location) (map[string]interface{}, error) {
+	//Cisco ASA log, do a regex parse because it is not standard
+	//example log : <166>:Apr 04 19:28:05 EDT: %ASA-session-6-106100: access-list outside_access_in permitted tcp outside/125.252.156.24(57274) -> NEX-DMZ/10.58.1.552(443) hit-cnt 1 first hit [0x8fca8d4d, 0xf3808cf3]
+	parts := ciscoASAMessage(string(buff))
+
+	match := ciscoASATimestampCaptureRe.FindStringSubmatch(string(buff))
+	if match == nil || match[1] == "" {
+		return parts, nil
+	}
+	timestamp, zone := strings.Join(strings.Fields(match[1]), " "), match[2]
+
+	if zone != "" {
+		if offset, ok := ciscoZones[strings.ToUpper(zone)]; ok {
+			location = time.FixedZone(strings.ToUpper(zone), offset)
+		} else {
+			parts["asa_timezone"] = zone
+		}
+	}
+
+	potentialLayouts := []string{
+		"Jan 2 15:04:05",
+		"Jan 2 2006 15:04:05",
+	}
+
+	var parsedTime time.Time
+	var err error
+	for _, layout := range potentialLayouts {
+		parsedTime, err = time.ParseInLocation(layout, timestamp, location)
+		if err == nil {
+			fixTimestampIfNeeded(&parsedTime)
+			break
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse time in Cisco ASA log: %v : %s", err, string(buff))
+	}
+
+	parts["timestamp"] = parsedTime
+	return parts, nil
+}
+
+const ciscoASA_RFC5424Format = `^<\d+>(\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(?:\.\d+)?Z)`
+
+var ciscoASA_RFC5424Regexp = regexp.MustCompile(ciscoASA_RFC5424Format)
+
+func detectCiscoASA_RFC5424(buff []byte) bool {
+	return ciscoASA_RFC5424Regexp.Match(buff)
+}
+
+func parseCiscoASA_RFC5424(buff []byte, location *time.Location) (map[string]interface{}, error) {
+	//example log : <166>2018-06-27T12:17:46Z asa : %ASA-6-110002: Failed to locate egress interface for protocol from src interface :src IP/src port to dest IP/dest port
+	match := ciscoASA_RFC5424Regexp.FindStringSubmatch(string(buff))
+	if match != nil && len(match) > 1 {
+		timestampStr := match[1]
+		var parsedTime time.Time
+		var err error
+		if strings.Contains(timestampStr, ".") {
+			parsedTime, err = time.Parse(time.RFC3339Nano, timestampStr)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse cisco ASA RFC5424 dot timestamp: %v", err)
+			}
+		} else {
+			parsedTime, err = time.Parse(time.RFC3339, timestampStr)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse cisco ASA RFC5424 timestamp: %v", err)
+			}
+		}
+
+		fixTimestampIfNeeded(&parsedTime)
+		parts := ciscoASAMessage(string(buff))
+		parts["timestamp"] = parsedTime
+		return parts, nil
+	}
+	return nil, fmt.Errorf("failed to parse cisco ASA RFC5424 timestamp: %v", "no match")
+}
+
+// ciscoASAMessageRegexp matches the %ASA-class-severity-id: token, FTD,
+// FWSM and PIX devices sending the same messages
+var ciscoASAMessageRegexp = regexp.MustCompile(`%(ASA|FTD|FWSM|PIX)-(?:([A-Za-z_]+)-)?([0-7])-(\d{6}): ?(.*)$`)
+
+// ciscoASAFields extract the fields of the most common messages, by message
+// number. Each name is the field of the submatch at its index, empty ones
+// being skipped.
+var ciscoASAFields = map[int]struct {
+	re    *regexp.Regexp
+	names []string
+}{
+	// access-list outside_access_in permitted tcp outside/10.0.0.1(57274) -> dmz/10.0.1.5(443) hit-cnt 1 first hit [0x8fca8d4d, 0xf3808cf3]
+	106100: {
+		regexp.MustCompile(`^access-list (\S+) (\S+) (\S+) ([^/\s]+)/(\S+?)\((\d+)\)(?:\(([^)]*)\))? -> ([^/\s]+)/(\S+?)\((\d+)\)(?:\(([^)]*)\))? hit-cnt (\d+)`),
+		[]string{"", "acl", "action", "protocol", "src_interface", "src_ip", "src_port", "src_user", "dst_interface", "dst_ip", "dst_port", "dst_user", "hit_count"},
+	},
+	// Deny tcp src outside:203.0.113.5/4444 dst inside:192.168.1.10/22 by access-group "outside_access_in" [0x0, 0x0]
+	106023: {
+		regexp.MustCompile(`^(Deny) (\S+) src ([^:\s]+):([^/\s]+)(?:/(\d+))?(?:\(([^)]*)\))? dst ([^:\s]+):([^/\s]+)(?:/(\d+))?(?:\(([^)]*)\))?.* by access-group "([^"]*)"`),
+		[]string{"", "action", "protocol", "src_interface", "src_ip", "src_port", "src_user", "dst_interface", "dst_ip", "dst_port", "dst_user", "acl"},
+	},
+	// AAA user authentication Successful : server =  10.1.1.1 : user = jdoe
+	113004: {
+		regexp.MustCompile(`^AAA user (\S+) (Successful) : server = +(\S+) : user = (\S+)`),
+		[]string{"", "aaa_type", "action", "server", "user"},
+	},
+	// AAA user authentication Rejected : reason = AAA failure : server = 10.1.1.1 : user = jdoe : user IP = 10.0.0.9
+	113005: {
+		regexp.MustCompile(`^AAA user (\S+) (Rejected) : reason = (.*?) : server = +(\S+) : user = (\S+?)(?: : user IP = (\S+))?$`),
+		[]string{"", "aaa_type", "action", "reason", "server", "user", "src_ip"},
+	},
+	// Group = VPN, Username = jdoe, IP = 203.0.113.9, Session disconnected. Session Type: SSL, Duration: 1h:02m:03s, Bytes xmt: 12345, Bytes rcv: 6789, Reason: User Requested
+	113019: {
+		regexp.MustCompile(`^Group = (.*?), Username = (.*?), IP = (\S+), Session disconnected\. Session Type: (.*?), Duration: (\S+), Bytes xmt: (\d+), Bytes rcv: (\d+), Reason: (.*)$`),
+		[]string{"", "group", "user", "src_ip", "session_type", "duration", "bytes_sent", "bytes_received", "reason"},
+	},
+	// Built inbound TCP connection 1234 for outside:10.0.0.1/443 (10.0.0.1/443) to inside:192.168.1.10/51234 (203.0.113.5/51234)
+	302013: ciscoASABuilt,
+	302015: ciscoASABuilt,
+	// Teardown TCP connection 1234 for outside:10.0.0.1/443 to inside:192.168.1.10/51234 duration 0:00:30 bytes 1234 TCP FINs
+	302014: ciscoASATeardown,
+	302016: ciscoASATeardown,
+	// Built dynamic TCP translation from inside:192.168.1.10/51234 to outside:203.0.113.5/51234
+	305011: ciscoASATranslation,
+	// Teardown dynamic TCP translation from inside:192.168.1.10/51234 to outside:203.0.113.5/51234 duration 0:00:30
+	305012: ciscoASATranslation,
+}
+
+var (
+	ciscoASABuilt = struct {
+		re    *regexp.Regexp
+		names []string
+	}{
+		regexp.MustCompile(`^(Built) (inbound|outbound) (\S+) connection (\d+) for ([^:\s]+):([^/\s]+)/(\d+) \(([^/\s]+)/(\d+)\)(?:\(([^)]*)\))? to ([^:\s]+):([^/\s]+)/(\d+) \(([^/\s]+)/(\d+)\)(?:\(([^)]*)\))?`),
+		[]string{"", "action", "direction", "protocol", "connection_id", "src_interface", "src_ip", "src_port", "src_mapped_ip", "src_mapped_port", "src_user", "dst_interface", "dst_ip", "dst_port", "dst_mapped_ip", "dst_mapped_port", "dst_user"},
+	}
+	ciscoASATeardown = struct {
+		re    *regexp.Regexp
+		names []string
+	}{
+		regexp.MustCompile(`^(Teardown) (\S+) connection (\d+) for ([^:\s]+):([^/\s]+)/(\d+)(?:\(([^)]*)\))? to ([^:\s]+):([^/\s]+)/(\d+)(?:\(([^)]*)\))? duration (\S+) bytes (\d+)(?: (.*))?$`),
+		[]string{"", "action", "protocol", "connection_id", "src_interface", "src_ip", "src_port", "src_user", "dst_interface", "dst_ip", "dst_port", "dst_user", "duration", "bytes", "reason"},
+	}
+	ciscoASATranslation = struct {
+		re    *regexp.Regexp
+		names []string
+	}{
+		regexp.MustCompile(`^(Built|Teardown) (\S+) (\S+) translation from ([^:\s]+):([^/\s]+)(?:/(\d+))?(?:\(([^)]*)\))? to ([^:\s]+):([^/\s]+)(?:/(\d+))?(?: duration (\S+))?`),
+		[]string{"", "action", "translation", "protocol", "src_interface", "src_ip", "src_port", "src_user", "mapped_interface", "mapped_ip", "mapped_port", "duration"},
+	}
+)
+
+// ciscoASAMessage decodes the %ASA-class-severity-id: token of message into
+// "asa_facility", "asa_class", "asa_severity" and "asa_message_id", and the
+// fields of the messages known into "fields". The source and destination of
+// connections are the first and second address of the message, "direction"
+// telling which side initiated built connections.
+func ciscoASAMessage(message string) map[string]interface{} {
+	parts := map[string]interface{}{}
+	match := ciscoASAMessageRegexp.FindStringSubmatch(message)
+	if match == nil {
+		return parts
+	}
+
+	severity, _ := strconv.Atoi(match[3])
+	id, _ := strconv.Atoi(match[4])
+	parts["asa_facility"] = match[1]
+	if match[2] != "" {
+		parts["asa_class"] = match[2]
+	}
+	parts["asa_severity"] = severity
+	parts["asa_message_id"] = id
+
+	known, ok := ciscoASAFields[id]
+	if !ok {
+		return parts
+	}
+	values := known.re.FindStringSubmatch(strings.TrimSpace(match[5]))
+	if values == nil {
+		return parts
+	}
+	fields := map[string]string{}
+	for i, name := range known.names {
+		if name != "" && values[i] != "" {
+			fields[name] = values[i]
+		}
+	}
+	if action, ok := fields["action"]; ok {
+		fields["action"] = strings.ToLower(action)
+	}
+	if protocol, ok := fields["protocol"]; ok {
+		fields["protocol"] = strings.ToLower(protocol)
+	}
+	parts["fields"] = fields
+	return parts
+}
@@ -0,0 +1,136 @@
+package rfc3164
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ciscoIOSRegexp matches the IOS and NX-OS messages: an optional sequence
+// number and host name, an optional time sync marker, the date, or uptime, an
+// optional time zone and the %FACILITY-SEVERITY-MNEMONIC token
+var ciscoIOSRegexp = regexp.MustCompile(`^<\d{1,3}>(?:(\d*): )?(?:([^\s:*.][^\s:]*): )?([*.])?` +
+	`(\d{4} [A-Z][a-z]{2} +\d{1,2} \d{2}:\d{2}:\d{2}(?:\.\d{1,6})?|[A-Z][a-z]{2} +\d{1,2}(?: \d{4})? \d{2}:\d{2}:\d{2}(?:\.\d{1,6})?|\d+w\d+d|\d+d\d+h|\d{2}:\d{2}:\d{2}(?:\.\d{1,6})?)` +
+	`(?: ([A-Za-z]{2,5}))?: %([A-Z0-9_]+(?:-[A-Z0-9_]+)*?)-([0-7])-([A-Z0-9_]+):`)
+
+// ciscoIOSTimeSync are the meanings of the markers before the date
+var ciscoIOSTimeSync = map[string]string{
+	"":  "synchronized",
+	"*": "not_synchronized",
+	".": "sync_lost",
+}
+
+// ciscoIOSHeaderLength bounds the header before the %FACILITY-SEVERITY-MNEMONIC
+// token: the sequence number, host name, marker, date and zone
+const ciscoIOSHeaderLength = 128
+
+var ciscoIOSToken = []byte(": %")
+
+// ciscoIOSPrefix tells cheaply if buff may be a Cisco IOS message, so the
+// regular expression is not run on every RFC3164 message the dialect claims
+func ciscoIOSPrefix(buff []byte) bool {
+	i := bytes.IndexByte(buff, '>')
+	if i < 0 {
+		return false
+	}
+	rest := buff[i+1:]
+	if len(rest) > 0 && (rest[0] == '*' || rest[0] == '.') {
+		return true
+	}
+	digits := 0
+	for digits < len(rest) && rest[digits] >= '0' && rest[digits] <= '9' {
+		digits++
+	}
+	if bytes.HasPrefix(rest[digits:], []byte(": ")) {
+		return true
+	}
+	// Without sequence number, the token has to follow the header
+	return bytes.Contains(rest[:min(len(rest), ciscoIOSHeaderLength)], ciscoIOSToken)
+}
+
+// Cisco IOS and NX-OS devices have their sequence number/timestamp like
+// <189>123: *Mar  1 18:46:11.123 UTC: %SYS-5-CONFIG_I: Configured from console
+func detectCiscoIOS(buff []byte) bool {
+	if !ciscoIOSPrefix(buff) {
+		return false
+	}
+	match := ciscoIOSRegexp.FindSubmatch(buff)
+	if match == nil {
+		return false
+	}
+	// Left to the ASA dialects
+	switch string(match[6]) {
+	case "ASA", "FTD", "FWSM", "PIX":
+		return false
+	}
+	return true
+}
+
+func parseCiscoIOS(buff []byte, location *time.Location) (map[string]interface{}, error) {
+	//Cisco IOS log, the date is the one of "service timestamps log datetime", or the uptime
+	//example log : <189>123: router1: *Mar  1 18:46:11.123 UTC: %SYS-5-CONFIG_I: Configured from console by vty0 (10.0.0.5)
+	//example log : <189>: 2024 Mar  1 18:46:11 UTC: %ETHPORT-5-IF_DOWN_LINK_FAILURE: Interface Ethernet1/1 is down (Link failure)
+	match := ciscoIOSRegexp.FindStringSubmatch(string(buff))
+	if match == nil {
+		return nil, fmt.Errorf("failed to parse Cisco IOS log: %s", string(buff))
+	}
+	sequence, hostname, marker, timestamp, zone := match[1], match[2], match[3], match[4], match[5]
+
+	severity, _ := strconv.Atoi(match[7])
+	parts := map[string]interface{}{
+		"ios_facility": match[6],
+		"ios_severity": severity,
+		"ios_mnemonic": match[8],
+	}
+	if sequence != "" {
+		n, err := strconv.ParseUint(sequence, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse sequence number in Cisco IOS log: %v : %s", err, string(buff))
+		}
+		parts["ios_sequence"] = n
+	}
+	if hostname != "" {
+		parts["hostname"] = hostname
+	}
+
+	if !strings.Contains(timestamp, " ") {
+		// The uptime, the device clock being unset
+		parts["ios_uptime"] = timestamp
+		return parts, nil
+	}
+	parts["ios_time_sync"] = ciscoIOSTimeSync[marker]
+
+	if zone != "" {
+		if offset, ok := ciscoZones[strings.ToUpper(zone)]; ok {
+			location = time.FixedZone(strings.ToUpper(zone), offset)
+		} else {
+			parts["ios_timezone"] = zone
+		}
+	}
+
+	potentialLayouts := []string{
+		"Jan 2 15:04:05",
+		"Jan 2 2006 15:04:05",
+		"2006 Jan 2 15:04:05",
+	}
+
+	timestamp = strings.Join(strings.Fields(timestamp), " ")
+	var parsedTime time.Time
+	var err error
+	for _, layout := range potentialLayouts {
+		parsedTime, err = time.ParseInLocation(layout, timestamp, location)
+		if err == nil {
+			fixTimestampIfNeeded(&parsedTime)
+			break
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse time in Cisco IOS log: %v : %s", err, string(buff))
+	}
+
+	parts["timestamp"] = parsedTime
+	return parts, nil
+}
@@ -0,0 +1,170 @@
+package rfc3164
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/GLMONTER/go-syslog/internal/syslogparser"
+)
+
+// Dialect parses the messages of a device which do not follow RFC3164. The
+// parser tries the dialects, highest Priority first, on messages whose header
+// has no RFC3164 timestamp.
+type Dialect struct {
+	Name     string
+	Priority int
+	// Claim has the dialect tried before the header too, for messages which
+	// start like a RFC3164 one
+	Claim bool
+	// Detect tells if buff, priority included, is of the dialect
+	Detect func(buff []byte) bool
+	// Parse returns the parts of buff. "timestamp", "hostname", "tag" and
+	// "content" replace the ones of the parser, the other parts are added.
+	Parse func(buff []byte, location *time.Location) (map[string]interface{}, error)
+}
+
+var (
+	dialectsMu sync.RWMutex
+	// dialects are the registered dialects, highest priority first. The
+	// slice is replaced, never changed, so parsers share it.
+	dialects = []Dialect{
+		{Name: "cisco-ios", Priority: 450, Claim: true, Detect: detectCiscoIOS, Parse: parseCiscoIOS},
+		{Name: "cisco-asa", Priority: 400, Detect: detectCiscoASA, Parse: parseCiscoASA},
+		{Name: "sonicwall", Priority: 300, Detect: detectSonicWall, Parse: parseSonicWall},
+		{Name: "fortios", Priority: 200, Detect: detectFortiOS, Parse: parseFortiOS},
+		{Name: "cisco-asa-rfc5424", Priority: 100, Detect: detectCiscoASA_RFC5424, Parse: parseCiscoASA_RFC5424},
+	}
+)
+
+// RegisterDialect adds d to the dialects tried, after the ones of the same
+// priority
+func RegisterDialect(d Dialect) error {
+	if d.Name == "" || d.Detect == nil || d.Parse == nil {
+		return errors.New("dialect needs a name, a Detect and a Parse function")
+	}
+
+	dialectsMu.Lock()
+	defer dialectsMu.Unlock()
+	for _, registered := range dialects {
+		if registered.Name == d.Name {
+			return fmt.Errorf("dialect %s already registered", d.Name)
+		}
+	}
+	updated := append(append(make([]Dialect, 0, len(dialects)+1), dialects...), d)
+	sort.SliceStable(updated, func(i, j int) bool {
+		return updated[i].Priority > updated[j].Priority
+	})
+	dialects = updated
+	return nil
+}
+
+// registeredDialects returns the registered dialects without copying them
+func registeredDialects() []Dialect {
+	dialectsMu.RLock()
+	defer dialectsMu.RUnlock()
+	return dialects
+}
+
+// Dialects returns the registered dialects, highest priority first. Only the
+// enabled ones are returned if any is, and never the disabled ones.
+func Dialects(enabled []string, disabled []string) []Dialect {
+	dialectsMu.RLock()
+	defer dialectsMu.RUnlock()
+
+	selected := make([]Dialect, 0, len(dialects))
+	for _, d := range dialects {
+		if len(enabled) > 0 && !containsName(enabled, d.Name) || containsName(disabled, d.Name) {
+			continue
+		}
+		selected = append(selected, d)
+	}
+	return selected
+}
+
+func containsName(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// keyValues returns the key=value pairs following the priority
+func keyValues(buff []byte) map[string]string {
+	if i := bytes.IndexByte(buff, syslogparser.PRI_PART_END); i >= 0 {
+		buff = buff[i+1:]
+	}
+	return syslogparser.ParseKeyValues(string(buff), " ", "=")
+}
+
+// sonicOS has their own syslog format documented here
+// https://www.sonicwall.com/techdocs/pdf/sonicos-6-5-1-log-events-reference-guide.pdf
+func detectSonicWall(buff []byte) bool {
+	return bytes.Contains(buff, []byte(`time="`))
+}
+
+func parseSonicWall(buff []byte, location *time.Location) (map[string]interface{}, error) {
+	//SonicOS log, made of key=value pairs, the time and firewall address are taken from them
+	//example log : <134>id=firewall sn=18B1690729A8 fw=10.205.123.15 time="2016-08-19 18:05:44" pri=1 c=32 m=609 msg="IPS Prevention Alert: DNS named version attempt" sid=143 ipscat=DNS ipspri=3 n=3 src=192.168.169.180:2907 dst=172.16.2.11:53
+	fields := keyValues(buff)
+	timestamp := fields["time"]
+	hostname := fields["fw"]
+
+	potentialLayouts := []string{
+		"2006-01-02 15:04:05 MST",
+		"2006-01-02 15:04:05",
+	}
+
+	var parsedTime time.Time
+	var err error
+	for _, layout := range potentialLayouts {
+		parsedTime, err = time.ParseInLocation(layout, timestamp, location)
+		if err == nil {
+			fixTimestampIfNeeded(&parsedTime)
+			break
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse time in SonicWall log: %v : %s", err, string(buff))
+	}
+
+	return map[string]interface{}{
+		"timestamp": parsedTime,
+		"hostname":  hostname,
+		"fields":    fields,
+	}, nil
+}
+
+// FortiOS has their own syslog format and there is an example here
+// https://docs.fortinet.com/document/fortigate/7.4.2/fortios-log-message-reference/357866/log-message-fields
+func detectFortiOS(buff []byte) bool {
+	return bytes.Contains(buff, []byte(`eventtime=`))
+}
+
+func parseFortiOS(buff []byte, location *time.Location) (map[string]interface{}, error) {
+	//FortiOS log, made of key=value pairs, the time is taken from eventtime
+	//example log : <133>date=2024-01-31 time=13:36:54 devname="Y21FS1-101F" devid="FGUSI@#J%JI@I" eventtime=1706726214463347261 tz="-0500" logid="0000000011" type="traffic" subtype="forward" level="notice" vd="root" srcip=10.2.2.30 srcport=50295 srcintf="almi-f5s" srcintfrole="undefined" dstip=10.3.1.1 dstport=90 dstintf="sr929" dstintfrole="lan" srccountry="Reserved" dstcountry="Reserved" sessionid=1583922 proto=3 action="start" policyid=905 policytype="policy" poluuid="fjkdsljjlk-5u39582305-573289527358" policyname="FIREWALL_POLICY" user="USER_ADMIN" authserver="AGENT_FO" dstuser="SVC_USER" centralnatid=5 service="TESTSERV" trandisp="noop" duration=0 sentbyte=0 rcvdbyte=0 sentpkt=0 rcvdpkt=0 vpntype="ipsecvpn" appcat="unscanned"
+	fields := keyValues(buff)
+	timestamp := fields["eventtime"]
+
+	timeNum, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert FortiOS event time to int: %v : %s", err, string(buff))
+	}
+	seconds := timeNum / int64(time.Second)
+	nanoseconds := timeNum % int64(time.Second)
+	parsedTime := time.Unix(seconds, nanoseconds)
+	parsedTime = parsedTime.UTC()
+	fixTimestampIfNeeded(&parsedTime)
+
+	return map[string]interface{}{
+		"timestamp": parsedTime,
+		"fields":    fields,
+	}, nil
+}
@@ -73,13 +73,16 @@ func (s *Rfc3164TestSuite) TestParserCiscoASA_Valid_RFC54242(c *C) {
 	obtained := p.Dump()
 
 	expected := syslogparser.LogParts{
-		"timestamp": time.Date(2018, time.June, 27, 12, 17, 46, 0, time.UTC),
-		"hostname":  "",
-		"tag":       "",
-		"content":   `<166>2018-06-27T12:17:46Z asa : %ASA-6-110002: Failed to locate egress interface for protocol from src interface :src IP/src port to dest IP/dest port`,
-		"priority":  166,
-		"facility":  20,
-		"severity":  6,
+		"timestamp":      time.Date(2018, time.June, 27, 12, 17, 46, 0, time.UTC),
+		"hostname":       "",
+		"tag":            "",
+		"content":        `<166>2018-06-27T12:17:46Z asa : %ASA-6-110002: Failed to locate egress interface for protocol from src interface :src IP/src port to dest IP/dest port`,
+		"priority":       166,
+		"facility":       20,
+		"severity":       6,
+		"asa_facility":   "ASA",
+		"asa_severity":   6,
+		"asa_message_id": 110002,
 	}
 
 	c.Assert(obtained, DeepEquals, expected)
@@ -106,13 +109,29 @@ func (s *Rfc3164TestSuite) TestParserCiscoASA_NoTimestamp(c *C) {
 	log.Println(obtained)
 	obtained["timestamp"] = now
 	expected := syslogparser.LogParts{
-		"timestamp": now,
-		"hostname":  "",
-		"tag":       "",
-		"content":   `<34>:%ASA-session-6-106100: access-list outside_access_in permitted tcp outside/155.138.247.97(58344) -> NEX-DMZ/10.90.3.239(443) hit-cnt 1 first hit [0x8fca8d4d, 0xf3808cf3]`,
-		"priority":  34,
-		"facility":  4,
-		"severity":  2,
+		"timestamp":      now,
+		"hostname":       "",
+		"tag":            "",
+		"content":        `<34>:%ASA-session-6-106100: access-list outside_access_in permitted tcp outside/155.138.247.97(58344) -> NEX-DMZ/10.90.3.239(443) hit-cnt 1 first hit [0x8fca8d4d, 0xf3808cf3]`,
+		"priority":       34,
+		"facility":       4,
+		"severity":       2,
+		"asa_facility":   "ASA",
+		"asa_class":      "session",
+		"asa_severity":   6,
+		"asa_message_id": 106100,
+		"fields": map[string]string{
+			"acl":           "outside_access_in",
+			"action":        "permitted",
+			"protocol":      "tcp",
+			"src_interface": "outside",
+			"src_ip":        "155.138.247.97",
+			"src_port":      "58344",
+			"dst_interface": "NEX-DMZ",
+			"dst_ip":        "10.90.3.239",
+			"dst_port":      "443",
+			"hit_count":     "1",
+		},
 	}
 
 	c.Assert(obtained, DeepEquals, expected)
@@ -137,18 +156,120 @@ func (s *Rfc3164TestSuite) TestParserCiscoASA_Valid(c *C) {
 	obtained := p.Dump()
 
 	expected := syslogparser.LogParts{
-		"timestamp": time.Date(2024, time.April, 04, 19, 28, 05, 0, time.UTC),
-		"hostname":  "",
-		"tag":       "",
-		"content":   `<34>:Apr 04 19:28:05 EDT: %ASA-session-6-106100: access-list outside_access_in permitted tcp outside/155.138.247.97(58344) -> NEX-DMZ/10.90.3.239(443) hit-cnt 1 first hit [0x8fca8d4d, 0xf3808cf3]`,
-		"priority":  34,
-		"facility":  4,
-		"severity":  2,
+		"timestamp":      time.Date(time.Now().UTC().Year(), time.April, 04, 19, 28, 05, 0, time.FixedZone("EDT", -4*3600)),
+		"hostname":       "",
+		"tag":            "",
+		"content":        `<34>:Apr 04 19:28:05 EDT: %ASA-session-6-106100: access-list outside_access_in permitted tcp outside/155.138.247.97(58344) -> NEX-DMZ/10.90.3.239(443) hit-cnt 1 first hit [0x8fca8d4d, 0xf3808cf3]`,
+		"priority":       34,
+		"facility":       4,
+		"severity":       2,
+		"asa_facility":   "ASA",
+		"asa_class":      "session",
+		"asa_severity":   6,
+		"asa_message_id": 106100,
+		"fields": map[string]string{
+			"acl":           "outside_access_in",
+			"action":        "permitted",
+			"protocol":      "tcp",
+			"src_interface": "outside",
+			"src_ip":        "155.138.247.97",
+			"src_port":      "58344",
+			"dst_interface": "NEX-DMZ",
+			"dst_ip":        "10.90.3.239",
+			"dst_port":      "443",
+			"hit_count":     "1",
+		},
 	}
 
 	c.Assert(obtained, DeepEquals, expected)
 }
 
+func (s *Rfc3164TestSuite) TestParserCiscoIOS_Valid(c *C) {
+	buff := []byte(`<189>123: router1: *Mar  1 18:46:11.123 EDT: %SYS-5-CONFIG_I: Configured from console by vty0 (10.0.0.5)`)
+
+	p := NewParser(buff)
+	err := p.Parse()
+	c.Assert(err, IsNil)
+
+	obtained := p.Dump()
+	expected := syslogparser.LogParts{
+		"timestamp":     time.Date(time.Now().UTC().Year(), time.March, 1, 18, 46, 11, 123000000, time.FixedZone("EDT", -4*3600)),
+		"hostname":      "router1",
+		"tag":           "",
+		"content":       string(buff),
+		"priority":      189,
+		"facility":      23,
+		"severity":      5,
+		"ios_sequence":  uint64(123),
+		"ios_time_sync": "not_synchronized",
+		"ios_facility":  "SYS",
+		"ios_severity":  5,
+		"ios_mnemonic":  "CONFIG_I",
+	}
+
+	c.Assert(obtained, DeepEquals, expected)
+}
+
+func (s *Rfc3164TestSuite) TestParserCiscoIOS_Variants(c *C) {
+	year := time.Now().UTC().Year()
+	for _, test := range []struct {
+		line  string
+		parts map[string]interface{}
+	}{
+		{
+			// NX-OS, the year first
+			`<189>: 2024 Mar  1 18:46:11 UTC: %ETHPORT-5-IF_DOWN_LINK_FAILURE: Interface Ethernet1/1 is down (Link failure)`,
+			map[string]interface{}{
+				"timestamp":     time.Date(2024, time.March, 1, 18, 46, 11, 0, time.FixedZone("UTC", 0)),
+				"ios_time_sync": "synchronized",
+				"ios_facility":  "ETHPORT",
+				"ios_severity":  5,
+				"ios_mnemonic":  "IF_DOWN_LINK_FAILURE",
+			},
+		},
+		{
+			`<187>4711: .Jun 12 09:01:02.5: %LINEPROTO-5-UPDOWN: Line protocol on Interface Gi0/1, changed state to down`,
+			map[string]interface{}{
+				"timestamp":     time.Date(year, time.June, 12, 9, 1, 2, 500000000, time.UTC),
+				"ios_sequence":  uint64(4711),
+				"ios_time_sync": "sync_lost",
+				"ios_facility":  "LINEPROTO",
+				"ios_severity":  5,
+				"ios_mnemonic":  "UPDOWN",
+			},
+		},
+		{
+			// Uptime timestamps, the clock being unset
+			`<188>12: 1w2d: %SW_MATM-4-MACFLAP_NOTIF: Host 0011.2233.4455 in vlan 1 is flapping`,
+			map[string]interface{}{
+				"ios_sequence": uint64(12),
+				"ios_uptime":   "1w2d",
+				"ios_facility": "SW_MATM",
+				"ios_severity": 4,
+				"ios_mnemonic": "MACFLAP_NOTIF",
+			},
+		},
+	} {
+		c.Assert(detectCiscoIOS([]byte(test.line)), Equals, true, Commentf("%s", test.line))
+		parts, err := parseCiscoIOS([]byte(test.line), time.UTC)
+		c.Assert(err, IsNil)
+		c.Check(parts, DeepEquals, test.parts, Commentf("%s", test.line))
+	}
+
+	// ASA messages are left to the ASA dialect
+	c.Check(detectCiscoIOS([]byte(`<166>:Apr 04 19:28:05 EDT: %ASA-6-110002: Failed to locate egress interface`)), Equals, false)
+	c.Check(detectCiscoIOS([]byte(`<34>Oct 11 22:14:15 mymachine su: 'su root' failed`)), Equals, false)
+	// Plain RFC3164 messages are told apart without the regular expression
+	c.Check(ciscoIOSPrefix([]byte(`<34>Oct 11 22:14:15 mymachine su: 'su root' failed`)), Equals, false)
+
+	// Unknown zones are taken in the location
+	parts, err := parseCiscoIOS([]byte(`<189>1: Mar  1 18:46:11 XYZ: %SYS-5-CONFIG_I: Configured`), time.UTC)
+	c.Assert(err, IsNil)
+	c.Check(parts["timestamp"], Equals, time.Date(year, time.March, 1, 18, 46, 11, 0, time.UTC))
+	c.Check(parts["ios_timezone"], Equals, "XYZ")
+	c.Check(parts["ios_mnemonic"], Equals, "CONFIG_I")
+}
+
 func (s *Rfc3164TestSuite) TestParserSonicWall_Valid(c *C) {
 	buff := []byte(`<34>id=firewall sn=18B1690729A8 fw=10.205.123.15 time="2016-08-19 18:05:44 UTC" pri=1 c=32 m=609 msg="IPS Prevention Alert: DNS named version attempt" sid=143 ipscat=DNS ipspri=3 n=3 src=192.168.169.180:2907 dst=172.16.2.11:53`)
 
@@ -174,6 +295,22 @@ func (s *Rfc3164TestSuite) TestParserSonicWall_Valid(c *C) {
 		"priority":  34,
 		"facility":  4,
 		"severity":  2,
+		"fields": map[string]string{
+			"id":     "firewall",
+			"sn":     "18B1690729A8",
+			"fw":     "10.205.123.15",
+			"time":   "2016-08-19 18:05:44 UTC",
+			"pri":    "1",
+			"c":      "32",
+			"m":      "609",
+			"msg":    "IPS Prevention Alert: DNS named version attempt",
+			"sid":    "143",
+			"ipscat": "DNS",
+			"ipspri": "3",
+			"n":      "3",
+			"src":    "192.168.169.180:2907",
+			"dst":    "172.16.2.11:53",
+		},
 	}
 
 	c.Assert(obtained, DeepEquals, expected)
@@ -204,11 +341,118 @@ func (s *Rfc3164TestSuite) TestParserFortiOS_Valid(c *C) {
 		"priority":  133,
 		"facility":  16,
 		"severity":  5,
+		"fields": map[string]string{
+			"date": "2024-01-31", "time": "13:36:54", "devname": "Y21FS1-101F", "devid": "FGUSI@#J%JI@I",
+			"eventtime": "1706726214463347261", "tz": "-0500", "logid": "0000000011", "type": "traffic",
+			"subtype": "forward", "level": "notice", "vd": "root", "srcip": "10.2.2.30", "srcport": "50295",
+			"srcintf": "almi-f5s", "srcintfrole": "undefined", "dstip": "10.3.1.1", "dstport": "90",
+			"dstintf": "sr929", "dstintfrole": "lan", "srccountry": "Reserved", "dstcountry": "Reserved",
+			"sessionid": "1583922", "proto": "3", "action": "start", "policyid": "905", "policytype": "policy",
+			"poluuid": "fjkdsljjlk-5u39582305-573289527358", "policyname": "FIREWALL_POLICY", "user": "USER_ADMIN",
+			"authserver": "AGENT_FO", "dstuser": "SVC_USER", "centralnatid": "5", "service": "TESTSERV",
+			"trandisp": "noop", "duration": "0", "sentbyte": "0", "rcvdbyte": "0", "sentpkt": "0", "rcvdpkt": "0",
+			"vpntype": "ipsecvpn", "appcat": "unscanned",
+		},
 	}
 
 	c.Assert(obtained, DeepEquals, expected)
 }
 
+func (s *Rfc3164TestSuite) TestCiscoASAMessage_Fields(c *C) {
+	for _, test := range []struct {
+		message string
+		id      int
+		fields  map[string]string
+	}{
+		{
+			`%ASA-6-302013: Built inbound TCP connection 1234 for outside:203.0.113.5/51234 (203.0.113.5/51234) to inside:192.168.1.10/443 (198.51.100.7/443)`,
+			302013,
+			map[string]string{
+				"action": "built", "direction": "inbound", "protocol": "tcp", "connection_id": "1234",
+				"src_interface": "outside", "src_ip": "203.0.113.5", "src_port": "51234", "src_mapped_ip": "203.0.113.5", "src_mapped_port": "51234",
+				"dst_interface": "inside", "dst_ip": "192.168.1.10", "dst_port": "443", "dst_mapped_ip": "198.51.100.7", "dst_mapped_port": "443",
+			},
+		},
+		{
+			`%ASA-6-302014: Teardown TCP connection 1234 for outside:203.0.113.5/51234 to inside:192.168.1.10/443 duration 0:00:30 bytes 5120 TCP FINs`,
+			302014,
+			map[string]string{
+				"action": "teardown", "protocol": "tcp", "connection_id": "1234",
+				"src_interface": "outside", "src_ip": "203.0.113.5", "src_port": "51234",
+				"dst_interface": "inside", "dst_ip": "192.168.1.10", "dst_port": "443",
+				"duration": "0:00:30", "bytes": "5120", "reason": "TCP FINs",
+			},
+		},
+		{
+			`%ASA-6-305011: Built dynamic TCP translation from inside:192.168.1.10/51234 to outside:203.0.113.5/40001`,
+			305011,
+			map[string]string{
+				"action": "built", "translation": "dynamic", "protocol": "tcp",
+				"src_interface": "inside", "src_ip": "192.168.1.10", "src_port": "51234",
+				"mapped_interface": "outside", "mapped_ip": "203.0.113.5", "mapped_port": "40001",
+			},
+		},
+		{
+			`%ASA-4-113019: Group = VPN, Username = jdoe, IP = 203.0.113.9, Session disconnected. Session Type: SSL, Duration: 1h:02m:03s, Bytes xmt: 12345, Bytes rcv: 6789, Reason: User Requested`,
+			113019,
+			map[string]string{
+				"group": "VPN", "user": "jdoe", "src_ip": "203.0.113.9", "session_type": "SSL", "duration": "1h:02m:03s",
+				"bytes_sent": "12345", "bytes_received": "6789", "reason": "User Requested",
+			},
+		},
+		{
+			`%ASA-2-106023: Deny tcp src outside:203.0.113.5/4444 dst inside:192.168.1.10/22 by access-group "outside_access_in" [0x0, 0x0]`,
+			106023,
+			map[string]string{
+				"action": "deny", "protocol": "tcp", "acl": "outside_access_in",
+				"src_interface": "outside", "src_ip": "203.0.113.5", "src_port": "4444",
+				"dst_interface": "inside", "dst_ip": "192.168.1.10", "dst_port": "22",
+			},
+		},
+		{
+			`%ASA-6-113004: AAA user authentication Successful : server =  10.1.1.1 : user = jdoe`,
+			113004,
+			map[string]string{"aaa_type": "authentication", "action": "successful", "server": "10.1.1.1", "user": "jdoe"},
+		},
+	} {
+		parts := ciscoASAMessage(`<166>:Apr 04 19:28:05 EDT: ` + test.message)
+		c.Check(parts["asa_message_id"], Equals, test.id)
+		c.Check(parts["fields"], DeepEquals, test.fields, Commentf("%s", test.message))
+	}
+
+	// Unknown message numbers only have their token decoded
+	parts := ciscoASAMessage(`%FTD-1-104001: (Primary) Switching to ACTIVE`)
+	c.Assert(parts, DeepEquals, map[string]interface{}{"asa_facility": "FTD", "asa_severity": 1, "asa_message_id": 104001})
+}
+
+func (s *Rfc3164TestSuite) TestParserCiscoIOS_RFC3164Header(c *C) {
+	// Without sequence number, the header of the line parses as RFC3164
+	p := NewParser([]byte(`<189>Mar  1 18:46:11: %SYS-5-CONFIG_I: Configured from console`))
+	p.Location(time.UTC)
+	c.Assert(p.Parse(), IsNil)
+	parts := p.Dump()
+	c.Check(parts["timestamp"], Equals, time.Date(time.Now().Year(), time.March, 1, 18, 46, 11, 0, time.UTC))
+	c.Check(parts["ios_facility"], Equals, "SYS")
+	c.Check(parts["ios_mnemonic"], Equals, "CONFIG_I")
+	c.Check(parts["ios_time_sync"], Equals, "synchronized")
+
+	// Unless the dialect is left out
+	p = NewParser([]byte(`<189>Mar  1 18:46:11: %SYS-5-CONFIG_I: Configured from console`))
+	p.Dialects(Dialects(nil, []string{"cisco-ios"}))
+	p.Parse()
+	c.Check(p.Dump()["ios_mnemonic"], IsNil)
+}
+
+func (s *Rfc3164TestSuite) TestParserCiscoASA_UnknownZone(c *C) {
+	p := NewParser([]byte(`<34>:Apr 04 19:28:05 XYZ: %ASA-6-110002: Failed to locate egress interface`))
+	p.Location(time.UTC)
+	c.Assert(p.Parse(), IsNil)
+	parts := p.Dump()
+	c.Check(parts["timestamp"], Equals, time.Date(time.Now().Year(), time.April, 4, 19, 28, 5, 0, time.UTC))
+	c.Check(parts["asa_timezone"], Equals, "XYZ")
+	c.Check(parts["asa_message_id"], Equals, 110002)
+}
+
 func (s *Rfc3164TestSuite) TestParser_Valid(c *C) {
 	buff := []byte("<34>Oct 11 22:14:15 mymachine very.large.syslog.message.tag: 'su root' failed for lonvick on /dev/pts/8")
 
@@ -599,3 +843,45 @@ func (s *Rfc3164TestSuite) assertTimeIsCloseToNow(c *C, obtainedTime time.Time)
 	c.Assert(obtainedTime.After(timeStart), Equals, true)
 	c.Assert(obtainedTime.Before(timeEnd), Equals, true)
 }
+
+func (s *Rfc3164TestSuite) TestParser_DialectsOnTimestampErrorOnly(c *C) {
+	claimed := []Dialect{{
+		Name:   "everything",
+		Detect: func([]byte) bool { return true },
+		Parse: func([]byte, *time.Location) (map[string]interface{}, error) {
+			return map[string]interface{}{"claimed": true}, nil
+		},
+	}}
+
+	// No RFC3164 timestamp
+	p := NewParser([]byte("<34>not a header"))
+	p.Dialects(claimed)
+	c.Assert(p.Parse(), IsNil)
+	c.Check(p.Dump()["claimed"], Equals, true)
+
+	// A timestamp, but no hostname
+	p = NewParser([]byte("<34>Oct 11 22:14:15 "))
+	p.Dialects(claimed)
+	c.Check(p.Parse(), NotNil)
+	c.Check(p.Dump()["claimed"], IsNil)
+}
+
+func BenchmarkParser_RFC3164(b *testing.B) {
+	buff := []byte("<34>Oct 11 22:14:15 mymachine very.large.syslog.message.tag: 'su root' failed for lonvick on /dev/pts/8")
+	for _, bench := range []struct {
+		name     string
+		dialects []Dialect
+	}{
+		{"no dialect", []Dialect{}},
+		{"registered dialects", nil},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				p := NewParser(buff)
+				p.Dialects(bench.dialects)
+				p.Parse()
+			}
+		})
+	}
+}
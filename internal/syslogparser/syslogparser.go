@@ -28,10 +28,6 @@ var (
 	ErrVersionNotFound = &ParserError{"Can not find version"}
 
 	ErrTimestampUnknownFormat = &ParserError{"Timestamp format unknown"}
-	ErrSonicOSFormat          = &ParserError{"SonicOS Format"}
-	ErrFortiOSFormat          = &ParserError{"FortiOS Format"}
-	ErrCiscoASAFormat         = &ParserError{"Cisco ASA Format"}
-	ErrCiscoASARFC5424        = &ParserError{"Cisco ASA RFC5424"}
 
 	ErrHostnameTooShort = &ParserError{"Hostname field too short"}
 )
@@ -171,3 +171,21 @@ func (s *CommonTestSuite) assertHostname(c *C, h string, b []byte, cursor int, e
 	c.Assert(cursor, Equals, expC)
 	c.Assert(err, Equals, e)
 }
+
+func (s *CommonTestSuite) TestParseKeyValues(c *C) {
+	obtained := ParseKeyValues(`id=firewall msg="IPS Alert: \"DNS\" query" empty= note='it''s' word src=10.0.0.1:53`, " ", "=")
+	c.Assert(obtained, DeepEquals, map[string]string{
+		"id":    "firewall",
+		"msg":   `IPS Alert: "DNS" query`,
+		"empty": "",
+		"note":  "it",
+		"src":   "10.0.0.1:53",
+	})
+
+	obtained = ParseKeyValues(`user: bob; action: "log in; out";"quoted": no;unterminated:"rest`, ";", ":")
+	c.Assert(obtained, DeepEquals, map[string]string{
+		"user":         "bob",
+		"action":       "log in; out",
+		"unterminated": "rest",
+	})
+}
@@ -0,0 +1,56 @@
+package syslog
+
+import (
+	"encoding/binary"
+	"net"
+	"path/filepath"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *ServerSuite) TestJournalNative(c *C) {
+	path := filepath.Join(c.MkDir(), "journal.sock")
+	channel := make(LogPartsChannel, 10)
+	server := NewServer()
+	server.SetFormat(Journal)
+	server.SetHandler(NewChannelHandler(channel))
+	c.Assert(server.ListenUnixgram(path), IsNil)
+	c.Assert(server.Boot(), IsNil)
+	defer server.Kill()
+
+	// A binary message ending with control characters, which must be kept
+	message := "panic:\n\tat main\n"
+	size := make([]byte, 8)
+	binary.LittleEndian.PutUint64(size, uint64(len(message)))
+	datagram := "PRIORITY=2\nSYSLOG_IDENTIFIER=app\nCODE_LINE=42\nMESSAGE\n" + string(size) + message + "\n"
+
+	conn, err := net.Dial("unixgram", path)
+	c.Assert(err, IsNil)
+	defer conn.Close()
+	_, err = conn.Write([]byte(datagram))
+	c.Assert(err, IsNil)
+
+	logParts := receiveParts(c, channel)
+	c.Check(logParts["message"], Equals, message)
+	c.Check(logParts["severity"], Equals, 2)
+	c.Check(logParts["tag"], Equals, "app")
+	c.Check(logParts["CODE_LINE"], Equals, "42")
+}
+
+func (s *ServerSuite) TestJournalExport(c *C) {
+	handler := new(handlerCollector)
+	server := NewServer()
+	server.SetFormat(Journal)
+	server.SetHandler(handler)
+
+	export := "__REALTIME_TIMESTAMP=1700000000000000\nMESSAGE=one\n_SYSTEMD_UNIT=a.service\n\n" +
+		"__REALTIME_TIMESTAMP=1700000001000000\nMESSAGE=two\nMESSAGE_ID=fc2e22bc6ee647b6b90729ab34a250b1\n\n"
+	err := server.IngestReader(strings.NewReader(export), IngestOptions{Source: "export"})
+	c.Assert(err, IsNil)
+	c.Assert(handler.logParts, HasLen, 2)
+	c.Check(handler.logParts[0]["_SYSTEMD_UNIT"], Equals, "a.service")
+	c.Check(handler.logParts[1]["message"], Equals, "two")
+	c.Check(handler.logParts[1]["MESSAGE_ID"], Equals, "fc2e22bc6ee647b6b90729ab34a250b1")
+	c.Check(handler.logParts[1]["source"], Equals, "export")
+}
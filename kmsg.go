@@ -0,0 +1,136 @@
+package syslog
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+
+	"github.com/GLMONTER/go-syslog/format"
+)
+
+// kmsgReadBufferSize holds any record, the device refusing reads which
+// cannot take the whole next record
+const kmsgReadBufferSize = 16 * 1024
+
+// KmsgOptions configure the kernel log input of ListenKmsg
+type KmsgOptions struct {
+	// Path is the device to read, /dev/kmsg if empty
+	Path string
+	// SkipExisting only reads the records logged from Boot on, instead of
+	// the ones still in the kernel buffer
+	SkipExisting bool
+}
+
+// kmsgInput remembers the last record read, so records lost in between are
+// reported and the ones read before Kill are not delivered again after Boot
+type kmsgInput struct {
+	path     string
+	seen     bool
+	last     uint64
+	hostname string
+}
+
+// ListenKmsg Configure the server for reading the kernel log from /dev/kmsg,
+// parsing its records with the Kmsg format whatever the server format is.
+// Messages carry the host name, and a gap in the record sequence numbers is
+// reported to ErrChan. The listener is known to RemoveListener by the path
+// of the device.
+func (s *Server) ListenKmsg(opts KmsgOptions) error {
+	path := opts.Path
+	if path == "" {
+		path = "/dev/kmsg"
+	}
+	hostname, _ := os.Hostname()
+
+	l := &listener{
+		kind:      kmsgListener,
+		network:   "kmsg",
+		requested: path,
+		open: func(l *listener, addr string, reopen bool) error {
+			file, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			if opts.SkipExisting && !reopen {
+				if _, err := file.Seek(0, io.SeekEnd); err != nil {
+					file.Close()
+					return err
+				}
+			}
+			l.reader = file
+			return nil
+		},
+		kmsg: &kmsgInput{path: path, hostname: hostname},
+	}
+	return s.addListener(l)
+}
+
+// goReadKmsg delivers the records of l until it stops. Each read of the
+// device returns a single record.
+func (s *Server) goReadKmsg(l *listener) {
+	reader, done, input := l.reader, l.done, l.kmsg
+
+	s.spawn(l, func() {
+		buf := make([]byte, kmsgReadBufferSize)
+		for {
+			n, err := reader.Read(buf)
+			if n > 0 {
+				s.kmsgRecords(input, buf[:n])
+			}
+			if err == nil {
+				continue
+			}
+			if errors.Is(err, syscall.EPIPE) {
+				// The next read resumes at the oldest record left
+				s.report(fmt.Errorf("%s: records overwritten before being read", input.path))
+				continue
+			}
+
+			select {
+			case <-done:
+			default:
+				if err != io.EOF {
+					s.report(fmt.Errorf("%s: %w", input.path, err))
+				}
+			}
+			return
+		}
+	})
+}
+
+// kmsgRecords delivers the records of data
+func (s *Server) kmsgRecords(input *kmsgInput, data []byte) {
+	for len(data) > 0 {
+		advance, record, _ := format.ScanKmsgRecords(data, true)
+		if advance == 0 {
+			return
+		}
+		data = data[advance:]
+		if record == nil {
+			continue
+		}
+
+		parser := Kmsg.GetParser(record)
+		err := parser.Parse()
+		if err != nil {
+			s.report(fmt.Errorf("%s: %w", input.path, err))
+		}
+		logParts := parser.Dump()
+
+		if sequence, ok := logParts["sequence"].(uint64); ok {
+			if input.seen && sequence <= input.last {
+				// Delivered before the server was killed
+				continue
+			}
+			if input.seen && sequence > input.last+1 {
+				s.report(fmt.Errorf("%s: %d records dropped before sequence number %d", input.path, sequence-input.last-1, sequence))
+			}
+			input.seen, input.last = true, sequence
+		}
+
+		logParts["hostname"] = input.hostname
+		s.deliver(logParts, int64(len(record)), err, "", "", nil)
+	}
+}
@@ -0,0 +1,44 @@
+package syslog
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *ServerSuite) TestListenKmsg(c *C) {
+	path := filepath.Join(c.MkDir(), "kmsg")
+	records := "6,10,1000,-;first\n SUBSYSTEM=net\n6,11,2000,-;second\n6,14,3000,-;after a gap\n"
+	c.Assert(os.WriteFile(path, []byte(records), 0o600), IsNil)
+
+	channel := make(LogPartsChannel, 10)
+	server := NewServer()
+	server.SetFormat(RFC5424)
+	server.SetHandler(NewChannelHandler(channel))
+
+	c.Assert(server.ListenKmsg(KmsgOptions{Path: path}), IsNil)
+	c.Assert(server.Boot(), IsNil)
+	defer server.Kill()
+
+	hostname, _ := os.Hostname()
+	var messages []string
+	for i := 0; i < 3; i++ {
+		logParts := receiveParts(c, channel)
+		c.Check(logParts["hostname"], Equals, hostname)
+		c.Check(logParts["tag"], Equals, "kernel")
+		messages = append(messages, logParts["message"].(string))
+		if i == 0 {
+			c.Check(logParts["SUBSYSTEM"], Equals, "net")
+		}
+	}
+	c.Check(messages, DeepEquals, []string{"first", "second", "after a gap"})
+
+	select {
+	case err := <-server.ErrChan:
+		c.Check(err, ErrorMatches, ".*: 2 records dropped before sequence number 14")
+	case <-time.After(5 * time.Second):
+		c.Fatal("timed out waiting for the gap")
+	}
+}
@@ -0,0 +1,449 @@
+package syslog
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/GLMONTER/go-syslog/format"
+)
+
+// drainTimeout is how long the connections of a removed listener get to
+// deliver what their peer already sent
+const drainTimeout = 500 * time.Millisecond
+
+type listenerKind int
+
+const (
+	streamListener   listenerKind = iota // TCP and TLS
+	packetListener                       // UDP and unixgram
+	httpListener                         // HTTP and HTTPS drains
+	dtlsListenerKind                     // DTLS
+	forwardListener                      // Fluentd Forward protocol
+	readerListener                       // streams read with ListenReader
+	fileListener                         // files followed with ListenFiles
+	kmsgListener                         // the Linux kernel log
+)
+
+// listener is a socket of the server along with the goroutines and
+// connections it started, so it can be stopped on its own
+type listener struct {
+	kind    listenerKind
+	network string
+	// requested is the address asked for, bound the one actually used
+	requested string
+	bound     string
+	// open binds the socket to addr. reopen is set when the server comes
+	// back after Kill.
+	open func(l *listener, addr string, reopen bool) error
+
+	stream net.Listener
+	packet net.PacketConn
+	dtls   *dtlsListener
+	http   *http.Server
+	// handler serves the requests of an httpListener, the Logplex drain one
+	// if nil
+	handler http.Handler
+	// readBuffer is the receive buffer size the kernel granted
+	readBuffer int
+	reader     io.Reader
+	ingest     IngestOptions
+	// exhausted is set once the reader ended or was stopped
+	exhausted bool
+	files     *fileTailer
+	kmsg      *kmsgInput
+	// dialects overrides the dialect selection of the server format
+	dialects *format.DialectSelection
+	// format parses the messages of the listener, the server one if nil
+	format format.Format
+
+	wait    sync.WaitGroup
+	mu      sync.Mutex
+	done    chan bool
+	started bool
+	closed  bool
+	// draining connections read what the peer already sent until the drain
+	// deadline, instead of being closed
+	draining bool
+	conns    map[net.Conn]bool
+}
+
+// Addr returns the address the listener is bound to
+func (l *listener) Addr() net.Addr {
+	switch {
+	case l.stream != nil:
+		return l.stream.Addr()
+	case l.packet != nil:
+		return l.packet.LocalAddr()
+	case l.dtls != nil:
+		return l.dtls.Addr()
+	case l.reader != nil || l.files != nil:
+		return localAddr{l.network, l.requested}
+	}
+	return nil
+}
+
+// localAddr is the address of a listener which is not a socket, its name
+type localAddr struct {
+	network string
+	name    string
+}
+
+func (a localAddr) Network() string { return a.network }
+func (a localAddr) String() string  { return a.name }
+
+// track registers a connection, so stopping the listener stops it too. It
+// returns false once the listener is stopped.
+func (l *listener) track(conn net.Conn) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return false
+	}
+	l.conns[conn] = true
+	return true
+}
+
+func (l *listener) untrack(conn net.Conn) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.conns, conn)
+}
+
+// ListenerOptions configure a listener of AddListenerWithOptions
+type ListenerOptions struct {
+	// TLSConfig holds the certificates of the "tls", "https", "dtls" and
+	// "hecs" listeners
+	TLSConfig *tls.Config
+	// Dialects selects the vendor dialects tried on the messages of the
+	// listener, instead of the selection of the RFC3164 or Automatic server
+	// format. Other formats ignore it.
+	Dialects *format.DialectSelection
+}
+
+// AddListener binds a listener for network on addr, where network is one of
+// "udp", "unixgram", "tcp", "tls", "http", "https", "dtls", "forward", "hec"
+// or "hecs". The "tls", "https", "dtls" and "hecs" ones take their
+// certificates from config. On a running server the listener starts right
+// away, otherwise with Boot. It returns the bound address, which
+// RemoveListener takes.
+func (s *Server) AddListener(network string, addr string, config *tls.Config) (net.Addr, error) {
+	return s.AddListenerWithOptions(network, addr, ListenerOptions{TLSConfig: config})
+}
+
+// AddListenerWithOptions binds a listener like AddListener, configured by opts
+func (s *Server) AddListenerWithOptions(network string, addr string, opts ListenerOptions) (net.Addr, error) {
+	config := opts.TLSConfig
+	l := &listener{network: network, requested: addr, dialects: opts.Dialects}
+
+	switch network {
+	case "udp":
+		l.kind, l.open = packetListener, s.openUDPWithOptions(UDPOptions{})
+	case "unixgram":
+		l.kind, l.open = packetListener, s.openUnixgram
+	case "tcp":
+		l.kind, l.open = streamListener, openTCP
+	case "tls":
+		l.kind, l.open = streamListener, openTLS(config)
+	case "http":
+		l.kind, l.open = httpListener, openTCP
+	case "https":
+		l.kind, l.open = httpListener, openTLS(config)
+	case "dtls":
+		l.kind, l.open = dtlsListenerKind, openDTLS(config)
+	case "forward":
+		l.kind, l.open = forwardListener, openTCP
+	case "hec":
+		l.kind, l.open, l.handler = httpListener, openTCP, s.hecHandler(l)
+	case "hecs":
+		l.kind, l.open, l.handler = httpListener, openTLS(config), s.hecHandler(l)
+	default:
+		return nil, fmt.Errorf("unknown network %q", network)
+	}
+	if (network == "tls" || network == "https" || network == "dtls" || network == "hecs") && config == nil {
+		return nil, fmt.Errorf("%s listener needs a TLS config", network)
+	}
+
+	if err := s.addListener(l); err != nil {
+		return nil, err
+	}
+	return l.Addr(), nil
+}
+
+// addListener opens l on the address requested and registers it
+func (s *Server) addListener(l *listener) error {
+	if err := l.open(l, l.requested, false); err != nil {
+		return err
+	}
+	l.bound = l.Addr().String()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append(s.entries, l)
+	s.refreshListeners()
+	if s.running {
+		s.startListener(l)
+	}
+	return nil
+}
+
+// RemoveListener stops the listener bound to, or asked for on, addr. Its
+// connections get half a second to deliver the messages their peer already
+// sent, then it returns.
+// The other listeners are not affected.
+func (s *Server) RemoveListener(addr string) error {
+	s.mu.Lock()
+	var found *listener
+	for i, l := range s.entries {
+		if l.bound == addr || l.requested == addr {
+			found = l
+			s.entries = append(s.entries[:i:i], s.entries[i+1:]...)
+			break
+		}
+	}
+	if found != nil {
+		s.refreshListeners()
+	}
+	s.mu.Unlock()
+
+	if found == nil {
+		return fmt.Errorf("no listener on %s", addr)
+	}
+
+	err := s.stopListener(found, true)
+	found.wait.Wait()
+	return err
+}
+
+// refreshListeners rebuilds the socket lists from the entries. s.mu is held.
+func (s *Server) refreshListeners() {
+	s.listeners = nil
+	s.connections = nil
+	for _, l := range s.entries {
+		switch l.kind {
+		case streamListener:
+			s.listeners = append(s.listeners, l.stream)
+		case packetListener:
+			s.connections = append(s.connections, l.packet)
+		}
+	}
+}
+
+// startListener starts serving l. s.mu is held.
+func (s *Server) startListener(l *listener) {
+	l.mu.Lock()
+	l.done = make(chan bool)
+	l.started = true
+	l.closed = false
+	l.conns = make(map[net.Conn]bool)
+	l.format = s.listenerFormat(l)
+	l.mu.Unlock()
+
+	switch l.kind {
+	case streamListener, forwardListener:
+		s.goAcceptConnection(l)
+	case packetListener:
+		if !s.parsingDatagrams {
+			s.goParseDatagrams()
+		}
+		s.goReceiveDatagrams(l)
+	case httpListener:
+		s.goServeHTTP(l)
+	case dtlsListenerKind:
+		s.goAcceptDTLS(l)
+	case readerListener:
+		s.goIngest(l)
+	case fileListener:
+		s.goTailFiles(l)
+	case kmsgListener:
+		s.goReadKmsg(l)
+	}
+}
+
+// stopListener closes the socket of l. Its connections are closed too, or
+// with drain, get drainTimeout to deliver the data already sent, whether
+// buffered by the server or still in the socket.
+func (s *Server) stopListener(l *listener, drain bool) error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil
+	}
+	l.closed = true
+	l.draining = drain
+	if l.started {
+		close(l.done)
+	}
+	conns := make([]net.Conn, 0, len(l.conns))
+	for conn := range l.conns {
+		conns = append(conns, conn)
+	}
+	l.mu.Unlock()
+
+	var err error
+	switch {
+	case l.http != nil && drain:
+		ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+		err = l.http.Shutdown(ctx)
+		cancel()
+		if errors.Is(err, context.DeadlineExceeded) {
+			// What the slow clients did not send in time is dropped
+			err = l.http.Close()
+		}
+	case l.http != nil:
+		err = l.http.Close()
+	case l.stream != nil:
+		err = l.stream.Close()
+	case l.packet != nil:
+		err = l.packet.Close()
+	case l.dtls != nil:
+		// The UDP socket is only released once every session is closed
+		l.dtls.sessions.closeAll()
+		err = l.dtls.Close()
+	case l.reader != nil:
+		if closer, ok := l.reader.(io.Closer); ok {
+			err = closer.Close()
+		}
+	}
+	if errors.Is(err, net.ErrClosed) || errors.Is(err, http.ErrServerClosed) {
+		err = nil
+	}
+
+	for _, conn := range conns {
+		if drain {
+			// Reads return what was sent, then time out
+			if conn.SetReadDeadline(time.Now().Add(drainTimeout)) == nil {
+				continue
+			}
+		}
+		conn.Close()
+	}
+	return err
+}
+
+// listenerFormat returns the format of the server with the dialect selection
+// of l, nil if l has none
+func (s *Server) listenerFormat(l *listener) format.Format {
+	if l.dialects == nil {
+		return nil
+	}
+	switch s.format.(type) {
+	case *format.RFC3164:
+		return &format.RFC3164{Dialects: *l.dialects}
+	case *format.Automatic:
+		return &format.Automatic{Dialects: *l.dialects}
+	}
+	return nil
+}
+
+// formatOf returns the format parsing the messages of l, which may be nil
+func (s *Server) formatOf(l *listener) format.Format {
+	if l != nil && l.format != nil {
+		return l.format
+	}
+	return s.format
+}
+
+// isDraining tells if l, which may be nil, is being removed with drain
+func (l *listener) isDraining() bool {
+	if l == nil {
+		return false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.draining
+}
+
+// setReadTimeout applies the read timeout of the server to conn, unless its
+// listener l, which may be nil, is draining and has set the drain deadline
+func (s *Server) setReadTimeout(l *listener, conn TimeoutCloser) {
+	if s.readTimeoutMilliseconds <= 0 {
+		return
+	}
+	if l != nil {
+		// Checked and set along, so the drain deadline is never overwritten
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if l.draining {
+			return
+		}
+	}
+	err := conn.SetReadDeadline(time.Now().Add(time.Duration(s.readTimeoutMilliseconds) * time.Millisecond))
+	if err != nil {
+		s.report(err)
+	}
+}
+
+// spawn runs f in a goroutine Wait waits for. If l is set, removing l waits
+// for it too.
+func (s *Server) spawn(l *listener, f func()) {
+	s.wait.Add(1)
+	if l != nil {
+		l.wait.Add(1)
+	}
+	go func() {
+		defer s.wait.Done()
+		if l != nil {
+			defer l.wait.Done()
+		}
+		f()
+	}()
+}
+
+// report hands err to ErrChan without blocking the caller. Errors reported
+// after Kill are dropped.
+func (s *Server) report(err error) {
+	s.errMu.Lock()
+	if s.errStopped || s.ErrChan == nil {
+		s.errMu.Unlock()
+		return
+	}
+	if s.errDone == nil {
+		s.errDone = make(chan struct{})
+	}
+	errChan, done := s.ErrChan, s.errDone
+	s.errWait.Add(1)
+	s.errMu.Unlock()
+
+	go func() {
+		defer s.errWait.Done()
+		select {
+		case errChan <- err:
+		case <-done:
+		}
+	}()
+}
+
+// stopErrors drops the errors nobody received yet, and the ones reported
+// until resumeErrors. ErrChan is kept, its consumers get the errors of the
+// server booted again.
+func (s *Server) stopErrors() {
+	s.errMu.Lock()
+	if s.errStopped {
+		s.errMu.Unlock()
+		return
+	}
+	s.errStopped = true
+	if s.errDone != nil {
+		close(s.errDone)
+	}
+	s.errMu.Unlock()
+
+	s.errWait.Wait()
+}
+
+// resumeErrors hands the errors of a killed server booted again to ErrChan
+func (s *Server) resumeErrors() {
+	s.errMu.Lock()
+	defer s.errMu.Unlock()
+	if s.errStopped {
+		s.errDone = make(chan struct{})
+		s.errStopped = false
+	}
+}
@@ -0,0 +1,211 @@
+package syslog
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	"github.com/GLMONTER/go-syslog/format"
+
+	. "gopkg.in/check.v1"
+)
+
+func receiveContent(c *C, channel LogPartsChannel) string {
+	select {
+	case logParts := <-channel:
+		return logParts["client"].(string)
+	case <-time.After(5 * time.Second):
+		c.Fatal("timed out waiting for a message")
+	}
+	return ""
+}
+
+func (s *ServerSuite) TestAddRemoveListener(c *C) {
+	channel := make(LogPartsChannel, 10)
+	server := NewServer()
+	server.SetFormat(RFC3164)
+	server.SetHandler(NewChannelHandler(channel))
+	first, err := server.AddListener("tcp", "127.0.0.1:0", nil)
+	c.Assert(err, IsNil)
+	c.Assert(server.Boot(), IsNil)
+
+	// Added to the running server
+	second, err := server.AddListener("tcp", "127.0.0.1:0", nil)
+	c.Assert(err, IsNil)
+	udp, err := server.AddListener("udp", "127.0.0.1:0", nil)
+	c.Assert(err, IsNil)
+
+	firstConn, err := net.Dial("tcp", first.String())
+	c.Assert(err, IsNil)
+	secondConn, err := net.Dial("tcp", second.String())
+	c.Assert(err, IsNil)
+	udpConn, err := net.Dial("udp", udp.String())
+	c.Assert(err, IsNil)
+
+	for _, conn := range []net.Conn{firstConn, secondConn, udpConn} {
+		_, err = conn.Write([]byte(exampleSyslog + "\n"))
+		c.Assert(err, IsNil)
+		c.Check(receiveContent(c, channel), Equals, conn.LocalAddr().String())
+	}
+
+	// Removing the first one drops its connections only
+	c.Assert(server.RemoveListener(first.String()), IsNil)
+	firstConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = firstConn.Read(make([]byte, 1))
+	c.Check(err, NotNil)
+	_, err = net.Dial("tcp", first.String())
+	c.Check(err, NotNil)
+	c.Check(server.listeners, HasLen, 1)
+
+	_, err = secondConn.Write([]byte(exampleSyslog + "\n"))
+	c.Assert(err, IsNil)
+	c.Check(receiveContent(c, channel), Equals, secondConn.LocalAddr().String())
+
+	c.Check(server.RemoveListener(first.String()), ErrorMatches, "no listener on .*")
+	_, err = server.AddListener("sctp", "127.0.0.1:0", nil)
+	c.Check(err, ErrorMatches, `unknown network "sctp"`)
+	_, err = server.AddListener("tls", "127.0.0.1:0", nil)
+	c.Check(err, ErrorMatches, "tls listener needs a TLS config")
+
+	firstConn.Close()
+	secondConn.Close()
+	udpConn.Close()
+	server.Kill()
+	server.Wait()
+}
+
+func (s *ServerSuite) TestRemoveListenerDrains(c *C) {
+	channel := make(LogPartsChannel, 100)
+	server := NewServer()
+	server.SetFormat(RFC3164)
+	server.SetHandler(NewChannelHandler(channel))
+	addr, err := server.AddListener("tcp", "127.0.0.1:0", nil)
+	c.Assert(err, IsNil)
+	c.Assert(server.Boot(), IsNil)
+
+	conn, err := net.Dial("tcp", addr.String())
+	c.Assert(err, IsNil)
+	_, err = conn.Write([]byte(exampleSyslog + "\n"))
+	c.Assert(err, IsNil)
+	receiveContent(c, channel)
+
+	// Sent right before the removal, still in the socket when it starts
+	var batch []byte
+	for i := 0; i < 50; i++ {
+		batch = append(batch, exampleSyslog+"\n"...)
+	}
+	_, err = conn.Write(batch)
+	c.Assert(err, IsNil)
+	c.Assert(server.RemoveListener(addr.String()), IsNil)
+	c.Check(channel, HasLen, 50)
+
+	conn.Close()
+	server.Kill()
+	server.Wait()
+}
+
+func (s *ServerSuite) TestBootKillRestart(c *C) {
+	channel := make(LogPartsChannel, 10)
+	server := NewServer()
+	errChan := server.ErrChan
+	server.SetFormat(RFC3164)
+	server.SetHandler(NewChannelHandler(channel))
+	tcp, err := server.AddListener("tcp", "127.0.0.1:0", nil)
+	c.Assert(err, IsNil)
+	udp, err := server.AddListener("udp", "127.0.0.1:0", nil)
+	c.Assert(err, IsNil)
+
+	for round := 0; round < 2; round++ {
+		c.Assert(server.Boot(), IsNil)
+		c.Assert(server.Boot(), IsNil)
+
+		for _, network := range []string{"tcp", "udp"} {
+			addr := tcp.String()
+			if network == "udp" {
+				addr = udp.String()
+			}
+			conn, err := net.Dial(network, addr)
+			c.Assert(err, IsNil)
+			_, err = conn.Write([]byte(exampleSyslog + "\n"))
+			c.Assert(err, IsNil)
+			c.Check(receiveContent(c, channel), Equals, conn.LocalAddr().String())
+			conn.Close()
+		}
+
+		c.Assert(server.Kill(), IsNil)
+		server.Wait()
+
+		_, err = net.Dial("tcp", tcp.String())
+		c.Check(err, NotNil)
+	}
+
+	// The errors of the server booted again reach the consumers of ErrChan
+	c.Assert(server.Boot(), IsNil)
+	c.Check(server.ErrChan, Equals, errChan)
+	server.report(errors.New("after restart"))
+	select {
+	case err := <-errChan:
+		c.Check(err, ErrorMatches, "after restart")
+	case <-time.After(5 * time.Second):
+		c.Fatal("timed out waiting for an error")
+	}
+
+	c.Check(server.Kill(), IsNil)
+}
+
+func (s *ServerSuite) TestListenerDialects(c *C) {
+	channel := make(LogPartsChannel, 10)
+	server := NewServer()
+	server.SetFormat(RFC3164)
+	server.SetHandler(NewChannelHandler(channel))
+	all, err := server.AddListener("udp", "127.0.0.1:0", nil)
+	c.Assert(err, IsNil)
+	noFortiOS, err := server.AddListenerWithOptions("udp", "127.0.0.1:0", ListenerOptions{
+		Dialects: &format.DialectSelection{Disable: []string{"fortios"}},
+	})
+	c.Assert(err, IsNil)
+	c.Assert(server.Boot(), IsNil)
+
+	fortiOS := `<133>date=2024-01-31 time=13:36:54 eventtime=1706726214463347261 action="start"`
+	for _, addr := range []net.Addr{all, noFortiOS} {
+		conn, err := net.Dial("udp", addr.String())
+		c.Assert(err, IsNil)
+		_, err = conn.Write([]byte(fortiOS))
+		c.Assert(err, IsNil)
+		conn.Close()
+
+		logParts := receiveParts(c, channel)
+		if addr == all {
+			c.Check(logParts["fields"], NotNil)
+		} else {
+			c.Check(logParts["fields"], IsNil)
+		}
+	}
+
+	server.Kill()
+	server.Wait()
+}
+
+func (s *ServerSuite) TestRemoveListenerSlowHTTPClient(c *C) {
+	server := NewServer()
+	server.SetFormat(RFC5424)
+	server.SetHandler(new(HandlerMock))
+	addr, err := server.AddListener("http", "127.0.0.1:0", nil)
+	c.Assert(err, IsNil)
+	c.Assert(server.Boot(), IsNil)
+
+	// A request which never ends
+	conn, err := net.Dial("tcp", addr.String())
+	c.Assert(err, IsNil)
+	defer conn.Close()
+	_, err = conn.Write([]byte("POST / HTTP/1.1\r\nHost: localhost\r\n"))
+	c.Assert(err, IsNil)
+	time.Sleep(50 * time.Millisecond)
+
+	start := time.Now()
+	c.Assert(server.RemoveListener(addr.String()), IsNil)
+	c.Check(time.Since(start) < 2*drainTimeout, Equals, true)
+
+	server.Kill()
+	server.Wait()
+}
@@ -0,0 +1,578 @@
+package syslog
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	pcapMagicMicro       = 0xa1b2c3d4
+	pcapMagicNano        = 0xa1b23c4d
+	pcapngSectionHeader  = 0x0a0d0d0a
+	pcapngByteOrderMagic = 0x1a2b3c4d
+	// pcapngByteOrderSwapped is the magic of big endian sections read as
+	// little endian
+	pcapngByteOrderSwapped = 0x4d3c2b1a
+	pcapngInterface        = 1
+	pcapngPacket           = 2
+	pcapngSimplePacket     = 3
+	pcapngEnhancedPacket   = 6
+	// pcapMaxBlockSize bounds the records and blocks read
+	pcapMaxBlockSize = 16 * 1024 * 1024
+	// tcpMaxPending bounds the out of order segments kept for a TCP stream
+	tcpMaxPending = 1024
+)
+
+// Link types of the captures read
+const (
+	linkTypeNull      = 0
+	linkTypeEthernet  = 1
+	linkTypeRaw       = 101
+	linkTypeLoop      = 108
+	linkTypeLinuxSLL  = 113
+	linkTypeIPv4      = 228
+	linkTypeIPv6      = 229
+	linkTypeLinuxSLL2 = 276
+)
+
+// PcapOptions configure the replay of a capture by ReplayPcap
+type PcapOptions struct {
+	// Ports are the destination ports of the syslog traffic, 514 if empty
+	Ports []int
+	// Timing replays the packets with the spacing they were captured with,
+	// instead of as fast as possible
+	Timing bool
+}
+
+// ReplayPcap reads a pcap or pcapng capture, as written by tcpdump, and
+// replays the UDP datagrams and TCP streams sent to the ports of opts through
+// the server format and handler. Messages come from the original source
+// addresses. TCP streams are reassembled, IP fragments are skipped. It
+// returns once the capture ends. The server does not need to be booted.
+func (s *Server) ReplayPcap(r io.Reader, opts PcapOptions) error {
+	if s.format == nil {
+		return errors.New("please set a valid format")
+	}
+	if s.handler == nil {
+		return errors.New("please set a valid handler")
+	}
+
+	packets, err := newPacketReader(r)
+	if err != nil {
+		return err
+	}
+
+	ports := map[uint16]bool{}
+	for _, port := range opts.Ports {
+		ports[uint16(port)] = true
+	}
+	if len(ports) == 0 {
+		ports[514] = true
+	}
+
+	replay := &pcapReplay{server: s, ports: ports, flows: map[string]*tcpFlow{}}
+	defer replay.close()
+
+	var first time.Time
+	var start time.Time
+	for {
+		packet, err := packets.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if opts.Timing && !packet.timestamp.IsZero() {
+			if first.IsZero() {
+				first, start = packet.timestamp, time.Now()
+			} else if wait := time.Until(start.Add(packet.timestamp.Sub(first))); wait > 0 {
+				time.Sleep(wait)
+			}
+		}
+		replay.packet(packet.linkType, packet.data)
+	}
+	if replay.fragments > 0 {
+		s.report(fmt.Errorf("pcap: skipped %d IP fragments", replay.fragments))
+	}
+	return nil
+}
+
+type pcapPacket struct {
+	timestamp time.Time
+	linkType  int
+	data      []byte
+}
+
+// packetReader reads the packets of a pcap or pcapng capture
+type packetReader struct {
+	r     *bufio.Reader
+	order binary.ByteOrder
+	ng    bool
+	// nano tells pcap timestamps are in nanoseconds
+	nano     bool
+	linkType int
+	// interfaces are the pcapng interfaces of the current section
+	interfaces []pcapngInterfaceInfo
+	last       time.Time
+}
+
+type pcapngInterfaceInfo struct {
+	linkType int
+	snapLen  uint32
+	// units is the timestamp units per second, offset is in seconds
+	units  uint64
+	offset int64
+}
+
+func newPacketReader(r io.Reader) (*packetReader, error) {
+	p := &packetReader{r: bufio.NewReader(r)}
+	magic, err := p.r.Peek(4)
+	if err != nil {
+		return nil, fmt.Errorf("pcap: %w", err)
+	}
+
+	if binary.LittleEndian.Uint32(magic) == pcapngSectionHeader {
+		p.ng = true
+		return p, nil
+	}
+
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		switch order.Uint32(magic) {
+		case pcapMagicMicro:
+			p.order = order
+		case pcapMagicNano:
+			p.order, p.nano = order, true
+		}
+	}
+	if p.order == nil {
+		return nil, errors.New("pcap: not a pcap or pcapng capture")
+	}
+
+	header := make([]byte, 24)
+	if _, err := io.ReadFull(p.r, header); err != nil {
+		return nil, fmt.Errorf("pcap: %w", err)
+	}
+	p.linkType = int(p.order.Uint32(header[20:]) & 0xffff)
+	return p, nil
+}
+
+func (p *packetReader) next() (pcapPacket, error) {
+	if p.ng {
+		return p.nextBlock()
+	}
+
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(p.r, header); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return pcapPacket{}, fmt.Errorf("pcap: truncated record header")
+		}
+		return pcapPacket{}, err
+	}
+	seconds, fraction := p.order.Uint32(header), p.order.Uint32(header[4:])
+	length := p.order.Uint32(header[8:])
+	if length > pcapMaxBlockSize {
+		return pcapPacket{}, fmt.Errorf("pcap: record of %d bytes", length)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(p.r, data); err != nil {
+		return pcapPacket{}, fmt.Errorf("pcap: truncated record: %w", err)
+	}
+
+	nanos := int64(fraction) * 1000
+	if p.nano {
+		nanos = int64(fraction)
+	}
+	return pcapPacket{time.Unix(int64(seconds), nanos), p.linkType, data}, nil
+}
+
+// nextBlock returns the next packet of a pcapng capture, skipping the other
+// blocks
+func (p *packetReader) nextBlock() (pcapPacket, error) {
+	for {
+		header, err := p.r.Peek(12)
+		if err == io.EOF && len(header) == 0 {
+			return pcapPacket{}, io.EOF
+		}
+		if err != nil {
+			return pcapPacket{}, fmt.Errorf("pcapng: truncated block header")
+		}
+
+		if binary.LittleEndian.Uint32(header) == pcapngSectionHeader {
+			switch binary.LittleEndian.Uint32(header[8:]) {
+			case pcapngByteOrderMagic:
+				p.order = binary.LittleEndian
+			case pcapngByteOrderSwapped:
+				p.order = binary.BigEndian
+			default:
+				return pcapPacket{}, errors.New("pcapng: invalid byte order magic")
+			}
+			p.interfaces = nil
+		}
+		if p.order == nil {
+			return pcapPacket{}, errors.New("pcapng: block before the section header")
+		}
+
+		blockType, length := p.order.Uint32(header), p.order.Uint32(header[4:])
+		if length < 12 || length%4 != 0 || length > pcapMaxBlockSize {
+			return pcapPacket{}, fmt.Errorf("pcapng: invalid block length %d", length)
+		}
+		block := make([]byte, length)
+		if _, err := io.ReadFull(p.r, block); err != nil {
+			return pcapPacket{}, fmt.Errorf("pcapng: truncated block: %w", err)
+		}
+		body := block[8 : length-4]
+
+		switch blockType {
+		case pcapngInterface:
+			if len(body) < 8 {
+				return pcapPacket{}, errors.New("pcapng: short interface block")
+			}
+			p.interfaces = append(p.interfaces, p.interfaceInfo(body))
+
+		case pcapngEnhancedPacket, pcapngPacket:
+			if len(body) < 20 {
+				return pcapPacket{}, errors.New("pcapng: short packet block")
+			}
+			id := p.order.Uint32(body)
+			if blockType == pcapngPacket {
+				id = uint32(p.order.Uint16(body))
+			}
+			if int(id) >= len(p.interfaces) {
+				return pcapPacket{}, fmt.Errorf("pcapng: packet of unknown interface %d", id)
+			}
+			ifi := p.interfaces[id]
+			captured := p.order.Uint32(body[12:])
+			if uint64(captured) > uint64(len(body)-20) {
+				return pcapPacket{}, errors.New("pcapng: packet longer than its block")
+			}
+			timestamp := uint64(p.order.Uint32(body[4:]))<<32 | uint64(p.order.Uint32(body[8:]))
+			p.last = ifi.time(timestamp)
+			return pcapPacket{p.last, ifi.linkType, body[20 : 20+captured]}, nil
+
+		case pcapngSimplePacket:
+			if len(p.interfaces) == 0 || len(body) < 4 {
+				return pcapPacket{}, errors.New("pcapng: simple packet without interface")
+			}
+			ifi := p.interfaces[0]
+			data := body[4:]
+			if original := p.order.Uint32(body); uint64(original) < uint64(len(data)) {
+				data = data[:original]
+			}
+			if ifi.snapLen > 0 && uint64(len(data)) > uint64(ifi.snapLen) {
+				data = data[:ifi.snapLen]
+			}
+			// Simple packets carry no timestamp
+			return pcapPacket{p.last, ifi.linkType, data}, nil
+		}
+	}
+}
+
+// interfaceInfo reads an interface description block, and its timestamp
+// resolution and offset options
+func (p *packetReader) interfaceInfo(body []byte) pcapngInterfaceInfo {
+	ifi := pcapngInterfaceInfo{
+		linkType: int(p.order.Uint16(body)),
+		snapLen:  p.order.Uint32(body[4:]),
+		units:    1000000,
+	}
+	options := body[8:]
+	for len(options) >= 4 {
+		code, length := p.order.Uint16(options), int(p.order.Uint16(options[2:]))
+		options = options[4:]
+		if code == 0 || length > len(options) {
+			break
+		}
+		value := options[:length]
+		switch {
+		case code == 9 && length == 1:
+			// if_tsresol, a power of 10, or of 2 with the high bit set
+			exponent := value[0] & 0x7f
+			base := uint64(10)
+			if value[0]&0x80 != 0 {
+				base = 2
+			}
+			if exponent <= 19 && (base == 10 || exponent < 64) {
+				ifi.units = 1
+				for i := 0; i < int(exponent); i++ {
+					ifi.units *= base
+				}
+			}
+		case code == 14 && length == 8:
+			ifi.offset = int64(p.order.Uint64(value))
+		}
+		options = options[(length+3)&^3:]
+	}
+	return ifi
+}
+
+func (ifi pcapngInterfaceInfo) time(timestamp uint64) time.Time {
+	seconds := timestamp / ifi.units
+	fraction := timestamp % ifi.units
+	nanos := uint64(math.Round(float64(fraction) * 1e9 / float64(ifi.units)))
+	return time.Unix(int64(seconds)+ifi.offset, int64(nanos))
+}
+
+// pcapReplay hands the packets of a capture to the server
+type pcapReplay struct {
+	server    *Server
+	ports     map[uint16]bool
+	flows     map[string]*tcpFlow
+	wait      sync.WaitGroup
+	fragments int
+}
+
+// tcpFlow reassembles a TCP stream into a pipe the server scans
+type tcpFlow struct {
+	next    uint32
+	pending map[uint32][]byte
+	writer  *io.PipeWriter
+}
+
+// packet decodes the link and IP layers down to UDP or TCP
+func (r *pcapReplay) packet(linkType int, data []byte) {
+	var version int
+	switch linkType {
+	case linkTypeEthernet:
+		if len(data) < 14 {
+			return
+		}
+		etherType := binary.BigEndian.Uint16(data[12:])
+		data = data[14:]
+		// VLAN tags
+		for (etherType == 0x8100 || etherType == 0x88a8) && len(data) >= 4 {
+			etherType = binary.BigEndian.Uint16(data[2:])
+			data = data[4:]
+		}
+		version = etherTypeVersion(etherType)
+	case linkTypeLinuxSLL:
+		if len(data) < 16 {
+			return
+		}
+		version = etherTypeVersion(binary.BigEndian.Uint16(data[14:]))
+		data = data[16:]
+	case linkTypeLinuxSLL2:
+		if len(data) < 20 {
+			return
+		}
+		version = etherTypeVersion(binary.BigEndian.Uint16(data))
+		data = data[20:]
+	case linkTypeNull, linkTypeLoop:
+		// The address family, in the byte order of the capturing host
+		if len(data) < 4 {
+			return
+		}
+		data = data[4:]
+	case linkTypeRaw, linkTypeIPv4, linkTypeIPv6:
+	default:
+		return
+	}
+	if version == -1 {
+		return
+	}
+
+	if len(data) == 0 {
+		return
+	}
+	switch data[0] >> 4 {
+	case 4:
+		r.ipv4(data)
+	case 6:
+		r.ipv6(data)
+	}
+}
+
+// etherTypeVersion returns the IP version of an EtherType, -1 if not IP
+func etherTypeVersion(etherType uint16) int {
+	switch etherType {
+	case 0x0800:
+		return 4
+	case 0x86dd:
+		return 6
+	}
+	return -1
+}
+
+func (r *pcapReplay) ipv4(data []byte) {
+	if len(data) < 20 {
+		return
+	}
+	headerLength := int(data[0]&0x0f) * 4
+	totalLength := int(binary.BigEndian.Uint16(data[2:]))
+	if headerLength < 20 || totalLength < headerLength || totalLength > len(data) {
+		return
+	}
+	if flags := binary.BigEndian.Uint16(data[6:]); flags&0x3fff != 0 {
+		// More fragments, or a fragment offset
+		r.fragments++
+		return
+	}
+	r.transport(data[9], net.IP(data[12:16]), net.IP(data[16:20]), data[headerLength:totalLength])
+}
+
+func (r *pcapReplay) ipv6(data []byte) {
+	if len(data) < 40 {
+		return
+	}
+	payloadLength := int(binary.BigEndian.Uint16(data[4:]))
+	if 40+payloadLength > len(data) {
+		return
+	}
+	next, payload := data[6], data[40:40+payloadLength]
+	// Hop by hop, routing and destination options extension headers
+	for next == 0 || next == 43 || next == 60 {
+		if len(payload) < 8 {
+			return
+		}
+		length := (int(payload[1]) + 1) * 8
+		if length > len(payload) {
+			return
+		}
+		next, payload = payload[0], payload[length:]
+	}
+	if next == 44 {
+		r.fragments++
+		return
+	}
+	r.transport(next, net.IP(data[8:24]), net.IP(data[24:40]), payload)
+}
+
+func (r *pcapReplay) transport(protocol byte, source net.IP, destination net.IP, data []byte) {
+	switch protocol {
+	case 17:
+		if len(data) < 8 || !r.ports[binary.BigEndian.Uint16(data[2:])] {
+			return
+		}
+		length := int(binary.BigEndian.Uint16(data[4:]))
+		if length < 8 || length > len(data) {
+			length = len(data)
+		}
+		client := net.JoinHostPort(source.String(), strconv.Itoa(int(binary.BigEndian.Uint16(data))))
+		payload := append([]byte(nil), data[8:length]...)
+		if n := r.server.trimDatagram(payload); n > 0 {
+			r.server.parseDatagram(nil, payload[:n], client, "", nil)
+		}
+
+	case 6:
+		if len(data) < 20 || !r.ports[binary.BigEndian.Uint16(data[2:])] {
+			return
+		}
+		offset := int(data[12]>>4) * 4
+		if offset < 20 || offset > len(data) {
+			return
+		}
+		client := net.JoinHostPort(source.String(), strconv.Itoa(int(binary.BigEndian.Uint16(data))))
+		key := client + ">" + net.JoinHostPort(destination.String(), strconv.Itoa(int(binary.BigEndian.Uint16(data[2:]))))
+		r.segment(key, client, binary.BigEndian.Uint32(data[4:]), data[13], data[offset:])
+	}
+}
+
+// segment adds a TCP segment to its stream
+func (r *pcapReplay) segment(key string, client string, seq uint32, flags byte, payload []byte) {
+	const (
+		fin = 0x01
+		syn = 0x02
+		rst = 0x04
+	)
+
+	flow, ok := r.flows[key]
+	if !ok || flags&syn != 0 {
+		if ok {
+			r.end(key, flow)
+		}
+		if flags&(fin|rst) != 0 && len(payload) == 0 {
+			return
+		}
+		flow = r.start(client)
+		flow.next = seq
+		if flags&syn != 0 {
+			flow.next++
+		}
+		r.flows[key] = flow
+	}
+
+	if len(payload) > 0 {
+		if ahead := int32(seq - flow.next); ahead > 0 {
+			if len(flow.pending) >= tcpMaxPending {
+				r.server.report(fmt.Errorf("pcap: %s: too many segments missing, dropping the stream", client))
+				r.end(key, flow)
+				return
+			}
+			flow.pending[seq] = append([]byte(nil), payload...)
+		} else {
+			flow.write(seq, payload)
+		}
+		flow.flushPending()
+	}
+
+	if flags&(fin|rst) != 0 {
+		r.end(key, flow)
+	}
+}
+
+// write appends the part of a segment at seq which is new to the stream
+func (f *tcpFlow) write(seq uint32, payload []byte) {
+	behind := int(f.next - seq)
+	if behind >= len(payload) {
+		// Retransmitted
+		return
+	}
+	payload = payload[behind:]
+	f.next += uint32(len(payload))
+	// The scanner stops reading on error, writes fail from then on
+	f.writer.Write(payload)
+}
+
+// flushPending writes the out of order segments the stream caught up with
+func (f *tcpFlow) flushPending() {
+	for len(f.pending) > 0 {
+		found := false
+		for seq, payload := range f.pending {
+			if int32(seq-f.next) <= 0 {
+				delete(f.pending, seq)
+				f.write(seq, payload)
+				found = true
+			}
+		}
+		if !found {
+			return
+		}
+	}
+}
+
+// start scans a new stream from client
+func (r *pcapReplay) start(client string) *tcpFlow {
+	reader, writer := io.Pipe()
+	r.wait.Add(1)
+	go func() {
+		defer r.wait.Done()
+		err := r.server.ingest(nil, reader, client, nil, nil)
+		if err != nil {
+			r.server.report(fmt.Errorf("pcap: %s: %w", client, err))
+		}
+		reader.CloseWithError(io.ErrClosedPipe)
+	}()
+	return &tcpFlow{pending: map[uint32][]byte{}, writer: writer}
+}
+
+func (r *pcapReplay) end(key string, flow *tcpFlow) {
+	flow.writer.Close()
+	delete(r.flows, key)
+}
+
+// close ends the streams still open and waits for their messages
+func (r *pcapReplay) close() {
+	for key, flow := range r.flows {
+		r.end(key, flow)
+	}
+	r.wait.Wait()
+}
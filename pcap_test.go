@@ -0,0 +1,202 @@
+package syslog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"sort"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type pcapTestPacket struct {
+	at   time.Duration
+	data []byte
+}
+
+func udpPayload(srcPort, dstPort int, payload string) []byte {
+	udp := make([]byte, 8, 8+len(payload))
+	binary.BigEndian.PutUint16(udp, uint16(srcPort))
+	binary.BigEndian.PutUint16(udp[2:], uint16(dstPort))
+	binary.BigEndian.PutUint16(udp[4:], uint16(8+len(payload)))
+	return append(udp, payload...)
+}
+
+func tcpPayload(srcPort, dstPort int, seq uint32, flags byte, payload string) []byte {
+	tcp := make([]byte, 20, 20+len(payload))
+	binary.BigEndian.PutUint16(tcp, uint16(srcPort))
+	binary.BigEndian.PutUint16(tcp[2:], uint16(dstPort))
+	binary.BigEndian.PutUint32(tcp[4:], seq)
+	tcp[12] = 5 << 4
+	tcp[13] = flags
+	return append(tcp, payload...)
+}
+
+func ipv4Packet(src, dst string, protocol byte, payload []byte) []byte {
+	ip := make([]byte, 20, 20+len(payload))
+	ip[0] = 0x45
+	binary.BigEndian.PutUint16(ip[2:], uint16(20+len(payload)))
+	ip[8] = 64
+	ip[9] = protocol
+	copy(ip[12:], net.ParseIP(src).To4())
+	copy(ip[16:], net.ParseIP(dst).To4())
+	return append(ip, payload...)
+}
+
+func ipv6Packet(src, dst string, protocol byte, payload []byte) []byte {
+	ip := make([]byte, 40, 40+len(payload))
+	ip[0] = 0x60
+	binary.BigEndian.PutUint16(ip[4:], uint16(len(payload)))
+	ip[6] = protocol
+	ip[7] = 64
+	copy(ip[8:], net.ParseIP(src))
+	copy(ip[24:], net.ParseIP(dst))
+	return append(ip, payload...)
+}
+
+func ethernetFrame(ip []byte) []byte {
+	frame := make([]byte, 14, 14+len(ip))
+	binary.BigEndian.PutUint16(frame[12:], 0x0800)
+	return append(frame, ip...)
+}
+
+func writeTestPcap(packets []pcapTestPacket) []byte {
+	var b bytes.Buffer
+	header := make([]byte, 24)
+	binary.LittleEndian.PutUint32(header, pcapMagicMicro)
+	binary.LittleEndian.PutUint16(header[4:], 2)
+	binary.LittleEndian.PutUint16(header[6:], 4)
+	binary.LittleEndian.PutUint32(header[16:], 65535)
+	binary.LittleEndian.PutUint32(header[20:], linkTypeEthernet)
+	b.Write(header)
+
+	start := time.Unix(1700000000, 0)
+	for _, packet := range packets {
+		at := start.Add(packet.at)
+		record := make([]byte, 16)
+		binary.LittleEndian.PutUint32(record, uint32(at.Unix()))
+		binary.LittleEndian.PutUint32(record[4:], uint32(at.Nanosecond()/1000))
+		binary.LittleEndian.PutUint32(record[8:], uint32(len(packet.data)))
+		binary.LittleEndian.PutUint32(record[12:], uint32(len(packet.data)))
+		b.Write(record)
+		b.Write(packet.data)
+	}
+	return b.Bytes()
+}
+
+func pcapngBlock(blockType uint32, body []byte) []byte {
+	order := binary.BigEndian
+	for len(body)%4 != 0 {
+		body = append(body, 0)
+	}
+	block := make([]byte, 8, 12+len(body))
+	order.PutUint32(block, blockType)
+	order.PutUint32(block[4:], uint32(12+len(body)))
+	block = append(block, body...)
+	return order.AppendUint32(block, uint32(12+len(body)))
+}
+
+// writeTestPcapng writes big endian sections with raw IP packets and
+// nanosecond timestamps
+func writeTestPcapng(packets []pcapTestPacket) []byte {
+	order := binary.BigEndian
+	var b bytes.Buffer
+
+	section := order.AppendUint32(nil, pcapngByteOrderMagic)
+	section = order.AppendUint16(section, 1)
+	section = order.AppendUint16(section, 0)
+	section = order.AppendUint64(section, ^uint64(0))
+	b.Write(pcapngBlock(pcapngSectionHeader, section))
+
+	ifi := order.AppendUint16(nil, linkTypeRaw)
+	ifi = order.AppendUint16(ifi, 0)
+	ifi = order.AppendUint32(ifi, 0)
+	// if_tsresol 9, then the end of options
+	ifi = append(ifi, 0, 9, 0, 1, 9, 0, 0, 0, 0, 0, 0, 0)
+	b.Write(pcapngBlock(pcapngInterface, ifi))
+
+	// An unknown block to skip
+	b.Write(pcapngBlock(0xbad, []byte{1, 2, 3, 4}))
+
+	start := uint64(time.Unix(1700000000, 0).UnixNano())
+	for _, packet := range packets {
+		at := start + uint64(packet.at)
+		epb := order.AppendUint32(nil, 0)
+		epb = order.AppendUint32(epb, uint32(at>>32))
+		epb = order.AppendUint32(epb, uint32(at))
+		epb = order.AppendUint32(epb, uint32(len(packet.data)))
+		epb = order.AppendUint32(epb, uint32(len(packet.data)))
+		epb = append(epb, packet.data...)
+		b.Write(pcapngBlock(pcapngEnhancedPacket, epb))
+	}
+	return b.Bytes()
+}
+
+func replayedMessages(c *C, channel LogPartsChannel) map[string][]string {
+	close(channel)
+	messages := map[string][]string{}
+	for logParts := range channel {
+		client := logParts["client"].(string)
+		messages[client] = append(messages[client], logParts["message"].(string))
+	}
+	for _, texts := range messages {
+		sort.Strings(texts)
+	}
+	return messages
+}
+
+func (s *ServerSuite) TestReplayPcap(c *C) {
+	line := func(text string) string {
+		return "<34>1 2003-10-11T22:14:15.003Z host app - - - " + text
+	}
+	const syn, fin = 0x02, 0x01
+	stream := line("tcp one") + "\n" + line("tcp two") + "\n"
+	cut := 20
+
+	packets := []pcapTestPacket{
+		{0, ethernetFrame(ipv4Packet("10.0.0.1", "10.0.0.9", 17, udpPayload(40000, 514, line("udp")+"\n")))},
+		{0, ethernetFrame(ipv4Packet("10.0.0.1", "10.0.0.9", 17, udpPayload(40000, 80, line("other port"))))},
+		{0, ethernetFrame(ipv4Packet("10.0.0.2", "10.0.0.9", 6, tcpPayload(40001, 514, 999, syn, "")))},
+		// Out of order, then retransmitted
+		{0, ethernetFrame(ipv4Packet("10.0.0.2", "10.0.0.9", 6, tcpPayload(40001, 514, 1000+uint32(cut), 0, stream[cut:])))},
+		{0, ethernetFrame(ipv4Packet("10.0.0.2", "10.0.0.9", 6, tcpPayload(40001, 514, 1000, 0, stream[:cut+5])))},
+		{0, ethernetFrame(ipv4Packet("10.0.0.2", "10.0.0.9", 6, tcpPayload(40001, 514, 1000, 0, stream[:cut])))},
+		{0, ethernetFrame(ipv4Packet("10.0.0.2", "10.0.0.9", 6, tcpPayload(40001, 514, 1000+uint32(len(stream)), fin, "")))},
+	}
+
+	channel := make(LogPartsChannel, 10)
+	server := NewServer()
+	server.SetFormat(RFC5424)
+	server.SetHandler(NewChannelHandler(channel))
+	c.Assert(server.ReplayPcap(bytes.NewReader(writeTestPcap(packets)), PcapOptions{}), IsNil)
+
+	c.Check(replayedMessages(c, channel), DeepEquals, map[string][]string{
+		"10.0.0.1:40000": {line("udp")},
+		"10.0.0.2:40001": {line("tcp one"), line("tcp two")},
+	})
+}
+
+func (s *ServerSuite) TestReplayPcapng(c *C) {
+	message := "<34>1 2003-10-11T22:14:15.003Z host app - - - over ipv6"
+	packets := []pcapTestPacket{
+		{0, ipv6Packet("2001:db8::1", "2001:db8::9", 17, udpPayload(40000, 5514, message))},
+		{50 * time.Millisecond, ipv6Packet("2001:db8::1", "2001:db8::9", 17, udpPayload(40000, 5514, message))},
+	}
+
+	channel := make(LogPartsChannel, 10)
+	server := NewServer()
+	server.SetFormat(RFC5424)
+	server.SetHandler(NewChannelHandler(channel))
+	start := time.Now()
+	err := server.ReplayPcap(bytes.NewReader(writeTestPcapng(packets)), PcapOptions{Ports: []int{5514}, Timing: true})
+	c.Assert(err, IsNil)
+	c.Check(time.Since(start) >= 50*time.Millisecond, Equals, true)
+
+	c.Check(replayedMessages(c, channel), DeepEquals, map[string][]string{
+		"[2001:db8::1]:40000": {message, message},
+	})
+
+	err = server.ReplayPcap(bytes.NewReader([]byte("not a capture at all")), PcapOptions{})
+	c.Check(err, ErrorMatches, "pcap: not a pcap or pcapng capture")
+}
@@ -4,9 +4,13 @@ import (
 	"bufio"
 	"crypto/tls"
 	"errors"
+	"fmt"
+	"io"
 	"net"
+	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/GLMONTER/go-syslog/format"
@@ -17,6 +21,9 @@ var (
 	RFC5424   = &format.RFC5424{}   // RFC5424: http://www.ietf.org/rfc/rfc5424.txt
 	RFC6587   = &format.RFC6587{}   // RFC6587: http://www.ietf.org/rfc/rfc6587.txt - octet counting variant
 	Automatic = &format.Automatic{} // Automatically identify the format
+	GELF      = &format.GELF{}      // GELF: Graylog Extended Log Format, over UDP or TCP
+	Kmsg      = &format.Kmsg{}      // Kmsg: records of the Linux /dev/kmsg device
+	Journal   = &format.Journal{}   // Journal: systemd journal export format and native protocol
 )
 
 const (
@@ -28,19 +35,48 @@ const (
 // ok=false to terminate the connection
 type TlsPeerNameFunc func(tlsConn *tls.Conn) (tlsPeer string, ok bool)
 
+// A function type which gets the peer name from the state of a TLS or DTLS
+// session. Can return ok=false to terminate the connection
+type TlsPeerStateFunc func(state *tls.ConnectionState) (tlsPeer string, ok bool)
+
 type Server struct {
+	mu                      sync.Mutex
+	entries                 []*listener
 	listeners               []net.Listener
 	connections             []net.PacketConn
 	wait                    sync.WaitGroup
-	doneTcp                 chan bool
+	running                 bool
+	killed                  bool
+	done                    chan bool
+	parsingDatagrams        bool
 	datagramChannelSize     int
 	datagramChannel         chan DatagramMessage
 	format                  format.Format
 	handler                 Handler
 	ErrChan                 chan error
+	errMu                   sync.Mutex
+	errDone                 chan struct{}
+	errWait                 sync.WaitGroup
+	errStopped              bool
 	readTimeoutMilliseconds int64
 	tlsPeerNameFunc         TlsPeerNameFunc
+	tlsPeerStateFunc        TlsPeerStateFunc
+	customTlsPeerName       bool
 	datagramPool            sync.Pool
+	deliverTruncated        bool
+	keyValues               *format.KeyValues
+	// reassembler keeps the datagrams of the messages of a ReassemblingFormat
+	reassembler         format.DatagramFormat
+	httpAuth            HTTPAuth
+	hecTokens           []string
+	streamDecompression StreamDecompression
+	tlsReloaders        []*TlsReloader
+	crlChecker          atomic.Pointer[CRLChecker]
+	crlStop             chan struct{}
+	connHooks           ConnHooks
+	connMu              sync.Mutex
+	conns               map[uint64]*trackedConn
+	nextConnID          atomic.Uint64
 }
 
 // NewServer returns a new Server
@@ -53,12 +89,17 @@ func NewServer() *Server {
 
 		datagramChannelSize: datagramChannelBufferSize,
 		ErrChan:             make(chan error),
+		errDone:             make(chan struct{}),
 	}
 }
 
 // SetFormat Sets the syslog format (RFC3164 or RFC5424 or RFC6587)
 func (s *Server) SetFormat(f format.Format) {
 	s.format = f
+	s.reassembler = nil
+	if rf, ok := f.(format.ReassemblingFormat); ok {
+		s.reassembler = rf.NewReassembler()
+	}
 }
 
 // SetHandler Sets the handler, this handler with receive every syslog entry
@@ -71,18 +112,47 @@ func (s *Server) SetTimeout(milliseconds int64) {
 	s.readTimeoutMilliseconds = milliseconds
 }
 
-// SetTlsPeerNameFunc Set the function that extracts a TLS peer name from the TLS connection
+// SetTlsPeerNameFunc Set the function that extracts a TLS peer name from the TLS connection.
+// nil disables the peer check of TLS and DTLS sessions, unless a TlsPeerStateFunc is set.
+// DTLS sessions have no *tls.Conn, so they are rejected with ErrDTLSPeerNameFunc if the
+// function is replaced without setting a TlsPeerStateFunc
 func (s *Server) SetTlsPeerNameFunc(tlsPeerNameFunc TlsPeerNameFunc) {
 	s.tlsPeerNameFunc = tlsPeerNameFunc
+	s.customTlsPeerName = tlsPeerNameFunc != nil
+}
+
+// SetDeliverTruncated Delivers TCP frames which exceed the read buffer cut down to
+// its size, and the unfinished frame of a connection closed mid-frame, instead of
+// dropping them. Such entries carry "truncated": true
+func (s *Server) SetDeliverTruncated(deliver bool) {
+	s.deliverTruncated = deliver
+}
+
+// SetKeyValues Extracts the key=value pairs of the content, or message, of every
+// entry into "fields", a map[string]string, unless the format already did as it
+// does for FortiOS and SonicWall. nil, the default, disables the extraction
+func (s *Server) SetKeyValues(keyValues *format.KeyValues) {
+	s.keyValues = keyValues
 }
 
 func (s *Server) SetDatagramChannelSize(size int) {
 	s.datagramChannelSize = size
 }
 
+// SetTlsPeerStateFunc Set the function that names TLS and DTLS peers from the session
+// state. It takes precedence over the function set with SetTlsPeerNameFunc, which
+// only applies to TLS, and defaults to the CN of the certificate
+func (s *Server) SetTlsPeerStateFunc(tlsPeerStateFunc TlsPeerStateFunc) {
+	s.tlsPeerStateFunc = tlsPeerStateFunc
+}
+
 // Default TLS peer name function - returns the CN of the certificate
 func defaultTlsPeerName(tlsConn *tls.Conn) (tlsPeer string, ok bool) {
 	state := tlsConn.ConnectionState()
+	return defaultTlsPeerState(&state)
+}
+
+func defaultTlsPeerState(state *tls.ConnectionState) (tlsPeer string, ok bool) {
 	if len(state.PeerCertificates) <= 0 {
 		return "", false
 	}
@@ -92,46 +162,49 @@ func defaultTlsPeerName(tlsConn *tls.Conn) (tlsPeer string, ok bool) {
 
 // ListenUDP Configure the server for listen on an UDP addr
 func (s *Server) ListenUDP(addr string) error {
-	udpAddr, err := net.ResolveUDPAddr("udp", addr)
-	if err != nil {
-		return err
-	}
-
-	connection, err := net.ListenUDP("udp", udpAddr)
-	if err != nil {
-		return err
-	}
-	err = connection.SetReadBuffer(datagramReadBufferSize)
-	if err != nil {
-		go func() { s.ErrChan <- err }()
-	}
-
-	s.connections = append(s.connections, connection)
-	return nil
+	_, err := s.AddListener("udp", addr, nil)
+	return err
 }
 
 // ListenUnixgram Configure the server for listen on an unix socket
 func (s *Server) ListenUnixgram(addr string) error {
+	_, err := s.AddListener("unixgram", addr, nil)
+	return err
+}
+
+func (s *Server) openUnixgram(l *listener, addr string, reopen bool) error {
 	unixAddr, err := net.ResolveUnixAddr("unixgram", addr)
 	if err != nil {
 		return err
 	}
 
+	if reopen {
+		// Closing a datagram socket leaves its file behind
+		if info, err := os.Lstat(addr); err == nil && info.Mode()&os.ModeSocket != 0 {
+			os.Remove(addr)
+		}
+	}
+
 	connection, err := net.ListenUnixgram("unixgram", unixAddr)
 	if err != nil {
 		return err
 	}
 	err = connection.SetReadBuffer(datagramReadBufferSize)
 	if err != nil {
-		go func() { s.ErrChan <- err }()
+		s.report(err)
 	}
 
-	s.connections = append(s.connections, connection)
+	l.packet = connection
 	return nil
 }
 
 // ListenTCP Configure the server for listen on a TCP addr
 func (s *Server) ListenTCP(addr string) error {
+	_, err := s.AddListener("tcp", addr, nil)
+	return err
+}
+
+func openTCP(l *listener, addr string, reopen bool) error {
 	tcpAddr, err := net.ResolveTCPAddr("tcp", addr)
 	if err != nil {
 		return err
@@ -142,24 +215,30 @@ func (s *Server) ListenTCP(addr string) error {
 		return err
 	}
 
-	s.doneTcp = make(chan bool)
-	s.listeners = append(s.listeners, listener)
+	l.stream = listener
 	return nil
 }
 
 // ListenTCPTLS Configures the server for listen on a TCP addr for TLS
 func (s *Server) ListenTCPTLS(addr string, config *tls.Config) error {
-	listener, err := tls.Listen("tcp", addr, config)
-	if err != nil {
-		return err
-	}
+	_, err := s.AddListener("tls", addr, config)
+	return err
+}
 
-	s.doneTcp = make(chan bool)
-	s.listeners = append(s.listeners, listener)
-	return nil
+func openTLS(config *tls.Config) func(l *listener, addr string, reopen bool) error {
+	return func(l *listener, addr string, reopen bool) error {
+		listener, err := tls.Listen("tcp", addr, config)
+		if err != nil {
+			return err
+		}
+
+		l.stream = listener
+		return nil
+	}
 }
 
-// Boot Starts the server, all the go routines goes to live
+// Boot Starts the server, all the go routines goes to live. Booting a running
+// server does nothing, booting a killed one binds its listeners again.
 func (s *Server) Boot() error {
 	if s.format == nil {
 		return errors.New("please set a valid format")
@@ -169,51 +248,77 @@ func (s *Server) Boot() error {
 		return errors.New("please set a valid handler")
 	}
 
-	for _, listener := range s.listeners {
-		s.goAcceptConnection(listener)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.running {
+		return nil
+	}
+
+	if s.killed {
+		// Let the goroutines of the killed server finish first
+		s.wait.Wait()
+		for _, l := range s.entries {
+			if err := l.open(l, l.bound, true); err != nil {
+				return err
+			}
+		}
+		s.refreshListeners()
+		s.resumeErrors()
+		s.killed = false
+	}
+
+	s.running = true
+	s.done = make(chan bool)
+
+	for _, reloader := range s.tlsReloaders {
+		s.goWatchTls(reloader)
 	}
 
-	if len(s.connections) > 0 {
-		s.goParseDatagrams()
+	if checker := s.crlChecker.Load(); checker != nil {
+		s.goWatchCRLs(checker)
 	}
 
-	for _, connection := range s.connections {
-		s.goReceiveDatagrams(connection)
+	for _, l := range s.entries {
+		s.startListener(l)
 	}
 
 	return nil
 }
 
-func (s *Server) goAcceptConnection(listener net.Listener) {
-	s.wait.Add(1)
+func (s *Server) goAcceptConnection(l *listener) {
+	listener, done := l.stream, l.done
 
-	go func(listener net.Listener) {
-	loop:
+	s.spawn(l, func() {
 		for {
-			select {
-			case <-s.doneTcp:
-				break loop
-			default:
-			}
 			connection, err := listener.Accept()
 			if err != nil {
+				select {
+				case <-done:
+					return
+				default:
+				}
 				continue
 			}
 
-			s.goScanConnection(connection)
+			if l.kind == forwardListener {
+				s.goServeForward(l, connection)
+			} else {
+				s.goScanListenerConnection(l, connection)
+			}
 		}
-		s.wait.Done()
-	}(listener)
+	})
 }
 
 func (s *Server) goScanConnection(connection net.Conn) {
-	scanner := bufio.NewScanner(connection)
-
-	buf := make([]byte, datagramReadBufferSize)
-	scanner.Buffer(buf, datagramReadBufferSize)
+	s.goScanListenerConnection(nil, connection)
+}
 
-	if sf := s.format.GetSplitFunc(); sf != nil {
-		scanner.Split(sf)
+// goScanListenerConnection scans a connection l accepted, l may be nil
+func (s *Server) goScanListenerConnection(l *listener, connection net.Conn) {
+	if l != nil && !l.track(connection) {
+		connection.Close()
+		return
 	}
 
 	remoteAddr := connection.RemoteAddr()
@@ -222,73 +327,191 @@ func (s *Server) goScanConnection(connection net.Conn) {
 		client = remoteAddr.String()
 	}
 
+	conn := s.openConn(l, client)
+	closeConnection := func(reason error) {
+		if l != nil {
+			l.untrack(connection)
+		}
+		err := connection.Close()
+		if err != nil {
+			s.report(err)
+		}
+		s.closeConn(conn, reason)
+	}
+
+	var reader io.Reader = countingReader{connection, conn}
+	if s.streamDecompression.Enabled {
+		reader = newDecompressingReader(reader, s.streamDecompression, func(err error) {
+			s.report(fmt.Errorf("%s: %w", client, err))
+		})
+	}
+	scanner, splitter := s.newScanner(reader, client)
+
 	tlsPeer := ""
+	var connParts format.LogParts
 	if tlsConn, ok := connection.(*tls.Conn); ok {
 		// Handshake now so we get the TLS peer information
 		if err := tlsConn.Handshake(); err != nil {
-			err := connection.Close()
-			if err != nil {
-				go func() { s.ErrChan <- err }()
-			}
+			closeConnection(err)
+			return
+		}
+		state := tlsConn.ConnectionState()
+		if err := s.tlsPeerRevoked(&state, client); err != nil {
+			closeConnection(err)
 			return
 		}
-		if s.tlsPeerNameFunc != nil {
+		if s.tlsPeerStateFunc != nil || s.tlsPeerNameFunc != nil {
 			var ok bool
-			tlsPeer, ok = s.tlsPeerNameFunc(tlsConn)
+			if s.tlsPeerStateFunc != nil {
+				tlsPeer, ok = s.tlsPeerStateFunc(&state)
+			} else {
+				tlsPeer, ok = s.tlsPeerNameFunc(tlsConn)
+			}
 			if !ok {
-				err := connection.Close()
-				if err != nil {
-					go func() { s.ErrChan <- err }()
-				}
+				closeConnection(ErrPeerRejected)
 				return
 			}
 		}
+		connParts = tlsConnParts(&state)
+		s.authenticated(conn, tlsPeer, &state)
 	}
 
 	var scanCloser *ScanCloser
-	scanCloser = &ScanCloser{scanner, connection}
+	scanCloser = &ScanCloser{scanner, connection, splitter}
 
-	s.wait.Add(1)
-	go s.scan(scanCloser, client, tlsPeer)
+	s.spawn(l, func() {
+		reason := s.scan(l, scanCloser, conn, client, tlsPeer, connParts)
+		if l != nil {
+			l.untrack(connection)
+		}
+		s.closeConn(conn, reason)
+	})
 }
 
-func (s *Server) scan(scanCloser *ScanCloser, client string, tlsPeer string) {
+// newScanner returns a scanner splitting the stream of client into the
+// frames of the server format
+func (s *Server) newScanner(reader io.Reader, client string) (*bufio.Scanner, frameSplitter) {
+	scanner := bufio.NewScanner(reader)
+
+	buf := make([]byte, datagramReadBufferSize)
+	scanner.Buffer(buf, datagramReadBufferSize)
+
+	var splitter frameSplitter
+	if ff, ok := s.format.(format.FramingFormat); ok {
+		framer := ff.GetFramer(func(err error) {
+			s.report(fmt.Errorf("%s: %w", client, err))
+		})
+		framer.FitBuffer(datagramReadBufferSize)
+		framer.SetTruncate(s.deliverTruncated)
+		splitter = framer
+		scanner.Split(framer.Split)
+	} else if s.deliverTruncated {
+		splitter = newTruncatingSplitter(s.format.GetSplitFunc(), datagramReadBufferSize)
+		scanner.Split(splitter.Split)
+	} else if sf := s.format.GetSplitFunc(); sf != nil {
+		scanner.Split(sf)
+	}
+	return scanner, splitter
+}
+
+// tlsConnParts returns the parts every message of a TLS or DTLS session carries
+func tlsConnParts(state *tls.ConnectionState) format.LogParts {
+	if len(state.PeerCertificates) == 0 {
+		return nil
+	}
+	return format.LogParts{"tls_chain": tlsChainSummary(state)}
+}
+
+// scan delivers the messages of a connection of l, which may be nil, until
+// it ends, returning why. A draining listener's connections are read until
+// their drain deadline.
+func (s *Server) scan(l *listener, scanCloser *ScanCloser, conn *trackedConn, client string, tlsPeer string, connParts format.LogParts) error {
+	var done chan bool
+	if l != nil {
+		done = l.done
+	}
 loop:
 	for {
 		select {
-		case <-s.doneTcp:
-			break loop
-		default:
-		}
-		if s.readTimeoutMilliseconds > 0 {
-			err := scanCloser.closer.SetReadDeadline(time.Now().Add(time.Duration(s.readTimeoutMilliseconds) * time.Millisecond))
-			if err != nil {
-				go func() { s.ErrChan <- err }()
+		case <-done:
+			if !l.isDraining() {
+				break loop
 			}
+		default:
 		}
+		s.setReadTimeout(l, scanCloser.closer)
 		if scanCloser.Scan() {
-			s.parser([]byte(scanCloser.Text()), client, tlsPeer)
+			conn.messages.Add(1)
+			s.parser(l, []byte(scanCloser.Text()), client, tlsPeer, scanCloser.frameParts(connParts))
 		} else {
 			break loop
 		}
 	}
 	err := scanCloser.closer.Close()
 	if err != nil {
-		go func() { s.ErrChan <- err }()
+		s.report(err)
 	}
 
-	s.wait.Done()
+	select {
+	case <-done:
+		return ErrListenerStopped
+	default:
+		return scanCloser.Err()
+	}
 }
 
-func (s *Server) parser(line []byte, client string, tlsPeer string) {
-	parser := s.format.GetParser(line)
+// parser parses line, received by l which may be nil, and hands it to the
+// handler, along with the extra parts the transport knows about the message
+func (s *Server) parser(l *listener, line []byte, client string, tlsPeer string, extra format.LogParts) {
+	f := s.formatOf(l)
+	parser := f.GetParser(line)
 	err := parser.Parse()
 	if err != nil {
-		go func() { s.ErrChan <- err }()
+		s.report(err)
 	}
 
 	logParts := parser.Dump()
 
+	if logParts["hostname"] == "" && isRFC3164(f) {
+		if i := strings.Index(client, ":"); i > 1 {
+			logParts["hostname"] = client[:i]
+		} else {
+			logParts["hostname"] = client
+		}
+	}
+
+	if _, ok := logParts["fields"]; !ok && s.keyValues != nil {
+		s.extractKeyValues(logParts)
+	}
+
+	s.deliver(logParts, int64(len(line)), err, client, tlsPeer, extra)
+}
+
+// isRFC3164 tells if f parses RFC3164 messages, which may have no hostname
+func isRFC3164(f format.Format) bool {
+	switch f.(type) {
+	case *format.RFC3164, *format.Automatic:
+		return true
+	}
+	return false
+}
+
+// extractKeyValues sets the key=value pairs of the content or message of
+// logParts as its "fields", if it has any
+func (s *Server) extractKeyValues(logParts format.LogParts) {
+	for _, name := range []string{"content", "message"} {
+		if text, ok := logParts[name].(string); ok {
+			if fields := s.keyValues.Parse(text); len(fields) > 0 {
+				logParts["fields"] = fields
+			}
+			return
+		}
+	}
+}
+
+// deliver hands logParts to the handler, once completed with the parts every
+// message carries
+func (s *Server) deliver(logParts format.LogParts, length int64, err error, client string, tlsPeer string, extra format.LogParts) {
 	timestamp, ok := logParts["timestamp"]
 	if !ok {
 		logParts["timestamp"] = time.Now().UTC()
@@ -298,46 +521,39 @@ func (s *Server) parser(line []byte, client string, tlsPeer string) {
 	}
 
 	logParts["client"] = client
-	if logParts["hostname"] == "" && (s.format == RFC3164 || s.format == Automatic) {
-		if i := strings.Index(client, ":"); i > 1 {
-			logParts["hostname"] = client[:i]
-		} else {
-			logParts["hostname"] = client
-		}
-	}
 	logParts["tls_peer"] = tlsPeer
+	for k, v := range extra {
+		logParts[k] = v
+	}
 
-	s.handler.Handle(logParts, int64(len(line)), err)
+	s.handler.Handle(logParts, length, err)
 }
 
-// Kill the server
+// Kill the server. Its listeners are closed, but kept for Boot to bind them
+// again. The errors ErrChan did not deliver yet are dropped, and so are the
+// ones until Boot.
 func (s *Server) Kill() error {
-	for _, connection := range s.connections {
-		err := connection.Close()
-		if err != nil {
-			return err
-		}
-	}
-
-	for _, listener := range s.listeners {
-		err := listener.Close()
-		if err != nil {
-			return err
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var firstErr error
+	for _, l := range s.entries {
+		err := s.stopListener(l, false)
+		if err != nil && firstErr == nil {
+			firstErr = err
 		}
 	}
+	s.killed = len(s.entries) > 0
 
 	// Only need to close channel once to broadcast to all waiting
-	if s.doneTcp != nil {
-		close(s.doneTcp)
-	}
-	if s.datagramChannel != nil {
-		close(s.datagramChannel)
-	}
-	if s.ErrChan != nil {
-		close(s.ErrChan)
+	if s.running {
+		close(s.done)
+		s.running = false
 	}
+	s.parsingDatagrams = false
+	s.stopErrors()
 
-	return nil
+	return firstErr
 }
 
 // Wait Waits until the server stops
@@ -352,32 +568,53 @@ type TimeoutCloser interface {
 
 type ScanCloser struct {
 	*bufio.Scanner
-	closer TimeoutCloser
+	closer   TimeoutCloser
+	splitter frameSplitter
+}
+
+// Truncated reports whether the last scanned frame was cut short
+func (s *ScanCloser) Truncated() bool {
+	return s.splitter != nil && s.splitter.Truncated()
+}
+
+// frameParts returns the extra parts of the last scanned frame, connParts
+// along with whether it was truncated
+func (s *ScanCloser) frameParts(connParts format.LogParts) format.LogParts {
+	if !s.Truncated() {
+		return connParts
+	}
+	extra := format.LogParts{"truncated": true}
+	for k, v := range connParts {
+		extra[k] = v
+	}
+	return extra
 }
 
 type DatagramMessage struct {
-	message []byte
-	client  string
+	message  []byte
+	client   string
+	listener *listener
 }
 
-func (s *Server) goReceiveDatagrams(packetconn net.PacketConn) {
-	s.wait.Add(1)
-	go func() {
-		defer s.wait.Done()
+func (s *Server) goReceiveDatagrams(l *listener) {
+	packetconn, done, datagramChannel := l.packet, l.done, s.datagramChannel
 
+	s.spawn(l, func() {
 		for {
 			buf := s.datagramPool.Get().([]byte)
 			n, addr, err := packetconn.ReadFrom(buf)
 			if err == nil {
-				// Ignore trailing control characters and NULs
-				for ; (n > 0) && (buf[n-1] < 32); n-- {
-				}
+				n = s.trimDatagram(buf[:n])
 				if n > 0 {
 					var address string
 					if addr != nil {
 						address = addr.String()
 					}
-					s.datagramChannel <- DatagramMessage{buf[:n], address}
+					select {
+					case datagramChannel <- DatagramMessage{buf[:n], address, l}:
+					case <-done:
+						return
+					}
 				}
 			} else {
 				// there has been an error. Either the server has been killed
@@ -391,31 +628,73 @@ func (s *Server) goReceiveDatagrams(packetconn net.PacketConn) {
 				time.Sleep(10 * time.Millisecond)
 			}
 		}
-	}()
+	})
 }
 
+// goParseDatagrams parses the datagrams of every packet listener until the
+// server is killed. s.mu is held.
 func (s *Server) goParseDatagrams() {
 	s.datagramChannel = make(chan DatagramMessage, s.datagramChannelSize)
+	s.parsingDatagrams = true
+	datagramChannel, done := s.datagramChannel, s.done
 
-	s.wait.Add(1)
-	go func() {
-		defer s.wait.Done()
-
+	s.spawn(nil, func() {
 		for {
 			select {
-			case msg, ok := <-s.datagramChannel:
+			case msg, ok := <-datagramChannel:
 				if !ok {
 					return
 				}
-				if sf := s.format.GetSplitFunc(); sf != nil {
-					if _, token, err := sf(msg.message, true); err == nil {
-						s.parser(token, msg.client, "")
-					}
-				} else {
-					s.parser(msg.message, msg.client, "")
-				}
+				s.parseDatagram(msg.listener, msg.message, msg.client, "", nil)
 				s.datagramPool.Put(msg.message[:cap(msg.message)])
+			case <-done:
+				return
+			}
+		}
+	})
+}
+
+// parseDatagram parses a single datagram of l, which may be nil. It may still
+// carry RFC6587 framing, every frame of it is parsed.
+func (s *Server) parseDatagram(l *listener, message []byte, client string, tlsPeer string, extra format.LogParts) {
+	if df, ok := s.format.(format.DatagramFormat); ok {
+		if s.reassembler != nil {
+			df = s.reassembler
+		}
+		message, err := df.Reassemble(message, client)
+		if err != nil {
+			s.report(fmt.Errorf("%s: %w", client, err))
+		}
+		if message != nil {
+			s.parser(l, message, client, tlsPeer, extra)
+		}
+		return
+	}
+
+	if sf := s.format.GetSplitFunc(); sf != nil {
+		for len(message) > 0 {
+			advance, token, err := sf(message, true)
+			if err != nil || advance == 0 {
+				return
+			}
+			message = message[advance:]
+			if token != nil {
+				s.parser(l, token, client, tlsPeer, extra)
 			}
 		}
-	}()
+	} else {
+		s.parser(l, message, client, tlsPeer, extra)
+	}
+}
+
+// trimDatagram returns the length of datagram without its trailing control
+// characters and NULs. Binary datagrams, of a DatagramFormat, are kept whole.
+func (s *Server) trimDatagram(datagram []byte) int {
+	n := len(datagram)
+	if _, ok := s.format.(format.DatagramFormat); ok {
+		return n
+	}
+	for ; (n > 0) && (datagram[n-1] < 32); n-- {
+	}
+	return n
 }
@@ -77,8 +77,8 @@ func BenchmarkDatagramNoFormatting(b *testing.B) {
 	server.SetFormat(noopFormatter{})
 	server.SetHandler(handler)
 	reader, writer := io.Pipe()
-	server.goReceiveDatagrams(&fakePacketConn{PipeReader: reader})
 	server.goParseDatagrams()
+	server.goReceiveDatagrams(&listener{packet: &fakePacketConn{PipeReader: reader}})
 	msg := []byte(exampleSyslog + "\n")
 	b.SetBytes(int64(len(msg)))
 	for i := 0; i < b.N; i++ {
@@ -158,7 +158,7 @@ func (s *ServerSuite) TestUDP3164(c *C) {
 	server.SetHandler(handler)
 	server.SetTimeout(10)
 	server.goParseDatagrams()
-	server.datagramChannel <- DatagramMessage{[]byte(exampleSyslog), "0.0.0.0"}
+	server.datagramChannel <- DatagramMessage{[]byte(exampleSyslog), "0.0.0.0", nil}
 	close(server.datagramChannel)
 	server.Wait()
 	c.Check(handler.LastLogParts["hostname"], Equals, "hostname")
@@ -175,7 +175,7 @@ func (s *ServerSuite) TestUDP3164NoTag(c *C) {
 	server.SetHandler(handler)
 	server.SetTimeout(10)
 	server.goParseDatagrams()
-	server.datagramChannel <- DatagramMessage{[]byte(exampleSyslogNoTSTagHost), "127.0.0.1:45789"}
+	server.datagramChannel <- DatagramMessage{[]byte(exampleSyslogNoTSTagHost), "127.0.0.1:45789", nil}
 	close(server.datagramChannel)
 	server.Wait()
 	c.Check(handler.LastLogParts["hostname"], Equals, "127.0.0.1")
@@ -192,7 +192,7 @@ func (s *ServerSuite) TestUDPAutomatic3164NoPriority(c *C) {
 	server.SetHandler(handler)
 	server.SetTimeout(10)
 	server.goParseDatagrams()
-	server.datagramChannel <- DatagramMessage{[]byte(exampleSyslogNoPriority), "127.0.0.1:45789"}
+	server.datagramChannel <- DatagramMessage{[]byte(exampleSyslogNoPriority), "127.0.0.1:45789", nil}
 	close(server.datagramChannel)
 	server.Wait()
 	c.Check(handler.LastLogParts["hostname"], Equals, "127.0.0.1")
@@ -211,7 +211,7 @@ func (s *ServerSuite) TestUDP6587(c *C) {
 	server.SetTimeout(10)
 	server.goParseDatagrams()
 	framedSyslog := []byte(fmt.Sprintf("%d %s", len(exampleRFC5424Syslog), exampleRFC5424Syslog))
-	server.datagramChannel <- DatagramMessage{[]byte(framedSyslog), "0.0.0.0"}
+	server.datagramChannel <- DatagramMessage{[]byte(framedSyslog), "0.0.0.0", nil}
 	close(server.datagramChannel)
 	server.Wait()
 	c.Check(handler.LastLogParts["hostname"], Equals, "mymachine.example.com")
@@ -228,7 +228,7 @@ func (s *ServerSuite) TestUDPAutomatic3164(c *C) {
 	server.SetHandler(handler)
 	server.SetTimeout(10)
 	server.goParseDatagrams()
-	server.datagramChannel <- DatagramMessage{[]byte(exampleSyslog), "0.0.0.0"}
+	server.datagramChannel <- DatagramMessage{[]byte(exampleSyslog), "0.0.0.0", nil}
 	close(server.datagramChannel)
 	server.Wait()
 	c.Check(handler.LastLogParts["hostname"], Equals, "hostname")
@@ -245,7 +245,7 @@ func (s *ServerSuite) TestUDPAutomatic5424(c *C) {
 	server.SetHandler(handler)
 	server.SetTimeout(10)
 	server.goParseDatagrams()
-	server.datagramChannel <- DatagramMessage{[]byte(exampleRFC5424Syslog), "0.0.0.0"}
+	server.datagramChannel <- DatagramMessage{[]byte(exampleRFC5424Syslog), "0.0.0.0", nil}
 	close(server.datagramChannel)
 	server.Wait()
 	c.Check(handler.LastLogParts["hostname"], Equals, "mymachine.example.com")
@@ -263,7 +263,7 @@ func (s *ServerSuite) TestUDPAutomatic3164Plus6587OctetCount(c *C) {
 	server.SetTimeout(10)
 	server.goParseDatagrams()
 	framedSyslog := []byte(fmt.Sprintf("%d %s", len(exampleSyslog), exampleSyslog))
-	server.datagramChannel <- DatagramMessage{[]byte(framedSyslog), "0.0.0.0"}
+	server.datagramChannel <- DatagramMessage{[]byte(framedSyslog), "0.0.0.0", nil}
 	close(server.datagramChannel)
 	server.Wait()
 	c.Check(handler.LastLogParts["hostname"], Equals, "hostname")
@@ -281,7 +281,7 @@ func (s *ServerSuite) TestUDPAutomatic5424Plus6587OctetCount(c *C) {
 	server.SetTimeout(10)
 	server.goParseDatagrams()
 	framedSyslog := []byte(fmt.Sprintf("%d %s", len(exampleRFC5424Syslog), exampleRFC5424Syslog))
-	server.datagramChannel <- DatagramMessage{[]byte(framedSyslog), "0.0.0.0"}
+	server.datagramChannel <- DatagramMessage{[]byte(framedSyslog), "0.0.0.0", nil}
 	close(server.datagramChannel)
 	server.Wait()
 	c.Check(handler.LastLogParts["hostname"], Equals, "mymachine.example.com")
@@ -345,3 +345,60 @@ func (s *ServerSuite) TestTCPRace(c *C) {
 	<-handler.done
 	c.Check(handler.contents, DeepEquals, []string{"content1", "content2", "content3"})
 }
+
+func (s *ServerSuite) TestTCPFramingErrorResync(c *C) {
+	handler := new(HandlerMock)
+	server := NewServer()
+	server.SetFormat(RFC6587)
+	server.SetHandler(handler)
+	con := ConnMock{ReadData: []byte("garbage\n" + exampleRFC5424Syslog + "\n")}
+	server.goScanConnection(&con)
+	err := <-server.ErrChan
+	server.Wait()
+	c.Check(err, ErrorMatches, ": framing error: frame does not start with a length or a priority \\(8 bytes discarded\\)")
+	c.Check(handler.LastLogParts["hostname"], Equals, "mymachine.example.com")
+	c.Check(handler.LastMessageLength, Equals, int64(len(exampleRFC5424Syslog)))
+	c.Check(con.isClosed, Equals, true)
+}
+
+func (s *ServerSuite) TestTCPDeliverTruncated(c *C) {
+	handler := new(HandlerMock)
+	server := NewServer()
+	server.SetFormat(RFC6587)
+	server.SetHandler(handler)
+	server.SetDeliverTruncated(true)
+	framedSyslog := fmt.Sprintf("%d %s", len(exampleRFC5424Syslog)+10, exampleRFC5424Syslog)
+	con := ConnMock{ReadData: []byte(framedSyslog)}
+	server.goScanConnection(&con)
+	server.Wait()
+	c.Check(handler.LastLogParts["hostname"], Equals, "mymachine.example.com")
+	c.Check(handler.LastLogParts["truncated"], Equals, true)
+	c.Check(handler.LastMessageLength, Equals, int64(len(exampleRFC5424Syslog)))
+}
+
+func (s *ServerSuite) TestKeyValues(c *C) {
+	handler := new(handlerCollector)
+	server := NewServer()
+	server.SetFormat(RFC5424)
+	server.SetHandler(handler)
+
+	line := `<34>1 2003-10-11T22:14:15.003Z host app - - - action=deny srcip=10.0.0.1 msg="connection refused"`
+	server.parser(nil, []byte(line), "10.0.0.1:514", "", nil)
+	c.Check(handler.logParts[0]["fields"], IsNil)
+
+	server.SetKeyValues(&format.KeyValues{})
+	server.parser(nil, []byte(line), "10.0.0.1:514", "", nil)
+	c.Check(handler.logParts[1]["fields"], DeepEquals, map[string]string{
+		"action": "deny",
+		"srcip":  "10.0.0.1",
+		"msg":    "connection refused",
+	})
+
+	server.SetFormat(RFC3164)
+	server.SetKeyValues(&format.KeyValues{PairSeparators: ";"})
+	server.parser(nil, []byte(`<34>Oct 11 22:14:15 host app: user = bob; action="log in; out"`), "10.0.0.1:514", "", nil)
+	c.Check(handler.logParts[2]["fields"], DeepEquals, map[string]string{
+		"user":   "bob",
+		"action": "log in; out",
+	})
+}
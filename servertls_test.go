@@ -1,16 +1,105 @@
 package syslog
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/tls"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"fmt"
 	"io"
+	"math/big"
+	"net"
 	"time"
 
 	. "gopkg.in/check.v1"
 )
 
+// testPKI is a throwaway CA along with a server and a client certificate it
+// issued, the server one valid for 127.0.0.1
+type testPKI struct {
+	ca     *x509.Certificate
+	caKey  *ecdsa.PrivateKey
+	pool   *x509.CertPool
+	server tls.Certificate
+	client tls.Certificate
+}
+
+func newTestPKI() *testPKI {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "testca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &caKey.PublicKey, caKey)
+	if err != nil {
+		panic(err)
+	}
+	ca, err := x509.ParseCertificate(der)
+	if err != nil {
+		panic(err)
+	}
+
+	pki := &testPKI{ca: ca, caKey: caKey, pool: x509.NewCertPool()}
+	pki.pool.AddCert(ca)
+	pki.server = pki.issue(2, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "syslogserver"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	pki.client = pki.issue(3, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "device1"},
+		DNSNames:    []string{"device1.example.com"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	return pki
+}
+
+// issue signs template with the CA, filling in serial and validity
+func (p *testPKI) issue(serial int64, template *x509.Certificate) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	template.SerialNumber = big.NewInt(serial)
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+	der, err := x509.CreateCertificate(rand.Reader, template, p.ca, &key.PublicKey, p.caKey)
+	if err != nil {
+		panic(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		panic(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func (p *testPKI) serverConfig() *tls.Config {
+	return &tls.Config{
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		Certificates: []tls.Certificate{p.server},
+		ClientCAs:    p.pool,
+	}
+}
+
+func (p *testPKI) clientConfig() *tls.Config {
+	return &tls.Config{
+		Certificates: []tls.Certificate{p.client},
+		RootCAs:      p.pool,
+	}
+}
+
 func getServerConfig() *tls.Config {
 	capool := x509.NewCertPool()
 	if ok := capool.AppendCertsFromPEM([]byte(ca_s)); !ok {
@@ -0,0 +1,15 @@
+//go:build !unix
+
+package syslog
+
+import (
+	"errors"
+)
+
+func setIPv6Only(fd uintptr, v6only bool) error {
+	return errors.New("choosing the IPv6 stack is not supported on this system")
+}
+
+func getReadBuffer(fd uintptr) int {
+	return 0
+}
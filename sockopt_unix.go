@@ -0,0 +1,23 @@
+//go:build unix
+
+package syslog
+
+import (
+	"syscall"
+)
+
+func setIPv6Only(fd uintptr, v6only bool) error {
+	value := 0
+	if v6only {
+		value = 1
+	}
+	return syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_V6ONLY, value)
+}
+
+func getReadBuffer(fd uintptr) int {
+	size, err := syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_RCVBUF)
+	if err != nil {
+		return 0
+	}
+	return size
+}
@@ -0,0 +1,82 @@
+package syslog
+
+import (
+	"bufio"
+)
+
+// A frameSplitter splits a stream into frames and tells whether the last
+// frame was cut short
+type frameSplitter interface {
+	Split(data []byte, atEOF bool) (advance int, token []byte, err error)
+	Truncated() bool
+}
+
+// truncatingSplitter wraps a split function which knows nothing about
+// truncation. Frames which outgrow the scan buffer are cut down to its size,
+// and a frame the split function only returns because the stream ended is
+// flagged as truncated.
+type truncatingSplitter struct {
+	split      bufio.SplitFunc
+	maxSize    int
+	truncated  bool
+	discarding bool // dropping the rest of a frame which was cut down
+}
+
+func newTruncatingSplitter(split bufio.SplitFunc, maxSize int) *truncatingSplitter {
+	if split == nil {
+		split = bufio.ScanLines
+	}
+	return &truncatingSplitter{split: split, maxSize: maxSize}
+}
+
+func (t *truncatingSplitter) Truncated() bool {
+	return t.truncated
+}
+
+func (t *truncatingSplitter) Split(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	t.truncated = false
+	for {
+		n, token, err := t.splitOnce(data[advance:], atEOF)
+		advance += n
+		if token != nil || err != nil || n == 0 {
+			return advance, token, err
+		}
+	}
+}
+
+func (t *truncatingSplitter) splitOnce(data []byte, atEOF bool) (int, []byte, error) {
+	// Ask for a complete frame first, whatever comes out when telling the
+	// split function about the EOF is what the peer did not finish
+	advance, token, err := t.split(data, false)
+	if err != nil || advance > 0 || token != nil {
+		if t.discarding && token != nil {
+			// The tail of the frame which was cut down
+			t.discarding = false
+			return advance, nil, err
+		}
+		return advance, token, err
+	}
+
+	if len(data) >= t.maxSize {
+		if t.discarding {
+			return len(data), nil, nil
+		}
+		t.discarding = true
+		t.truncated = true
+		return t.maxSize, data[:t.maxSize], nil
+	}
+
+	if !atEOF {
+		// Request more data
+		return 0, nil, nil
+	}
+
+	if t.discarding {
+		t.discarding = false
+		return len(data), nil, nil
+	}
+
+	advance, token, err = t.split(data, true)
+	t.truncated = token != nil
+	return advance, token, err
+}
@@ -0,0 +1,36 @@
+package syslog
+
+import (
+	"bufio"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+type SplitterSuite struct{}
+
+var _ = Suite(&SplitterSuite{})
+
+func (s *SplitterSuite) TestTruncatingSplitter(c *C) {
+	splitter := newTruncatingSplitter(nil, 8)
+	scanner := bufio.NewScanner(strings.NewReader("short\nmuch too long\nok\npartial"))
+	scanner.Buffer(make([]byte, 8), 8)
+	scanner.Split(splitter.Split)
+
+	type frame struct {
+		text      string
+		truncated bool
+	}
+	var frames []frame
+	for scanner.Scan() {
+		frames = append(frames, frame{scanner.Text(), splitter.Truncated()})
+	}
+
+	c.Assert(scanner.Err(), IsNil)
+	c.Assert(frames, DeepEquals, []frame{
+		{"short", false},
+		{"much too", true},
+		{"ok", false},
+		{"partial", true},
+	})
+}
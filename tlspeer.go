@@ -0,0 +1,235 @@
+package syslog
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"path"
+	"strings"
+	"time"
+)
+
+const fingerprintPrefix = "SHA-256:"
+
+// TlsPeerPolicy authorizes TLS and DTLS peers by certificate fingerprint or
+// subjectAltName, as recommended by RFC5425 section 5.2, instead of by CN.
+//
+// A peer is authorized when the SHA-256 fingerprint of its certificate is
+// listed, or when its certificate chain was verified and one of its SANs
+// matches. The matching fingerprint or SAN becomes the tls_peer, unless
+// PeerNames maps it to another name. Peers matching nothing are rejected.
+type TlsPeerPolicy struct {
+	// Fingerprints as in RFC5425 section 4.2.2, e.g. "SHA-256:E1:2D:...".
+	// The prefix and the colons are optional
+	Fingerprints []string
+	// DNSNames may have a leading "*." matching a single label
+	DNSNames []string
+	// IPAddresses are single addresses or CIDR ranges
+	IPAddresses []string
+	// URIs may use the wildcards of path.Match
+	URIs []string
+	// PeerNames maps an authorized identity to the tls_peer to report
+	PeerNames map[string]string
+}
+
+// PeerStateFunc validates the policy and returns it as a TlsPeerStateFunc,
+// to be set with SetTlsPeerStateFunc
+func (p TlsPeerPolicy) PeerStateFunc() (TlsPeerStateFunc, error) {
+	fingerprints := make(map[string]bool, len(p.Fingerprints))
+	for _, fp := range p.Fingerprints {
+		normalized, err := normalizeFingerprint(fp)
+		if err != nil {
+			return nil, err
+		}
+		fingerprints[normalized] = true
+	}
+
+	var networks []*net.IPNet
+	for _, addr := range p.IPAddresses {
+		if !strings.Contains(addr, "/") {
+			ip := net.ParseIP(addr)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address %q", addr)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(addr)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network)
+	}
+
+	for _, uri := range p.URIs {
+		if _, err := path.Match(uri, ""); err != nil {
+			return nil, fmt.Errorf("invalid URI pattern %q: %w", uri, err)
+		}
+	}
+
+	authorize := func(state *tls.ConnectionState) (string, bool) {
+		if len(state.PeerCertificates) == 0 {
+			return "", false
+		}
+		leaf := state.PeerCertificates[0]
+
+		if fp := CertificateFingerprint(leaf); fingerprints[fp] {
+			return fp, true
+		}
+
+		// Names can only be trusted once the chain is verified
+		if len(state.VerifiedChains) == 0 {
+			return "", false
+		}
+
+		for _, name := range leaf.DNSNames {
+			for _, pattern := range p.DNSNames {
+				if matchDNSName(pattern, name) {
+					return name, true
+				}
+			}
+		}
+
+		for _, ip := range leaf.IPAddresses {
+			for _, network := range networks {
+				if network.Contains(ip) {
+					return ip.String(), true
+				}
+			}
+		}
+
+		for _, uri := range leaf.URIs {
+			for _, pattern := range p.URIs {
+				if ok, _ := path.Match(pattern, uri.String()); ok {
+					return uri.String(), true
+				}
+			}
+		}
+
+		return "", false
+	}
+
+	return func(state *tls.ConnectionState) (string, bool) {
+		identity, ok := authorize(state)
+		if !ok {
+			return "", false
+		}
+		if name, found := p.PeerNames[identity]; found {
+			return name, true
+		}
+		return identity, true
+	}, nil
+}
+
+// CertificateFingerprint returns the SHA-256 fingerprint of cert in the
+// notation of RFC5425 section 4.2.2
+func CertificateFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	hexSum := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	var b strings.Builder
+	b.WriteString(fingerprintPrefix)
+	for i := 0; i < len(hexSum); i += 2 {
+		if i > 0 {
+			b.WriteByte(':')
+		}
+		b.WriteString(hexSum[i : i+2])
+	}
+	return b.String()
+}
+
+func normalizeFingerprint(fp string) (string, error) {
+	digits := strings.TrimSpace(fp)
+	if i := strings.Index(digits, ":"); i >= 0 && !isHexPair(digits[:i]) {
+		if !strings.EqualFold(digits[:i+1], fingerprintPrefix) {
+			return "", fmt.Errorf("unsupported fingerprint hash in %q, only SHA-256 is", fp)
+		}
+		digits = digits[i+1:]
+	}
+	digits = strings.ReplaceAll(digits, ":", "")
+
+	raw, err := hex.DecodeString(digits)
+	if err != nil || len(raw) != sha256.Size {
+		return "", fmt.Errorf("invalid SHA-256 fingerprint %q", fp)
+	}
+
+	var b strings.Builder
+	b.WriteString(fingerprintPrefix)
+	for i, c := range raw {
+		if i > 0 {
+			b.WriteByte(':')
+		}
+		fmt.Fprintf(&b, "%02X", c)
+	}
+	return b.String(), nil
+}
+
+func isHexPair(s string) bool {
+	_, err := hex.DecodeString(s)
+	return len(s) == 2 && err == nil
+}
+
+// matchDNSName matches name against pattern, where a leading "*." stands for
+// exactly one label (RFC6125 section 6.4.3)
+func matchDNSName(pattern string, name string) bool {
+	pattern = strings.TrimSuffix(strings.ToLower(pattern), ".")
+	name = strings.TrimSuffix(strings.ToLower(name), ".")
+
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		label, rest, found := strings.Cut(name, ".")
+		return found && label != "" && rest == suffix
+	}
+	return pattern == name
+}
+
+// TlsCertSummary describes one certificate of the chain a TLS or DTLS peer
+// presented. It is handed to handlers in the "tls_chain" part.
+type TlsCertSummary struct {
+	Subject      string
+	Issuer       string
+	SerialNumber string
+	Fingerprint  string
+	NotBefore    time.Time
+	NotAfter     time.Time
+	DNSNames     []string
+	IPAddresses  []string
+	URIs         []string
+}
+
+// tlsChainSummary summarizes the first verified chain of the peer, from its
+// certificate up to the trusted root, or just the presented certificates if
+// the chain was not verified
+func tlsChainSummary(state *tls.ConnectionState) []TlsCertSummary {
+	chain := state.PeerCertificates
+	if len(state.VerifiedChains) > 0 {
+		chain = state.VerifiedChains[0]
+	}
+
+	summary := make([]TlsCertSummary, 0, len(chain))
+	for _, cert := range chain {
+		s := TlsCertSummary{
+			Subject:      cert.Subject.String(),
+			Issuer:       cert.Issuer.String(),
+			SerialNumber: cert.SerialNumber.String(),
+			Fingerprint:  CertificateFingerprint(cert),
+			NotBefore:    cert.NotBefore,
+			NotAfter:     cert.NotAfter,
+			DNSNames:     cert.DNSNames,
+		}
+		for _, ip := range cert.IPAddresses {
+			s.IPAddresses = append(s.IPAddresses, ip.String())
+		}
+		for _, uri := range cert.URIs {
+			s.URIs = append(s.URIs, uri.String())
+		}
+		summary = append(summary, s)
+	}
+	return summary
+}
@@ -0,0 +1,131 @@
+package syslog
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type TlsPeerSuite struct{}
+
+var _ = Suite(&TlsPeerSuite{})
+
+func verifiedState(pki *testPKI, cert tls.Certificate) *tls.ConnectionState {
+	return &tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{cert.Leaf},
+		VerifiedChains:   [][]*x509.Certificate{{cert.Leaf, pki.ca}},
+	}
+}
+
+func (s *TlsPeerSuite) TestFingerprint(c *C) {
+	pki := newTestPKI()
+	fp := CertificateFingerprint(pki.client.Leaf)
+	c.Assert(fp, Matches, "SHA-256(:[0-9A-F]{2}){32}")
+
+	// Fingerprints authorize unverified, e.g. self-signed, certificates
+	state := &tls.ConnectionState{PeerCertificates: []*x509.Certificate{pki.client.Leaf}}
+	for _, allowed := range []string{fp, strings.ToLower(fp[len("SHA-256:"):]), strings.ReplaceAll(fp[len("SHA-256:"):], ":", "")} {
+		f, err := TlsPeerPolicy{Fingerprints: []string{allowed}}.PeerStateFunc()
+		c.Assert(err, IsNil)
+		peer, ok := f(state)
+		c.Check(ok, Equals, true)
+		c.Check(peer, Equals, fp)
+	}
+
+	f, err := TlsPeerPolicy{Fingerprints: []string{CertificateFingerprint(pki.server.Leaf)}}.PeerStateFunc()
+	c.Assert(err, IsNil)
+	_, ok := f(state)
+	c.Check(ok, Equals, false)
+
+	_, err = TlsPeerPolicy{Fingerprints: []string{"SHA-1:E1:2D"}}.PeerStateFunc()
+	c.Check(err, ErrorMatches, "unsupported fingerprint hash.*")
+	_, err = TlsPeerPolicy{Fingerprints: []string{"SHA-256:E1:2D"}}.PeerStateFunc()
+	c.Check(err, ErrorMatches, "invalid SHA-256 fingerprint.*")
+}
+
+func (s *TlsPeerSuite) TestSubjectAltNames(c *C) {
+	pki := newTestPKI()
+	uri, _ := url.Parse("spiffe://example.org/ns/prod/sa/syslog")
+	cert := pki.issue(10, &x509.Certificate{
+		DNSNames:    []string{"host1.dc1.example.com"},
+		IPAddresses: []net.IP{net.ParseIP("10.1.2.3")},
+		URIs:        []*url.URL{uri},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	state := verifiedState(pki, cert)
+
+	tests := []struct {
+		policy TlsPeerPolicy
+		peer   string
+		ok     bool
+	}{
+		{TlsPeerPolicy{DNSNames: []string{"*.dc1.example.com"}}, "host1.dc1.example.com", true},
+		{TlsPeerPolicy{DNSNames: []string{"HOST1.dc1.example.com."}}, "host1.dc1.example.com", true},
+		{TlsPeerPolicy{DNSNames: []string{"*.example.com"}}, "", false},
+		{TlsPeerPolicy{IPAddresses: []string{"10.1.0.0/16"}}, "10.1.2.3", true},
+		{TlsPeerPolicy{IPAddresses: []string{"10.1.2.3"}}, "10.1.2.3", true},
+		{TlsPeerPolicy{IPAddresses: []string{"10.1.2.4"}}, "", false},
+		{TlsPeerPolicy{URIs: []string{"spiffe://example.org/ns/*/sa/syslog"}}, uri.String(), true},
+		{TlsPeerPolicy{URIs: []string{"spiffe://example.org/ns/dev/*"}}, "", false},
+		{TlsPeerPolicy{
+			DNSNames:  []string{"*.dc1.example.com"},
+			PeerNames: map[string]string{"host1.dc1.example.com": "router-1"},
+		}, "router-1", true},
+		{TlsPeerPolicy{}, "", false},
+	}
+
+	for _, test := range tests {
+		f, err := test.policy.PeerStateFunc()
+		c.Assert(err, IsNil)
+		peer, ok := f(state)
+		c.Check(ok, Equals, test.ok, Commentf("%+v", test.policy))
+		c.Check(peer, Equals, test.peer, Commentf("%+v", test.policy))
+	}
+
+	// Names are only trusted on a verified chain
+	f, err := TlsPeerPolicy{DNSNames: []string{"*.dc1.example.com"}}.PeerStateFunc()
+	c.Assert(err, IsNil)
+	_, ok := f(&tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert.Leaf}})
+	c.Check(ok, Equals, false)
+}
+
+func (s *ServerSuite) TestTLSPeerPolicy(c *C) {
+	pki := newTestPKI()
+	channel := make(LogPartsChannel, 1)
+	server := NewServer()
+	server.SetFormat(RFC5424)
+	server.SetHandler(NewChannelHandler(channel))
+	policy, err := TlsPeerPolicy{DNSNames: []string{"*.example.com"}}.PeerStateFunc()
+	c.Assert(err, IsNil)
+	server.SetTlsPeerStateFunc(policy)
+	err = server.ListenTCPTLS("127.0.0.1:0", pki.serverConfig())
+	c.Assert(err, IsNil)
+	server.Boot()
+
+	conn, err := tls.Dial("tcp", server.listeners[0].Addr().String(), pki.clientConfig())
+	c.Assert(err, IsNil)
+	_, err = conn.Write([]byte(exampleRFC5424Syslog + "\n"))
+	c.Assert(err, IsNil)
+
+	select {
+	case logParts := <-channel:
+		c.Check(logParts["tls_peer"], Equals, "device1.example.com")
+		chain := logParts["tls_chain"].([]TlsCertSummary)
+		c.Assert(chain, HasLen, 2)
+		c.Check(chain[0].Subject, Equals, "CN=device1")
+		c.Check(chain[0].Fingerprint, Equals, CertificateFingerprint(pki.client.Leaf))
+		c.Check(chain[0].DNSNames, DeepEquals, []string{"device1.example.com"})
+		c.Check(chain[1].Subject, Equals, "CN=testca")
+	case <-time.After(5 * time.Second):
+		c.Fatal("timed out waiting for TLS message")
+	}
+
+	conn.Close()
+	server.Kill()
+	server.Wait()
+}
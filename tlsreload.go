@@ -0,0 +1,220 @@
+package syslog
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultTlsWatchInterval = 10 * time.Second
+
+// TlsReloader holds a TLS configuration which can be replaced while the
+// server runs. Every new handshake uses the configuration current at that
+// time, established sessions are kept.
+//
+// A failed reload is reported and leaves the current configuration in place.
+type TlsReloader struct {
+	load func() (*tls.Config, error)
+	// changed tells whether load would see anything new, nil means always
+	changed  func() bool
+	interval time.Duration
+
+	mu      sync.Mutex
+	current atomic.Pointer[tls.Config]
+}
+
+// NewTlsReloader returns a TlsReloader taking its configuration from load,
+// which is called once right away and again on every Reload. load has to
+// return a new tls.Config every time, it is not copied.
+func NewTlsReloader(load func() (*tls.Config, error)) (*TlsReloader, error) {
+	r := &TlsReloader{load: load}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// NewTlsFileReloader returns a TlsReloader which loads the PEM encoded
+// certificate and key from certFile and keyFile and, unless caFile is empty,
+// the client CAs from caFile. Every other setting is taken from base, which
+// may be nil. The files are checked for changes every 10 seconds, see
+// SetWatchInterval.
+func NewTlsFileReloader(base *tls.Config, certFile string, keyFile string, caFile string) (*TlsReloader, error) {
+	if base == nil {
+		base = &tls.Config{}
+	}
+	base = base.Clone()
+
+	files := []string{certFile, keyFile}
+	if caFile != "" {
+		files = append(files, caFile)
+	}
+	stamps := make([]fileStamp, len(files))
+
+	load := func() (*tls.Config, error) {
+		for i, file := range files {
+			stamps[i] = statFile(file)
+		}
+
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		config := base.Clone()
+		config.Certificates = []tls.Certificate{cert}
+
+		if caFile != "" {
+			pem, err := os.ReadFile(caFile)
+			if err != nil {
+				return nil, err
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates found in %s", caFile)
+			}
+			config.ClientCAs = pool
+		}
+
+		return config, nil
+	}
+
+	changed := func() bool {
+		for i, file := range files {
+			if statFile(file) != stamps[i] {
+				return true
+			}
+		}
+		return false
+	}
+
+	r := &TlsReloader{load: load, changed: changed, interval: defaultTlsWatchInterval}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// statFile returns the zero stamp for missing files, so they count as
+// changed once they are back
+func statFile(name string) fileStamp {
+	info, err := os.Stat(name)
+	if err != nil {
+		return fileStamp{}
+	}
+	return fileStamp{modTime: info.ModTime(), size: info.Size()}
+}
+
+// SetWatchInterval Sets how often the server checks for a new configuration.
+// Reloaders created by NewTlsReloader are only checked if this is set, by
+// calling load every interval. 0 turns checking off, leaving Reload.
+func (r *TlsReloader) SetWatchInterval(interval time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.interval = interval
+}
+
+func (r *TlsReloader) watchInterval() time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.interval
+}
+
+// Reload loads the configuration now, e.g. on SIGHUP. On failure the current
+// configuration is kept.
+func (r *TlsReloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	config, err := r.load()
+	if err != nil {
+		return err
+	}
+	if config == nil {
+		return errors.New("TLS reload returned no configuration")
+	}
+	r.current.Store(config)
+	return nil
+}
+
+// reloadIfChanged reloads unless the reloader knows nothing changed
+func (r *TlsReloader) reloadIfChanged() error {
+	r.mu.Lock()
+	changed := r.changed == nil || r.changed()
+	r.mu.Unlock()
+
+	if !changed {
+		return nil
+	}
+	return r.Reload()
+}
+
+// Current returns the configuration used for new handshakes
+func (r *TlsReloader) Current() *tls.Config {
+	return r.current.Load()
+}
+
+// Config returns a tls.Config which hands every handshake to the current
+// configuration. It can be used wherever a *tls.Config is taken, e.g. with
+// ListenHTTPS, but only ListenTCPTLSReloading watches the reloader.
+func (r *TlsReloader) Config() *tls.Config {
+	return &tls.Config{
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return r.current.Load(), nil
+		},
+	}
+}
+
+// ListenTCPTLSReloading Configures the server for listen on a TCP addr for TLS,
+// with certificates and CAs which are reloaded while the server runs
+func (s *Server) ListenTCPTLSReloading(addr string, reloader *TlsReloader) error {
+	err := s.ListenTCPTLS(addr, reloader.Config())
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tlsReloaders = append(s.tlsReloaders, reloader)
+	if s.running {
+		s.goWatchTls(reloader)
+	}
+	return nil
+}
+
+func (s *Server) goWatchTls(reloader *TlsReloader) {
+	interval := reloader.watchInterval()
+	if interval <= 0 {
+		return
+	}
+
+	done := s.done
+
+	s.spawn(nil, func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			if err := reloader.reloadIfChanged(); err != nil {
+				err = fmt.Errorf("TLS reload failed, keeping the current configuration: %w", err)
+				s.report(err)
+			}
+		}
+	})
+}
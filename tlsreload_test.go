@@ -0,0 +1,117 @@
+package syslog
+
+import (
+	"crypto/ecdsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func writePEM(c *C, name string, blockType string, der []byte) {
+	err := os.WriteFile(name, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600)
+	c.Assert(err, IsNil)
+}
+
+// writeTestPKI writes the server certificate, its key and the CA of pki into dir
+func writeTestPKI(c *C, dir string, pki *testPKI) (certFile string, keyFile string, caFile string) {
+	certFile = filepath.Join(dir, "server.crt")
+	keyFile = filepath.Join(dir, "server.key")
+	caFile = filepath.Join(dir, "ca.crt")
+
+	key, err := x509.MarshalECPrivateKey(pki.server.PrivateKey.(*ecdsa.PrivateKey))
+	c.Assert(err, IsNil)
+	writePEM(c, certFile, "CERTIFICATE", pki.server.Certificate[0])
+	writePEM(c, keyFile, "EC PRIVATE KEY", key)
+	writePEM(c, caFile, "CERTIFICATE", pki.ca.Raw)
+	return
+}
+
+func (s *ServerSuite) TestTlsReloader(c *C) {
+	calls := 0
+	reloader, err := NewTlsReloader(func() (*tls.Config, error) {
+		calls++
+		if calls > 1 {
+			return nil, errors.New("broken")
+		}
+		return &tls.Config{ServerName: "first"}, nil
+	})
+	c.Assert(err, IsNil)
+	c.Check(reloader.Current().ServerName, Equals, "first")
+
+	c.Check(reloader.Reload(), ErrorMatches, "broken")
+	c.Check(reloader.Current().ServerName, Equals, "first")
+
+	_, err = NewTlsFileReloader(nil, "missing.crt", "missing.key", "")
+	c.Check(err, NotNil)
+}
+
+func (s *ServerSuite) TestTLSReloadFiles(c *C) {
+	dir := c.MkDir()
+	first, second := newTestPKI(), newTestPKI()
+	certFile, keyFile, caFile := writeTestPKI(c, dir, first)
+
+	reloader, err := NewTlsFileReloader(&tls.Config{ClientAuth: tls.RequireAndVerifyClientCert}, certFile, keyFile, caFile)
+	c.Assert(err, IsNil)
+	reloader.SetWatchInterval(10 * time.Millisecond)
+
+	channel := make(LogPartsChannel, 10)
+	server := NewServer()
+	server.SetFormat(RFC5424)
+	server.SetHandler(NewChannelHandler(channel))
+	err = server.ListenTCPTLSReloading("127.0.0.1:0", reloader)
+	c.Assert(err, IsNil)
+	server.Boot()
+	addr := server.listeners[0].Addr().String()
+
+	established, err := tls.Dial("tcp", addr, first.clientConfig())
+	c.Assert(err, IsNil)
+
+	// Break the files, the current configuration stays
+	c.Assert(os.WriteFile(keyFile, []byte("garbage"), 0600), IsNil)
+	select {
+	case err := <-server.ErrChan:
+		c.Check(err, ErrorMatches, "TLS reload failed, keeping the current configuration: .*")
+	case <-time.After(5 * time.Second):
+		c.Fatal("timed out waiting for the reload error")
+	}
+	conn, err := tls.Dial("tcp", addr, first.clientConfig())
+	c.Assert(err, IsNil)
+	conn.Close()
+
+	// Rotate to the second PKI
+	writeTestPKI(c, dir, second)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		conn, err = tls.Dial("tcp", addr, second.clientConfig())
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			c.Fatalf("new certificates not picked up: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	_, err = tls.Dial("tcp", addr, first.clientConfig())
+	c.Check(err, NotNil)
+
+	// Sessions from before the rotation keep working
+	for _, conn := range []*tls.Conn{established, conn} {
+		_, err = conn.Write([]byte(exampleRFC5424Syslog + "\n"))
+		c.Assert(err, IsNil)
+		select {
+		case <-channel:
+		case <-time.After(5 * time.Second):
+			c.Fatal("timed out waiting for TLS message")
+		}
+		conn.Close()
+	}
+
+	server.Kill()
+	server.Wait()
+}
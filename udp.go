@@ -0,0 +1,160 @@
+package syslog
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"syscall"
+
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// UDPStack selects the IP versions an UDP listener accepts
+type UDPStack int
+
+const (
+	UDPStackDefault   UDPStack = iota // as the system does for the address, dual stack for wildcards
+	UDPStackIPv4                      // IPv4 only
+	UDPStackIPv6Only                  // IPv6 only
+	UDPStackDualStack                 // IPv6 along with IPv4 mapped addresses
+)
+
+// UDPOptions configure an UDP listener beyond its address
+type UDPOptions struct {
+	// MulticastGroups are IPv4 or IPv6 groups to join, e.g. "239.192.0.1" or
+	// "ff05::514". Bind to a wildcard address with the port of the group.
+	MulticastGroups []string
+	// Interfaces are the names of the interfaces to join the groups on. If
+	// empty, the system picks one.
+	Interfaces []string
+	Stack      UDPStack
+	// ReadBuffer is the socket receive buffer size to ask for, 0 means the
+	// default of 900KiB. The kernel may grant a different size, which
+	// ListenUDPWithOptions returns.
+	ReadBuffer int
+}
+
+// UDPListenerInfo tells what an UDP listener ended up with
+type UDPListenerInfo struct {
+	Addr net.Addr
+	// ReadBuffer is the receive buffer size granted by the kernel, 0 if the
+	// system does not tell
+	ReadBuffer int
+}
+
+// ListenUDPWithOptions Configure the server for listen on an UDP addr, joining
+// multicast groups and choosing the IP versions and the receive buffer size
+func (s *Server) ListenUDPWithOptions(addr string, opts UDPOptions) (UDPListenerInfo, error) {
+	l := &listener{
+		kind:      packetListener,
+		network:   "udp",
+		requested: addr,
+		open:      s.openUDPWithOptions(opts),
+	}
+	if err := s.addListener(l); err != nil {
+		return UDPListenerInfo{}, err
+	}
+	return UDPListenerInfo{Addr: l.Addr(), ReadBuffer: l.readBuffer}, nil
+}
+
+func (s *Server) openUDPWithOptions(opts UDPOptions) func(l *listener, addr string, reopen bool) error {
+	return func(l *listener, addr string, reopen bool) error {
+		network := "udp"
+		lc := net.ListenConfig{}
+		switch opts.Stack {
+		case UDPStackIPv4:
+			network = "udp4"
+		case UDPStackIPv6Only, UDPStackDualStack:
+			network = "udp6"
+			v6only := opts.Stack == UDPStackIPv6Only
+			lc.Control = func(network string, address string, c syscall.RawConn) error {
+				var err error
+				controlErr := c.Control(func(fd uintptr) {
+					err = setIPv6Only(fd, v6only)
+				})
+				if controlErr != nil {
+					return controlErr
+				}
+				return err
+			}
+		}
+
+		packetConn, err := lc.ListenPacket(context.Background(), network, addr)
+		if err != nil {
+			return err
+		}
+		connection := packetConn.(*net.UDPConn)
+
+		readBuffer := opts.ReadBuffer
+		if readBuffer <= 0 {
+			readBuffer = datagramReadBufferSize
+		}
+		err = connection.SetReadBuffer(readBuffer)
+		if err != nil {
+			s.report(err)
+		}
+		l.readBuffer = socketReadBuffer(connection)
+
+		if err := joinGroups(connection, opts); err != nil {
+			connection.Close()
+			return err
+		}
+
+		l.packet = connection
+		return nil
+	}
+}
+
+// joinGroups joins the multicast groups of opts on every interface asked for
+func joinGroups(connection *net.UDPConn, opts UDPOptions) error {
+	if len(opts.MulticastGroups) == 0 {
+		return nil
+	}
+
+	interfaces := []*net.Interface{nil}
+	if len(opts.Interfaces) > 0 {
+		interfaces = interfaces[:0]
+		for _, name := range opts.Interfaces {
+			ifi, err := net.InterfaceByName(name)
+			if err != nil {
+				return err
+			}
+			interfaces = append(interfaces, ifi)
+		}
+	}
+
+	for _, group := range opts.MulticastGroups {
+		ip := net.ParseIP(group)
+		if ip == nil || !ip.IsMulticast() {
+			return fmt.Errorf("invalid multicast group %q", group)
+		}
+
+		for _, ifi := range interfaces {
+			var err error
+			if ip.To4() != nil {
+				err = ipv4.NewPacketConn(connection).JoinGroup(ifi, &net.UDPAddr{IP: ip})
+			} else {
+				err = ipv6.NewPacketConn(connection).JoinGroup(ifi, &net.UDPAddr{IP: ip})
+			}
+			if err != nil {
+				return fmt.Errorf("joining %s: %w", group, err)
+			}
+		}
+	}
+	return nil
+}
+
+// socketReadBuffer returns the receive buffer size of connection
+func socketReadBuffer(connection *net.UDPConn) int {
+	rawConn, err := connection.SyscallConn()
+	if err != nil {
+		return 0
+	}
+
+	size := 0
+	rawConn.Control(func(fd uintptr) {
+		size = getReadBuffer(fd)
+	})
+	return size
+}
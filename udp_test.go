@@ -0,0 +1,112 @@
+package syslog
+
+import (
+	"net"
+	"time"
+
+	"golang.org/x/net/ipv4"
+	. "gopkg.in/check.v1"
+)
+
+func (s *ServerSuite) TestUDPReadBuffer(c *C) {
+	server := NewServer()
+	info, err := server.ListenUDPWithOptions("127.0.0.1:0", UDPOptions{ReadBuffer: 64 * 1024})
+	c.Assert(err, IsNil)
+	c.Check(info.Addr, NotNil)
+	// Linux doubles the size asked for, to account for its bookkeeping
+	c.Check(info.ReadBuffer >= 64*1024, Equals, true, Commentf("%d", info.ReadBuffer))
+	server.Kill()
+}
+
+func (s *ServerSuite) TestUDPStack(c *C) {
+	if _, err := net.ResolveUDPAddr("udp6", "[::1]:0"); err != nil {
+		c.Skip("no IPv6")
+	}
+
+	channel := make(LogPartsChannel, 10)
+	server := NewServer()
+	server.SetFormat(RFC3164)
+	server.SetHandler(NewChannelHandler(channel))
+	info, err := server.ListenUDPWithOptions("[::]:0", UDPOptions{Stack: UDPStackIPv6Only})
+	if err != nil {
+		c.Skip("no IPv6: " + err.Error())
+	}
+	server.Boot()
+	port := info.Addr.(*net.UDPAddr).Port
+
+	conn, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port})
+	c.Assert(err, IsNil)
+	conn.Write([]byte(exampleSyslog))
+	conn.Close()
+	conn, err = net.DialUDP("udp", nil, &net.UDPAddr{IP: net.IPv6loopback, Port: port})
+	c.Assert(err, IsNil)
+	conn.Write([]byte(exampleSyslog))
+
+	c.Check(receiveContent(c, channel), Equals, conn.LocalAddr().String())
+	select {
+	case logParts := <-channel:
+		c.Fatalf("IPv4 datagram delivered to an IPv6 only listener: %v", logParts)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	conn.Close()
+	server.Kill()
+	server.Wait()
+}
+
+func multicastInterface() *net.Interface {
+	interfaces, _ := net.Interfaces()
+	for _, ifi := range interfaces {
+		if ifi.Flags&net.FlagUp != 0 && ifi.Flags&net.FlagMulticast != 0 {
+			return &ifi
+		}
+	}
+	return nil
+}
+
+func (s *ServerSuite) TestUDPMulticast(c *C) {
+	server := NewServer()
+	_, err := server.ListenUDPWithOptions("0.0.0.0:0", UDPOptions{MulticastGroups: []string{"10.0.0.1"}})
+	c.Check(err, ErrorMatches, `invalid multicast group "10.0.0.1"`)
+	_, err = server.ListenUDPWithOptions("0.0.0.0:0", UDPOptions{
+		MulticastGroups: []string{"239.255.51.4"},
+		Interfaces:      []string{"nosuchinterface0"},
+	})
+	c.Check(err, NotNil)
+
+	ifi := multicastInterface()
+	if ifi == nil {
+		c.Skip("no multicast interface")
+	}
+
+	channel := make(LogPartsChannel, 10)
+	server.SetFormat(RFC3164)
+	server.SetHandler(NewChannelHandler(channel))
+	info, err := server.ListenUDPWithOptions("0.0.0.0:0", UDPOptions{
+		MulticastGroups: []string{"239.255.51.4"},
+		Interfaces:      []string{ifi.Name},
+		Stack:           UDPStackIPv4,
+	})
+	c.Assert(err, IsNil)
+	server.Boot()
+
+	conn, err := net.ListenPacket("udp4", "0.0.0.0:0")
+	c.Assert(err, IsNil)
+	pc := ipv4.NewPacketConn(conn)
+	c.Assert(pc.SetMulticastInterface(ifi), IsNil)
+	c.Assert(pc.SetMulticastLoopback(true), IsNil)
+	group := &net.UDPAddr{IP: net.ParseIP("239.255.51.4"), Port: info.Addr.(*net.UDPAddr).Port}
+	_, err = conn.WriteTo([]byte(exampleSyslog), group)
+	c.Assert(err, IsNil)
+
+	select {
+	case logParts := <-channel:
+		c.Check(logParts["hostname"], Equals, "hostname")
+	case <-time.After(5 * time.Second):
+		c.Fatal("timed out waiting for the multicast message")
+	}
+
+	conn.Close()
+	server.Kill()
+	server.Wait()
+}